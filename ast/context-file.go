@@ -32,6 +32,12 @@ func (sf *SourceFile) Add(globalStmt Statement) {
 		if sym, ok := sf.Symbols.resolve(decl.DeclName().Value); !ok || sym.Decl == nil {
 			sf.Symbols.Insert(decl)
 		}
+		if imp, ok := decl.(*DeclImport); ok {
+			// imported members are used without the module prefix
+			for i := range imp.Members {
+				sf.Symbols.Insert(&imp.Members[i])
+			}
+		}
 		return
 	}
 	sf.Statements = append(sf.Statements, globalStmt)
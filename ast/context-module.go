@@ -19,7 +19,7 @@ func MakeContextModule(name registry.LogicalURI) *ContextModule {
 		Name:  name,
 		Files: []*SourceFile{},
 	}
-	m.Symbols = MakeSymbolTable(m.Symbols.Parent, nil)
+	m.Symbols = MakeSymbolTable(nil, nil)
 	return m
 }
 
@@ -47,7 +47,7 @@ func (e DeclExternFunc) DeclOverview() string {
 	}
 	paramNames := make([]string, len(e.Parameters))
 	for i, param := range e.Parameters {
-		paramNames[i] = string(param.Name.Value)
+		paramNames[i] = param.DeclOverview()
 	}
 	return fmt.Sprintf("extern func %s(%s)", e.Name, strings.Join(paramNames, ", "))
 }
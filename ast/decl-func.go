@@ -40,7 +40,7 @@ func (e DeclFunc) DeclOverview() string {
 	}
 	paramNames := make([]string, len(e.Impl.Parameters))
 	for i, param := range e.Impl.Parameters {
-		paramNames[i] = string(param.Name.Value)
+		paramNames[i] = param.DeclOverview()
 	}
 	return fmt.Sprintf("func %s { %s -> }", e.Name, strings.Join(paramNames, ", "))
 }
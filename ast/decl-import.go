@@ -49,8 +49,6 @@ func (e *DeclImport) AddMember(member DeclImportMember) {
 
 func MakeDeclImport(tok token.Token, name StaticReference) *DeclImport {
 	moduleName := ModuleName(name)
-	moduleName = moduleName[:len(moduleName)-1]
-
 	alias := Identifier(name[len(name)-1])
 	return &DeclImport{
 		Token:      tok,
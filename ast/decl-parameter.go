@@ -5,10 +5,14 @@ import (
 )
 
 var _ Decl = DeclParameter{}
+var _ Overviewable = DeclParameter{}
 
 type DeclParameter struct {
 	Name        Identifier
 	Annotations AnnotationChain
+	// Variadic parameters collect all remaining arguments into an array.
+	// Only the last parameter may be variadic.
+	Variadic bool
 
 	Docs *Docs
 }
@@ -25,6 +29,13 @@ func (e DeclParameter) DeclName() Identifier {
 	return e.Name
 }
 
+func (e DeclParameter) DeclOverview() string {
+	if e.Variadic {
+		return e.Name.Value + "..."
+	}
+	return e.Name.Value
+}
+
 func (e DeclParameter) ExportScope() ExportScope {
 	return ExportScopeLocal
 }
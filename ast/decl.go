@@ -1,5 +1,7 @@
 package ast
 
+import "strings"
+
 type ExportScope int
 
 const (
@@ -18,3 +20,9 @@ type DeclWithSymbols interface {
 	Decl
 	Symbols() *SymbolTable
 }
+
+// IsPrivate reports whether a name is private to its module.
+// Private names start with `_` and cannot be accessed from other modules.
+func IsPrivate(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
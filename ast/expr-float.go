@@ -1,7 +1,11 @@
 package ast
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/vknabel/zirric/token"
 )
@@ -16,9 +20,27 @@ type ExprFloat struct {
 func MakeExprFloat(literal float64, token token.Token) *ExprFloat {
 	return &ExprFloat{
 		Literal: literal,
+		Token:   token,
 	}
 }
 
+// ParseExprFloat converts a FLOAT token into an ExprFloat.
+// Literals exceeding the range of a 64 bit float are reported instead of becoming infinite or zero.
+func ParseExprFloat(tok token.Token) (*ExprFloat, error) {
+	literal := strings.ReplaceAll(tok.Literal, "_", "")
+	val, err := strconv.ParseFloat(literal, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if math.IsInf(val, 0) {
+			return MakeExprFloat(val, tok), fmt.Errorf("float literal %s overflows Float", tok.Literal)
+		}
+		return MakeExprFloat(val, tok), fmt.Errorf("float literal %s underflows Float", tok.Literal)
+	}
+	if err != nil {
+		return MakeExprFloat(val, tok), err
+	}
+	return MakeExprFloat(val, tok), nil
+}
+
 // TokenLiteral implements Expr.
 func (e ExprFloat) TokenLiteral() token.Token {
 	return e.Token
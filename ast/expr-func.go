@@ -56,7 +56,7 @@ func (e ExprFunc) Expression() string {
 
 	out.WriteString("{")
 	for i, p := range e.Parameters {
-		out.WriteString(p.Name.String())
+		out.WriteString(p.DeclOverview())
 
 		if i+1 < len(e.Parameters) {
 			out.WriteString(", ")
@@ -12,6 +12,9 @@ type ExprIndexAccess struct {
 	Token     token.Token
 	Target    Expr
 	IndexExpr Expr
+
+	// Optional accesses short-circuit to null when the target is null.
+	Optional bool
 }
 
 func MakeExprIndexAccess(tok token.Token, target Expr, indexExpr Expr) *ExprIndexAccess {
@@ -42,7 +45,11 @@ func (e ExprIndexAccess) Expression() string {
 
 	out.WriteString("(")
 	out.WriteString(e.Target.Expression())
-	out.WriteString("[")
+	if e.Optional {
+		out.WriteString("?[")
+	} else {
+		out.WriteString("[")
+	}
 	out.WriteString(e.IndexExpr.Expression())
 	out.WriteString("]")
 	out.WriteString(")")
@@ -1,7 +1,10 @@
 package ast
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/vknabel/zirric/token"
 )
@@ -20,6 +23,20 @@ func MakeExprInt(literal int64, token token.Token) *ExprInt {
 	}
 }
 
+// ParseExprInt converts an INT token into an ExprInt.
+// Literals exceeding 64 bits are reported instead of being truncated.
+func ParseExprInt(tok token.Token) (*ExprInt, error) {
+	literal := strings.ReplaceAll(tok.Literal, "_", "")
+	val, err := strconv.ParseInt(literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return MakeExprInt(val, tok), fmt.Errorf("integer literal %s overflows Int", tok.Literal)
+	}
+	if err != nil {
+		return MakeExprInt(val, tok), err
+	}
+	return MakeExprInt(val, tok), nil
+}
+
 // EnumerateChildNodes implements Expr.
 func (ExprInt) EnumerateChildNodes(func(child Node)) {
 	// No child nodes.
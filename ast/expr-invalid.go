@@ -0,0 +1,34 @@
+package ast
+
+import (
+	"github.com/vknabel/zirric/token"
+)
+
+var _ Expr = ExprInvalid{}
+
+// ExprInvalid takes the place of a malformed token like `0b102`,
+// that has already been reported, so parsing continues without follow-up errors.
+type ExprInvalid struct {
+	Token token.Token
+}
+
+func MakeExprInvalid(tok token.Token) *ExprInvalid {
+	return &ExprInvalid{
+		Token: tok,
+	}
+}
+
+// EnumerateChildNodes implements Expr.
+func (ExprInvalid) EnumerateChildNodes(func(child Node)) {
+	// No child nodes.
+}
+
+// TokenLiteral implements Expr.
+func (n ExprInvalid) TokenLiteral() token.Token {
+	return n.Token
+}
+
+// Expression implements Expr.
+func (e ExprInvalid) Expression() string {
+	return e.Token.Literal
+}
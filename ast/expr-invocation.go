@@ -11,6 +11,18 @@ var _ Expr = ExprInvocation{}
 type ExprInvocation struct {
 	Function  Expr
 	Arguments []Expr
+
+	// Spread passes the elements of the last positional argument
+	// as individual arguments.
+	Spread bool
+
+	// Named arguments always follow the positional Arguments.
+	NamedArguments []ExprNamedArgument
+}
+
+type ExprNamedArgument struct {
+	Name  Identifier
+	Value Expr
 }
 
 func MakeExprInvocation(function Expr) *ExprInvocation {
@@ -23,12 +35,20 @@ func (e *ExprInvocation) AddArgument(argument Expr) {
 	e.Arguments = append(e.Arguments, argument)
 }
 
+func (e *ExprInvocation) AddNamedArgument(name Identifier, value Expr) {
+	e.NamedArguments = append(e.NamedArguments, ExprNamedArgument{Name: name, Value: value})
+}
+
 // EnumerateChildNodes implements Expr.
 func (n ExprInvocation) EnumerateChildNodes(action func(child Node)) {
 	action(n.Function)
 	for _, argument := range n.Arguments {
 		action(argument)
 	}
+	for _, argument := range n.NamedArguments {
+		action(argument.Name)
+		action(argument.Value)
+	}
 }
 
 // TokenLiteral implements Expr.
@@ -44,12 +64,23 @@ func (e ExprInvocation) Expression() string {
 	out.WriteString("(")
 	for i, arg := range e.Arguments {
 		out.WriteString(arg.Expression())
+		if e.Spread && i+1 == len(e.Arguments) {
+			out.WriteString("...")
+		}
 
-		if i+1 < len(e.Arguments) {
+		if i+1 < len(e.Arguments)+len(e.NamedArguments) {
+			out.WriteString(", ")
+		}
+	}
+	for i, arg := range e.NamedArguments {
+		out.WriteString(arg.Name.Value)
+		out.WriteString(": ")
+		out.WriteString(arg.Value.Expression())
+
+		if i+1 < len(e.NamedArguments) {
 			out.WriteString(", ")
 		}
 	}
-	out.WriteString(e.Function.Expression())
 	out.WriteString(")")
 
 	return out.String()
@@ -12,6 +12,9 @@ type ExprMemberAccess struct {
 	Token    token.Token
 	Target   Expr
 	Property Identifier
+
+	// Optional accesses short-circuit to null when the target is null.
+	Optional bool
 }
 
 func MakeExprMemberAccess(tok token.Token, target Expr, prop Identifier) *ExprMemberAccess {
@@ -40,7 +43,11 @@ func (e ExprMemberAccess) Expression() string {
 	var out bytes.Buffer
 
 	out.WriteString(e.Target.Expression())
-	out.WriteString(".")
+	if e.Optional {
+		out.WriteString("?.")
+	} else {
+		out.WriteString(".")
+	}
 	out.WriteString(e.Property.Value)
 
 	return out.String()
@@ -0,0 +1,38 @@
+package ast
+
+import (
+	"github.com/vknabel/zirric/token"
+)
+
+var _ Expr = ExprPanic{}
+
+// ExprPanic aborts the current function and unwinds the stack until recovered.
+//
+//	panic("unreachable")
+type ExprPanic struct {
+	Token token.Token
+	Value Expr
+}
+
+func MakeExprPanic(tok token.Token, value Expr) *ExprPanic {
+	return &ExprPanic{
+		Token: tok,
+		Value: value,
+	}
+}
+
+// EnumerateChildNodes implements Expr.
+func (n ExprPanic) EnumerateChildNodes(action func(child Node)) {
+	action(n.Value)
+	n.Value.EnumerateChildNodes(action)
+}
+
+// TokenLiteral implements Expr.
+func (n ExprPanic) TokenLiteral() token.Token {
+	return n.Token
+}
+
+// Expression implements Expr.
+func (e ExprPanic) Expression() string {
+	return "panic(" + e.Value.Expression() + ")"
+}
@@ -0,0 +1,38 @@
+package ast
+
+import (
+	"github.com/vknabel/zirric/token"
+)
+
+var _ Expr = ExprPropagate{}
+
+// ExprPropagate unwraps an `Ok` value or returns an `Err` value from the enclosing function.
+//
+//	parse(input)?
+type ExprPropagate struct {
+	Token token.Token
+	Value Expr
+}
+
+func MakeExprPropagate(tok token.Token, value Expr) *ExprPropagate {
+	return &ExprPropagate{
+		Token: tok,
+		Value: value,
+	}
+}
+
+// EnumerateChildNodes implements Expr.
+func (n ExprPropagate) EnumerateChildNodes(action func(child Node)) {
+	action(n.Value)
+	n.Value.EnumerateChildNodes(action)
+}
+
+// TokenLiteral implements Expr.
+func (n ExprPropagate) TokenLiteral() token.Token {
+	return n.Token
+}
+
+// Expression implements Expr.
+func (e ExprPropagate) Expression() string {
+	return "(" + e.Value.Expression() + "?)"
+}
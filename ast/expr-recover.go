@@ -0,0 +1,36 @@
+package ast
+
+import (
+	"github.com/vknabel/zirric/token"
+)
+
+var _ Expr = ExprRecover{}
+
+// ExprRecover stops the unwinding of a panic and evaluates to its value.
+// Evaluates to null if there is no panic.
+//
+//	defer { let reason = recover() }
+type ExprRecover struct {
+	Token token.Token
+}
+
+func MakeExprRecover(tok token.Token) *ExprRecover {
+	return &ExprRecover{
+		Token: tok,
+	}
+}
+
+// EnumerateChildNodes implements Expr.
+func (ExprRecover) EnumerateChildNodes(func(child Node)) {
+	// No child nodes.
+}
+
+// TokenLiteral implements Expr.
+func (n ExprRecover) TokenLiteral() token.Token {
+	return n.Token
+}
+
+// Expression implements Expr.
+func (e ExprRecover) Expression() string {
+	return "recover()"
+}
@@ -0,0 +1,63 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/vknabel/zirric/token"
+)
+
+var _ Expr = &ExprSwitch{}
+
+// ExprSwitch evaluates to the expression of the first case, that matches the value.
+// It must be exhaustive.
+//
+//	let area = switch shape {
+//	case @Circle:
+//	  circleArea(shape)
+//	case @Square:
+//	  squareArea(shape)
+//	}
+type ExprSwitch struct {
+	Token token.Token
+	Value Expr
+	Cases []SwitchCase
+}
+
+func MakeExprSwitch(t token.Token, value Expr, cases []SwitchCase) *ExprSwitch {
+	return &ExprSwitch{
+		Token: t,
+		Value: value,
+		Cases: cases,
+	}
+}
+
+// EnumerateChildNodes implements Expr.
+func (e *ExprSwitch) EnumerateChildNodes(action func(child Node)) {
+	action(e.Value)
+	e.Value.EnumerateChildNodes(action)
+	for _, c := range e.Cases {
+		action(c)
+		c.EnumerateChildNodes(action)
+	}
+}
+
+// TokenLiteral implements Expr.
+func (e *ExprSwitch) TokenLiteral() token.Token {
+	return e.Token
+}
+
+// Expression implements Expr.
+func (e *ExprSwitch) Expression() string {
+	var out strings.Builder
+	out.WriteString("switch ")
+	out.WriteString(e.Value.Expression())
+	out.WriteString(" {")
+	for _, c := range e.Cases {
+		out.WriteString(" case ")
+		out.WriteString(c.Pattern())
+		out.WriteString(": ")
+		out.WriteString(c.Expr.Expression())
+	}
+	out.WriteString(" }")
+	return out.String()
+}
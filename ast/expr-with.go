@@ -0,0 +1,72 @@
+package ast
+
+import (
+	"bytes"
+
+	"github.com/vknabel/zirric/token"
+)
+
+var _ Expr = ExprWith{}
+
+// ExprWith copies a data value and replaces some of its fields.
+//
+//	person with { age: 31 }
+type ExprWith struct {
+	Token  token.Token
+	Target Expr
+	Fields []ExprWithField
+}
+
+type ExprWithField struct {
+	Name  Identifier
+	Value Expr
+}
+
+func MakeExprWith(tok token.Token, target Expr) *ExprWith {
+	return &ExprWith{
+		Token:  tok,
+		Target: target,
+	}
+}
+
+func (e *ExprWith) AddField(name Identifier, value Expr) {
+	e.Fields = append(e.Fields, ExprWithField{Name: name, Value: value})
+}
+
+// EnumerateChildNodes implements Expr.
+func (n ExprWith) EnumerateChildNodes(action func(child Node)) {
+	action(n.Target)
+	n.Target.EnumerateChildNodes(action)
+
+	for _, field := range n.Fields {
+		action(field.Name)
+		action(field.Value)
+		field.Value.EnumerateChildNodes(action)
+	}
+}
+
+// TokenLiteral implements Expr.
+func (n ExprWith) TokenLiteral() token.Token {
+	return n.Token
+}
+
+// Expression implements Expr.
+func (e ExprWith) Expression() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(e.Target.Expression())
+	out.WriteString(" with { ")
+	for i, field := range e.Fields {
+		out.WriteString(field.Name.Value)
+		out.WriteString(": ")
+		out.WriteString(field.Value.Expression())
+
+		if i+1 < len(e.Fields) {
+			out.WriteString(", ")
+		}
+	}
+	out.WriteString(" })")
+
+	return out.String()
+}
@@ -0,0 +1,36 @@
+package ast
+
+import "github.com/vknabel/zirric/token"
+
+var _ Statement = &StmtDefer{}
+
+// StmtDefer runs its block when the enclosing function returns or panics.
+//
+//	defer { close(file) }
+type StmtDefer struct {
+	Token token.Token
+	Block Block
+}
+
+func MakeStmtDefer(t token.Token, block Block) *StmtDefer {
+	return &StmtDefer{
+		Token: t,
+		Block: block,
+	}
+}
+
+// EnumerateChildNodes implements Statement.
+func (s *StmtDefer) EnumerateChildNodes(action func(child Node)) {
+	for _, n := range s.Block {
+		action(n)
+		n.EnumerateChildNodes(action)
+	}
+}
+
+// TokenLiteral implements Statement.
+func (s *StmtDefer) TokenLiteral() token.Token {
+	return s.Token
+}
+
+// statementNode implements Statement.
+func (s *StmtDefer) statementNode() {}
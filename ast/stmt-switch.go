@@ -0,0 +1,45 @@
+package ast
+
+import "github.com/vknabel/zirric/token"
+
+var _ Statement = &StmtSwitch{}
+
+// StmtSwitch runs the block of the first case, that matches the value.
+//
+//	switch shape {
+//	case @Circle:
+//	  draw(shape)
+//	case _:
+//	  skip()
+//	}
+type StmtSwitch struct {
+	Token token.Token
+	Value Expr
+	Cases []SwitchCase
+}
+
+func MakeStmtSwitch(t token.Token, value Expr, cases []SwitchCase) *StmtSwitch {
+	return &StmtSwitch{
+		Token: t,
+		Value: value,
+		Cases: cases,
+	}
+}
+
+// EnumerateChildNodes implements Statement.
+func (s *StmtSwitch) EnumerateChildNodes(action func(child Node)) {
+	action(s.Value)
+	s.Value.EnumerateChildNodes(action)
+	for _, c := range s.Cases {
+		action(c)
+		c.EnumerateChildNodes(action)
+	}
+}
+
+// TokenLiteral implements Statement.
+func (s *StmtSwitch) TokenLiteral() token.Token {
+	return s.Token
+}
+
+// statementNode implements Statement.
+func (s *StmtSwitch) statementNode() {}
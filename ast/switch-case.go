@@ -0,0 +1,67 @@
+package ast
+
+import "github.com/vknabel/zirric/token"
+
+// SwitchCase is a single case of a switch statement or expression.
+//
+//	case @String:           // matches values of a type or the cases of an enum
+//	case @Has(Annotation):  // matches values of types, that are annotated
+//	case 1:                 // matches equal values
+//	case _:                 // matches all remaining values
+type SwitchCase struct {
+	Token token.Token
+	// The type pattern like `@String` or `@Has(Annotation)`, nil for other cases.
+	Type *DeclAnnotationInstance
+	// The value pattern like `1`, nil for other cases.
+	Value Expr
+	// Whether this is the default case `_`.
+	Default bool
+
+	// The statements of a case within a switch statement.
+	Block Block
+	// The single expression of a case within a switch expression.
+	Expr Expr
+}
+
+// Pattern returns the source representation of the case pattern.
+func (c SwitchCase) Pattern() string {
+	switch {
+	case c.Default:
+		return "_"
+	case c.Type != nil:
+		pattern := "@" + c.Type.Reference.String()
+		if len(c.Type.Arguments) == 1 {
+			pattern += "(" + c.Type.Arguments[0].Expression() + ")"
+		}
+		return pattern
+	case c.Value != nil:
+		return c.Value.Expression()
+	default:
+		return ""
+	}
+}
+
+// EnumerateChildNodes implements Node.
+func (c SwitchCase) EnumerateChildNodes(action func(child Node)) {
+	if c.Type != nil {
+		action(c.Type)
+		c.Type.EnumerateChildNodes(action)
+	}
+	if c.Value != nil {
+		action(c.Value)
+		c.Value.EnumerateChildNodes(action)
+	}
+	for _, n := range c.Block {
+		action(n)
+		n.EnumerateChildNodes(action)
+	}
+	if c.Expr != nil {
+		action(c.Expr)
+		c.Expr.EnumerateChildNodes(action)
+	}
+}
+
+// TokenLiteral implements Node.
+func (c SwitchCase) TokenLiteral() token.Token {
+	return c.Token
+}
@@ -1,8 +1,11 @@
 package ast
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 )
 
@@ -137,6 +140,22 @@ func (st *SymbolTable) Insert(decl Decl) *Symbol {
 	return sym
 }
 
+// OrderedSymbols returns all symbols of the table ordered by their index and name,
+// so declarations are visited in the order they were inserted.
+func (st *SymbolTable) OrderedSymbols() []*Symbol {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	syms := make([]*Symbol, 0, len(st.Symbols))
+	for _, sym := range st.Symbols {
+		syms = append(syms, sym)
+	}
+	slices.SortFunc(syms, func(lhs, rhs *Symbol) int {
+		return cmp.Or(cmp.Compare(lhs.Index, rhs.Index), strings.Compare(lhs.Name, rhs.Name))
+	})
+	return syms
+}
+
 func (st *SymbolTable) addSymbol(symbol Symbol) *Symbol {
 	if symbol.Decl != nil && st.exportScopeLevel >= symbol.Decl.ExportScope() {
 		if st.Parent != nil {
@@ -266,6 +285,40 @@ func (st *SymbolTable) LookupRef(ref StaticReference, requirements ...SymbolRequ
 	)
 }
 
+// Resolve finds the original symbol for name in this or any parent table.
+// Unlike Lookup, it neither records a usage nor captures free symbols.
+func (st *SymbolTable) Resolve(name string) (*Symbol, bool) {
+	for table := st; table != nil; table = table.Parent {
+		table.mu.RLock()
+		sym, ok := table.Symbols[name]
+		table.mu.RUnlock()
+
+		if ok {
+			return sym.Original(), true
+		}
+	}
+	return nil, false
+}
+
+// Use records a usage of name on its declaration in this or any parent table.
+// Unlike LookupIdentifier, it neither captures free symbols nor adds unresolved ones.
+// Reports false if name is not declared.
+func (st *SymbolTable) Use(name Identifier) (*Symbol, bool) {
+	for table := st; table != nil; table = table.Parent {
+		table.mu.RLock()
+		sym, ok := table.Symbols[name.Value]
+		table.mu.RUnlock()
+
+		if !ok || sym.Original().Decl == nil {
+			continue
+		}
+		sym = sym.Original()
+		sym.Usages = append(sym.Usages, SymbolUsage{Node: name})
+		return sym, true
+	}
+	return nil, false
+}
+
 func (st *SymbolTable) NextAnonymousFunctionName() string {
 	st.mu.Lock()
 	defer st.mu.Unlock()
@@ -0,0 +1,235 @@
+package compiler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/runtime"
+)
+
+// artifactMagic starts every serialized module artifact.
+var artifactMagic = [4]byte{'Z', 'I', 'R', 'M'}
+
+// ModuleArtifact is everything, that compiling a single module added to the bytecode:
+// its constants, globals, contracts and the instructions initializing the module.
+// As they refer to each other by their ids, an artifact can only be restored
+// behind exactly the modules, that preceded it when it was compiled.
+type ModuleArtifact struct {
+	// The dotted name of the compiled module.
+	Name string
+
+	// The added parts of the bytecode.
+	// The source map is relative to the start of the added instructions.
+	added Bytecode
+	// The size of the bytecode before the module was compiled.
+	offsets artifactOffsets
+
+	// The ids of the declarations of the module by name.
+	constantIds map[string]int
+	globalIds   map[string]int
+	// The constant id of the module value.
+	moduleId int
+
+	// Decoded module values, whose members are filled once restored.
+	modules []decodedModule
+}
+
+// artifactOffsets counts the parts of the bytecode, that are extended by modules.
+type artifactOffsets struct {
+	instructions, locals, constants, globals, contracts int
+}
+
+func (c *Compiler) offsets() artifactOffsets {
+	main := c.scopes[c.scopeIdx]
+	return artifactOffsets{
+		instructions: len(main.Instructions),
+		locals:       len(main.locals),
+		constants:    len(c.constants),
+		globals:      len(c.globals),
+		contracts:    len(c.contracts),
+	}
+}
+
+// next returns the offsets behind the artifact.
+func (a *ModuleArtifact) next() artifactOffsets {
+	return artifactOffsets{
+		instructions: a.offsets.instructions + len(a.added.Instructions),
+		locals:       a.offsets.locals + len(a.added.LocalNames),
+		constants:    a.offsets.constants + len(a.added.Constants),
+		globals:      a.offsets.globals + len(a.added.Globals),
+		contracts:    a.offsets.contracts + len(a.added.Contracts),
+	}
+}
+
+// CompileModule compiles a declared module like Compile
+// and returns everything it added as an artifact, that can be restored instead of compiling it again.
+func (c *Compiler) CompileModule(name string) (*ModuleArtifact, error) {
+	module, ok := c.modules[name]
+	if !ok {
+		return nil, fmt.Errorf("module %s is not declared", name)
+	}
+	before := c.offsets()
+	err := c.Compile(module)
+	if err != nil {
+		return nil, err
+	}
+
+	main := c.scopes[c.scopeIdx]
+	a := &ModuleArtifact{
+		Name: name,
+		added: Bytecode{
+			Instructions: slices.Clone(main.Instructions[before.instructions:]),
+			LocalNames:   main.localNames()[before.locals:],
+			Constants:    slices.Clone(c.constants[before.constants:]),
+			Globals:      slices.Clone(c.globals[before.globals:]),
+			Result:       c.result,
+			Contracts:    slices.Clone(c.contracts[before.contracts:]),
+		},
+		offsets:     before,
+		constantIds: make(map[string]int),
+		globalIds:   make(map[string]int),
+		moduleId:    c.moduleValue(module.Symbols),
+	}
+	for _, m := range main.sourceMap {
+		if m.Offset >= before.instructions {
+			m.Offset -= before.instructions
+			a.added.SourceMap = append(a.added.SourceMap, m)
+		}
+	}
+	for name, sym := range module.Symbols.Symbols {
+		if sym.Original() != sym {
+			continue
+		}
+		if sym.ConstantId != nil {
+			a.constantIds[name] = *sym.ConstantId
+		}
+		if sym.GlobalId != nil {
+			a.globalIds[name] = *sym.GlobalId
+		}
+	}
+	return a, nil
+}
+
+// Restore appends the artifacts of modules in their order instead of compiling them again.
+// Fails without restoring anything, unless each artifact continues exactly where it was compiled.
+// Modules, that are already declared, receive the ids of their declarations,
+// so the following modules can still be compiled.
+// Warnings of restored modules are not reported again.
+func (c *Compiler) Restore(artifacts ...*ModuleArtifact) error {
+	next := c.offsets()
+	for _, a := range artifacts {
+		if a.offsets != next {
+			return fmt.Errorf("module %s was compiled behind other modules", a.Name)
+		}
+		next = a.next()
+		for _, m := range a.modules {
+			for member, id := range m.members {
+				if id >= next.constants {
+					return fmt.Errorf("module %s: member %s refers to unknown constant %d", m.module.Name, member, id)
+				}
+			}
+		}
+	}
+
+	for _, a := range artifacts {
+		main := c.scopes[c.scopeIdx]
+		for _, m := range a.added.SourceMap {
+			m.Offset += len(main.Instructions)
+			main.sourceMap = main.sourceMap.Add(m)
+		}
+		main.Instructions = append(main.Instructions, a.added.Instructions...)
+		for _, name := range a.added.LocalNames {
+			main.locals = append(main.locals, &ast.Symbol{Name: name})
+		}
+		for _, v := range a.added.Constants {
+			id := len(c.constants)
+			c.constants = append(c.constants, v)
+			if key, ok := internKey(v); ok {
+				if _, ok := c.interned[key]; !ok {
+					c.interned[key] = id
+				}
+			}
+		}
+		c.globals = append(c.globals, a.added.Globals...)
+		c.contracts = append(c.contracts, a.added.Contracts...)
+		if a.added.Result != nil {
+			c.result = a.added.Result
+		}
+		// all ids have been checked before
+		_ = fillModules(a.modules, c.constants)
+
+		if module, ok := c.modules[a.Name]; ok {
+			c.restoreIds(module, a)
+		}
+	}
+	return nil
+}
+
+// restoreIds assigns the ids of a restored module to its declarations.
+func (c *Compiler) restoreIds(module *ast.ContextModule, a *ModuleArtifact) {
+	for name, id := range a.constantIds {
+		if sym, ok := module.Symbols.Symbols[name]; ok {
+			sym.ConstantId = &id
+		}
+	}
+	for name, id := range a.globalIds {
+		if sym, ok := module.Symbols.Symbols[name]; ok {
+			sym.GlobalId = &id
+		}
+	}
+	if c.moduleValues == nil {
+		c.moduleValues = make(map[*ast.SymbolTable]int)
+	}
+	c.moduleValues[module.Symbols] = a.moduleId
+}
+
+// Encode serializes the artifact into the `.zirrm` format, that extends the format of `.zirrc` files
+// by the offsets and ids of the module.
+func (a *ModuleArtifact) Encode(w io.Writer) error {
+	enc := newEncoder(w, a.offsets.constants, a.added.Constants)
+	enc.header(artifactMagic)
+	enc.string(a.Name)
+	enc.uint(a.offsets.instructions)
+	enc.uint(a.offsets.locals)
+	enc.uint(a.offsets.constants)
+	enc.uint(a.offsets.globals)
+	enc.uint(a.offsets.contracts)
+	enc.bytecode(&a.added)
+	enc.ints(a.constantIds)
+	enc.ints(a.globalIds)
+	enc.uint(a.moduleId)
+	if enc.err != nil {
+		return enc.err
+	}
+	return enc.w.Flush()
+}
+
+// DecodeModuleArtifact reads an artifact written by Encode.
+// Extern functions are bound by the given plugins.
+func DecodeModuleArtifact(r io.Reader, plugins *runtime.ExternPluginRegistry) (*ModuleArtifact, error) {
+	dec := &decoder{r: bufio.NewReader(r), plugins: plugins}
+	err := dec.header(artifactMagic)
+	if err != nil {
+		return nil, err
+	}
+	a := &ModuleArtifact{Name: dec.string()}
+	a.offsets = artifactOffsets{
+		instructions: dec.uint(),
+		locals:       dec.uint(),
+		constants:    dec.uint(),
+		globals:      dec.uint(),
+		contracts:    dec.uint(),
+	}
+	a.added = *dec.bytecode()
+	a.constantIds = dec.ints()
+	a.globalIds = dec.ints()
+	a.moduleId = dec.uint()
+	a.modules = dec.modules
+	if dec.err != nil {
+		return nil, fmt.Errorf("invalid module artifact: %w", dec.err)
+	}
+	return a, nil
+}
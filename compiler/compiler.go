@@ -1,11 +1,14 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
-	"math"
+	"slices"
+	"strings"
 
 	"github.com/vknabel/zirric/ast"
 	"github.com/vknabel/zirric/op"
+	"github.com/vknabel/zirric/resolve"
 	"github.com/vknabel/zirric/runtime"
 	"github.com/vknabel/zirric/token"
 )
@@ -13,13 +16,28 @@ import (
 const (
 	// A temporary address that acts placeholder.
 	// Should be replaced by the actual address once known.
-	placeholderJumpAddress = math.MinInt
+	// It fits into narrow operands, so replacing it never moves other instructions.
+	placeholderJumpAddress = op.MaxNarrowOperand
 )
 
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.ContextModule:
+		err := c.resolveNames(node)
+		if err != nil {
+			return err
+		}
+		err = c.typeCheck(node)
+		if err != nil {
+			return err
+		}
 		c.enterScope(node.Symbols)
+		c.scopes[c.scopeIdx].topLevel = true
+
+		err = c.compileDeclarations(node.Symbols)
+		if err != nil {
+			return err
+		}
 
 		for _, src := range node.Files {
 			err := c.Compile(src)
@@ -28,42 +46,51 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
-		c.leaveScope()
+		files := make([]*ast.SymbolTable, len(node.Files))
+		for i, src := range node.Files {
+			files[i] = src.Symbols
+		}
+		c.exportModule(node.Symbols, files)
 
-		return nil
-	case *ast.SourceFile:
-		c.enterScope(node.Symbols)
+		scope := c.leaveScope()
 
-		for _, sym := range node.Symbols.Symbols {
-			err := c.reserveSymbol(sym)
+		// modules are initialized in the order they are compiled
+		c.appendScope(scope)
+		return c.err
+	case *ast.SourceFile:
+		if c.scopeIdx == 0 {
+			// files of modules are already resolved
+			err := c.resolveNames(node)
 			if err != nil {
 				return err
 			}
-		}
-
-		for _, sym := range node.Symbols.Symbols {
-			err := c.compileSymbol(sym)
+			err = c.typeCheck(node)
 			if err != nil {
 				return err
 			}
 		}
+		c.enterScope(node.Symbols)
+		c.scopes[c.scopeIdx].topLevel = true
 
-		for _, stmt := range node.Statements {
-			err := c.Compile(stmt)
-			if err != nil {
-				return err
-			}
+		err := c.compileDeclarations(node.Symbols)
+		if err != nil {
+			return err
+		}
+
+		err = c.compileBlock(node.Statements)
+		if err != nil {
+			return err
+		}
+		if _, ok := c.moduleValues[node.Symbols]; ok && node.Symbols.Parent == nil {
+			// a single file referencing its own module
+			c.exportModule(node.Symbols, []*ast.SymbolTable{node.Symbols})
 		}
 
 		scope := c.leaveScope()
 
 		// at its core this is fine, but shouldn't this be at the module level?
-		c.scopes[c.scopeIdx].Instructions = append(
-			c.scopes[c.scopeIdx].Instructions,
-			scope.Instructions...,
-		)
-
-		return nil
+		c.appendScope(scope)
+		return c.err
 
 	case *ast.DeclVariable, *ast.DeclFunc:
 		sym := c.scopes[c.scopeIdx].symbols.Insert(node.(ast.Decl))
@@ -78,9 +105,13 @@ func (c *Compiler) Compile(node ast.Node) error {
 		return nil
 	case ast.StmtIf:
 		return c.compileStmtIf(node)
+	case *ast.StmtSwitch:
+		return c.compileSwitch(node.Value, node.Cases, false, false)
+	case *ast.ExprSwitch:
+		return c.compileSwitch(node.Value, node.Cases, true, false)
 
 	case ast.ExprIf:
-		return c.compileExprIf(node)
+		return c.compileExprIf(node, false)
 	case *ast.ExprOperatorUnary:
 		return c.compileExprOperatorUnary(node)
 	case *ast.ExprOperatorBinary:
@@ -95,6 +126,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.ExprNull:
 		c.emit(op.ConstNull)
 		return nil
+	case *ast.ExprInvalid:
+		return fmt.Errorf("invalid expression %q", node.Token.Literal)
 	case *ast.ExprInt:
 		val := c.plugins.Prelude().Int(node.Literal)
 		idx := c.addConstant(val)
@@ -123,10 +156,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 		}
-		val := c.plugins.Prelude().Int(int64(len(node.Elements)))
-		idx := c.addConstant(val)
-		c.emit(op.Const, idx)
-		c.emit(op.Array)
+		c.emit(op.Array, len(node.Elements))
 		return nil
 
 	case *ast.ExprDict:
@@ -140,10 +170,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 		}
-		val := c.plugins.Prelude().Int(int64(len(node.Entries)))
-		idx := c.addConstant(val)
-		c.emit(op.Const, idx)
-		c.emit(op.Dict)
+		c.emit(op.Dict, len(node.Entries))
 		return nil
 	case *ast.ExprIdentifier:
 		symbol := c.scopes[c.scopeIdx].symbols.LookupIdentifier(node.Name)
@@ -151,7 +178,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return fmt.Errorf("undefined identifier %q", node.Name)
 		}
 		switch symbol.Decl.(type) {
-		case *ast.DeclFunc, *ast.DeclData, *ast.DeclEnum, *ast.DeclExternFunc, *ast.DeclAnnotation:
+		case *ast.DeclFunc, *ast.DeclData, *ast.DeclEnum, *ast.DeclExternFunc, *ast.DeclAnnotation, *ast.DeclModule:
 			sym := symbol.Original()
 			if sym.ConstantId == nil {
 				return fmt.Errorf("identifier %q has no constant id", node.Name)
@@ -177,61 +204,65 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(op.GetLocal, *symbol.LocalId)
 			return nil
 
+		case *ast.DeclImportMember:
+			member := symbol.Decl.(*ast.DeclImportMember)
+			return c.compileModuleMember(member.ModuleName, member.Name)
+
+		case *ast.DeclImport:
+			module, err := c.importedModuleTable(symbol.Decl.(*ast.DeclImport))
+			if err != nil {
+				return err
+			}
+			c.emit(op.Const, c.moduleValue(module))
+			return nil
+
 		default:
 			return fmt.Errorf("identifier %q has unknown declaration type %T", node.Name, symbol.Decl)
 		}
 
 	case *ast.ExprMemberAccess:
-		err := c.Compile(node.Target)
-		if err != nil {
-			return err
-		}
-		c.emit(op.GetField, c.addConstant(c.plugins.Prelude().String(node.Property.Value)))
-		return nil
-
+		return c.compileAccessChain(node)
 	case *ast.ExprIndexAccess:
-		err := c.Compile(node.Target)
-		if err != nil {
-			return err
-		}
-		err = c.Compile(node.IndexExpr)
-		if err != nil {
-			return err
-		}
-		c.emit(op.GetIndex)
-		return nil
+		return c.compileAccessChain(node)
+	case *ast.ExprWith:
+		return c.compileExprWith(node)
 
 	case *ast.ExprInvocation:
-		for i := 0; i < len(node.Arguments); i++ {
-			// compile arguments in left-to-right order
-			// so they are pushed onto the stack in that order
-			// and can be popped off in reverse order by the callee
-			// (first argument is on the bottom of the stack)
-			err := c.Compile(node.Arguments[i])
-			if err != nil {
-				return err
-			}
-		}
-		err := c.Compile(node.Function)
+		return c.compileAccessChain(node)
+
+	case *ast.ExprPropagate:
+		return c.compileExprPropagate(node)
+
+	case *ast.StmtDefer:
+		return c.compileStmtDefer(node)
+	case *ast.ExprPanic:
+		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
-
-		c.emit(op.Call, len(node.Arguments))
+		c.emit(op.Panic)
+		return nil
+	case *ast.ExprRecover:
+		if c.scopes[c.scopeIdx].deferDepth == 0 {
+			return fmt.Errorf("recover() can only be used inside defer blocks")
+		}
+		c.emit(op.Recover)
 		return nil
 
 	case *ast.StmtReturn:
 		if node.Expr == nil {
 			c.emit(op.ConstNull)
+			c.emitReturnContract()
 			c.emit(op.Return)
 			return nil
 		}
 
-		err := c.Compile(node.Expr)
+		err := c.compileReturned(node.Expr)
 		if err != nil {
 			return err
 		}
 
+		c.emitReturnContract()
 		c.emit(op.Return)
 		return nil
 
@@ -240,6 +271,35 @@ func (c *Compiler) Compile(node ast.Node) error {
 	}
 }
 
+// compileDeclarations reserves all declarations of a table before compiling them,
+// so they may reference each other.
+func (c *Compiler) compileDeclarations(table *ast.SymbolTable) error {
+	for _, sym := range table.OrderedSymbols() {
+		if sym.Decl == nil || sym.Original() != sym {
+			// unresolved references like annotations or captured symbols
+			continue
+		}
+		err := c.reserveSymbol(sym)
+		if err != nil {
+			return err
+		}
+	}
+	if c.result == nil {
+		c.result, _ = c.resultTypes()
+	}
+
+	for _, sym := range table.OrderedSymbols() {
+		if sym.Decl == nil || sym.Original() != sym {
+			continue
+		}
+		err := c.compileSymbol(sym)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *Compiler) reserveSymbol(sym *ast.Symbol) error {
 	switch decl := sym.Decl.(type) {
 	case *ast.DeclFunc:
@@ -280,12 +340,25 @@ func (c *Compiler) reserveSymbol(sym *ast.Symbol) error {
 		sym.ConstantId = &id
 		return nil
 
+	case *ast.DeclImport, *ast.DeclImportMember, *ast.DeclModule:
+		return c.reserveImport(sym)
+
 	default:
 		return fmt.Errorf("unknown declaration %T", decl)
 	}
 }
 
+// changeOperand replaces the placeholder address of a jump.
+// Addresses, that don't fit into the placeholder, are kept aside and patched when leaving the scope.
 func (c *Compiler) changeOperand(pos int, operand int) {
+	if operand > op.MaxNarrowOperand {
+		scope := c.scopes[c.scopeIdx]
+		if scope.farJumps == nil {
+			scope.farJumps = make(map[int]int)
+		}
+		scope.farJumps[pos] = operand
+		return
+	}
 	opcode := op.Opcode(c.currentInstructions()[pos])
 	patched := op.Make(opcode, operand)
 	c.replaceInstruction(pos, patched)
@@ -299,6 +372,7 @@ func (c *Compiler) replaceInstruction(pos int, patched []byte) {
 
 func (c *Compiler) compileBlock(block ast.Block) error {
 	for _, stmt := range block {
+		c.mapSource(stmt.TokenLiteral())
 		err := c.Compile(stmt)
 		if err != nil {
 			return err
@@ -307,6 +381,35 @@ func (c *Compiler) compileBlock(block ast.Block) error {
 	return nil
 }
 
+// endsWithReturn reports whether the last statement of a block is a return.
+func endsWithReturn(block ast.Block) bool {
+	if len(block) == 0 {
+		return false
+	}
+	_, ok := block[len(block)-1].(*ast.StmtReturn)
+	return ok
+}
+
+// compileStmtDefer compiles a deferred block in place and skips it.
+// The vm runs registered blocks in reverse order when the frame returns or unwinds.
+func (c *Compiler) compileStmtDefer(node *ast.StmtDefer) error {
+	if !c.inFunction() {
+		return fmt.Errorf("defer can only be used inside functions")
+	}
+	skip := c.emit(op.Defer, placeholderJumpAddress)
+
+	c.scopes[c.scopeIdx].deferDepth++
+	err := c.compileBlock(node.Block)
+	c.scopes[c.scopeIdx].deferDepth--
+	if err != nil {
+		return err
+	}
+	c.emit(op.EndDefer)
+
+	c.changeOperand(skip, len(c.currentInstructions()))
+	return nil
+}
+
 func (c *Compiler) compileStmtIf(node ast.StmtIf) error {
 	var (
 		jumpNext int
@@ -350,13 +453,9 @@ func (c *Compiler) compileStmtIf(node ast.StmtIf) error {
 			return err
 		}
 	} else {
-		lastIndex := len(jumpEnds) - 1
-
-		if c.isLastInstruction(op.Pop) {
-			c.removeLastInstruction()
-		}
-
-		jumpEnds[lastIndex] = jumpNext
+		// without an else block, the last branch falls through to the end
+		c.removeLastInstruction()
+		jumpEnds[len(jumpEnds)-1] = jumpNext
 	}
 
 	endPos = len(c.currentInstructions())
@@ -366,24 +465,40 @@ func (c *Compiler) compileStmtIf(node ast.StmtIf) error {
 	return nil
 }
 
-func (c *Compiler) compileExprIf(node ast.ExprIf) error {
+// compileExprIf compiles an if expression.
+// In tail position, each branch returns on its own, so calls in all branches are tail calls.
+// The last branch falls through to the return of the enclosing statement.
+func (c *Compiler) compileExprIf(node ast.ExprIf, tail bool) error {
 	var (
 		jumpNext int
 		jumpEnds = make([]int, 0, 1+len(node.ElseIf))
 		endPos   int
 	)
+	compileBranch := func(expr ast.Expr) error {
+		if tail {
+			return c.compileReturned(expr)
+		}
+		return c.Compile(expr)
+	}
+	leaveBranch := func() {
+		if tail {
+			c.emit(op.Return)
+			return
+		}
+		jumpEnds = append(jumpEnds, c.emit(op.Jump, placeholderJumpAddress))
+	}
+
 	err := c.Compile(node.Condition)
 	if err != nil {
 		return err
 	}
 	jumpNext = c.emit(op.JumpFalse, placeholderJumpAddress)
 
-	err = c.Compile(node.ThenExpr)
+	err = compileBranch(node.ThenExpr)
 	if err != nil {
 		return err
 	}
-
-	jumpEnds = append(jumpEnds, c.emit(op.Jump, placeholderJumpAddress))
+	leaveBranch()
 
 	for _, elseIf := range node.ElseIf {
 		c.changeOperand(jumpNext, len(c.currentInstructions()))
@@ -394,15 +509,15 @@ func (c *Compiler) compileExprIf(node ast.ExprIf) error {
 		}
 		jumpNext = c.emit(op.JumpFalse, placeholderJumpAddress)
 
-		err = c.Compile(elseIf.Then)
+		err = compileBranch(elseIf.Then)
 		if err != nil {
 			return err
 		}
-		jumpEnds = append(jumpEnds, c.emit(op.Jump, placeholderJumpAddress))
+		leaveBranch()
 	}
 	c.changeOperand(jumpNext, len(c.currentInstructions()))
 
-	err = c.Compile(node.ElseExpr)
+	err = compileBranch(node.ElseExpr)
 	if err != nil {
 		return err
 	}
@@ -414,6 +529,502 @@ func (c *Compiler) compileExprIf(node ast.ExprIf) error {
 	return nil
 }
 
+// tailCalls maps each call to its variant in tail position.
+var tailCalls = map[op.Opcode]op.Opcode{
+	op.Call:       op.TailCall,
+	op.CallSpread: op.TailCallSpread,
+	op.CallNamed:  op.TailCallNamed,
+}
+
+// compileReturned compiles the value of a return statement.
+// Calls in tail position reuse the frame of the returning function,
+// unless the frame still needs to check the returned value or is a deferred block.
+func (c *Compiler) compileReturned(expr ast.Expr) error {
+	scope := c.scopes[c.scopeIdx]
+	if !c.inFunction() || scope.returnContract != nil || scope.deferDepth > 0 {
+		return c.Compile(expr)
+	}
+
+	switch expr := expr.(type) {
+	case ast.ExprIf:
+		return c.compileExprIf(expr, true)
+	case *ast.ExprSwitch:
+		return c.compileSwitch(expr.Value, expr.Cases, true, true)
+	case *ast.ExprInvocation:
+		err := c.compileAccessChain(expr)
+		if err != nil {
+			return err
+		}
+		if !c.isLastInstruction(op.Call, op.CallSpread, op.CallNamed) {
+			return nil
+		}
+		call, err := op.Decode(c.currentInstructions()[scope.lastInstruction.Position:])
+		if err != nil {
+			return err
+		}
+		c.removeLastInstruction()
+		c.emit(tailCalls[call.Opcode], call.Operands...)
+		return nil
+	default:
+		return c.Compile(expr)
+	}
+}
+
+// accessChain collects the null checks of the optional accesses within a chain.
+type accessChain struct {
+	// the arguments of enclosing invocations, that have already been pushed
+	pending   int
+	nullJumps []nullJump
+}
+
+// nullJump skips the remaining chain and drops the pending arguments.
+type nullJump struct {
+	pos     int
+	pending int
+}
+
+// compileAccessChain compiles a chain of member and index accesses and invocations like `a?.b.c[0]` or `a?.b().c`.
+// When the target of an optional access is null, the remaining chain including all invocations is skipped
+// and null is left on the stack.
+// Arguments are evaluated before their callee, so those of skipped invocations have already been evaluated.
+func (c *Compiler) compileAccessChain(node ast.Expr) error {
+	var chain accessChain
+	err := c.compileAccess(node, &chain)
+	if err != nil {
+		return err
+	}
+
+	var jumpEnds []int
+	for _, jump := range chain.nullJumps {
+		if jump.pending == 0 {
+			continue
+		}
+		if len(jumpEnds) == 0 {
+			// skip the following pads, when the chain completes
+			jumpEnds = append(jumpEnds, c.emit(op.Jump, placeholderJumpAddress))
+		}
+		// drop the null and the pending arguments below
+		c.changeOperand(jump.pos, len(c.currentInstructions()))
+		for i := 0; i <= jump.pending; i++ {
+			c.emit(op.Pop)
+		}
+		c.emit(op.ConstNull)
+		jumpEnds = append(jumpEnds, c.emit(op.Jump, placeholderJumpAddress))
+	}
+
+	endPos := len(c.currentInstructions())
+	for _, jump := range chain.nullJumps {
+		if jump.pending == 0 {
+			c.changeOperand(jump.pos, endPos)
+		}
+	}
+	for _, pos := range jumpEnds {
+		c.changeOperand(pos, endPos)
+	}
+	return nil
+}
+
+func (c *Compiler) compileAccess(node ast.Expr, chain *accessChain) error {
+	switch node := node.(type) {
+	case *ast.ExprMemberAccess:
+		if module, ok := c.importedModule(node.Target); ok {
+			return c.compileModuleMember(module, node.Property)
+		}
+		err := c.compileAccess(node.Target, chain)
+		if err != nil {
+			return err
+		}
+		if node.Optional {
+			chain.nullJumps = append(chain.nullJumps, nullJump{pos: c.emitJumpNull(), pending: chain.pending})
+		}
+		c.emit(op.GetField, c.addConstant(c.plugins.Prelude().String(node.Property.Value)))
+		return nil
+
+	case *ast.ExprIndexAccess:
+		err := c.compileAccess(node.Target, chain)
+		if err != nil {
+			return err
+		}
+		if node.Optional {
+			chain.nullJumps = append(chain.nullJumps, nullJump{pos: c.emitJumpNull(), pending: chain.pending})
+		}
+		err = c.Compile(node.IndexExpr)
+		if err != nil {
+			return err
+		}
+		c.emit(op.GetIndex)
+		return nil
+
+	case *ast.ExprInvocation:
+		return c.compileExprInvocation(node, chain)
+
+	default:
+		return c.Compile(node)
+	}
+}
+
+// emitJumpNull emits a jump, that is taken when the top value is null.
+// The top value is kept in both cases.
+func (c *Compiler) emitJumpNull() int {
+	c.emit(op.Dup)
+	c.emit(op.ConstNull)
+	c.emit(op.Equal)
+	return c.emit(op.JumpTrue, placeholderJumpAddress)
+}
+
+// emitJumpNotNull emits a jump, that is taken when the top value is not null.
+// The top value is kept in both cases.
+func (c *Compiler) emitJumpNotNull() int {
+	c.emit(op.Dup)
+	c.emit(op.ConstNull)
+	c.emit(op.NotEqual)
+	return c.emit(op.JumpTrue, placeholderJumpAddress)
+}
+
+// compileExprInvocation compiles an invocation within an access chain.
+// The arguments are pushed before the callee.
+func (c *Compiler) compileExprInvocation(node *ast.ExprInvocation, chain *accessChain) error {
+	params, ok, err := c.staticParameters(node.Function)
+	if err != nil {
+		return err
+	}
+	variadic := len(params) > 0 && params[len(params)-1].Variadic
+	if ok && !node.Spread && (variadic || len(node.NamedArguments) > 0 || len(node.Arguments) < len(params)) {
+		return c.compileBoundInvocation(node, params)
+	}
+
+	for i := 0; i < len(node.Arguments); i++ {
+		// compile arguments in left-to-right order
+		// so they are pushed onto the stack in that order
+		// and can be popped off in reverse order by the callee
+		// (first argument is on the bottom of the stack)
+		err := c.Compile(node.Arguments[i])
+		if err != nil {
+			return err
+		}
+	}
+	names := make(runtime.Array, len(node.NamedArguments))
+	for i, arg := range node.NamedArguments {
+		err := c.Compile(arg.Value)
+		if err != nil {
+			return err
+		}
+		names[i] = c.plugins.Prelude().String(arg.Name.Value)
+	}
+
+	argCount := len(node.Arguments) + len(node.NamedArguments)
+	// optional accesses of the callee skip this invocation, too
+	chain.pending += argCount
+	err = c.compileAccess(node.Function, chain)
+	chain.pending -= argCount
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case node.Spread:
+		// the parser rejects named arguments after a spread argument
+		c.emit(op.CallSpread, argCount)
+	case len(names) == 0:
+		c.emit(op.Call, argCount)
+	default:
+		// the callee is only known at runtime, which binds the names
+		c.emit(op.CallNamed, argCount, c.addConstant(names))
+	}
+	return nil
+}
+
+// compileBoundInvocation compiles an invocation of a statically known callee.
+// Named arguments are moved to their parameter position and omitted arguments are replaced by their defaults.
+// Excess positional arguments of variadic callees are collected by the vm.
+// Arguments are evaluated in source order.
+// Named arguments, that are out of parameter order, are evaluated into temporaries first.
+func (c *Compiler) compileBoundInvocation(node *ast.ExprInvocation, params []runtime.Parameter) error {
+	callee := node.Function.Expression()
+	fixed := len(params)
+	variadic := fixed > 0 && params[fixed-1].Variadic
+	if variadic {
+		fixed--
+	}
+	if len(node.Arguments) > fixed && !variadic {
+		return fmt.Errorf("wrong number of arguments for %s: want=%d, got=%d", callee, len(params), len(node.Arguments)+len(node.NamedArguments))
+	}
+
+	args := make([]ast.Expr, len(params))
+	copy(args[:fixed], node.Arguments)
+	var rest []ast.Expr
+	if variadic && len(node.Arguments) > fixed {
+		rest = node.Arguments[fixed:]
+	}
+
+	// the parameters of named arguments, that aren't literals, in source order
+	var named []int
+	reordered := false
+	for _, arg := range node.NamedArguments {
+		idx := -1
+		for i, p := range params {
+			if p.Name == arg.Name.Value {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("%s has no parameter %q", callee, arg.Name.Value)
+		}
+		if args[idx] != nil || (params[idx].Variadic && rest != nil) {
+			return fmt.Errorf("argument %q for %s passed more than once", arg.Name.Value, callee)
+		}
+		args[idx] = arg.Value
+		if _, ok := c.literalValue(arg.Value); !ok {
+			reordered = reordered || (len(named) > 0 && idx < named[len(named)-1])
+			named = append(named, idx)
+		}
+	}
+
+	// reordered named arguments are evaluated into temporaries by their parameter,
+	// right after the positional arguments, literals are pushed in place
+	var temporaries map[int]int
+	argCount := len(params)
+	spread := false
+	for i, arg := range args {
+		if reordered && i == slices.Min(named) {
+			temporaries = make(map[int]int, len(named))
+			for _, idx := range named {
+				err := c.Compile(args[idx])
+				if err != nil {
+					return err
+				}
+				temporaries[idx] = c.addTemporary()
+				c.emit(op.SetLocal, temporaries[idx])
+			}
+		}
+
+		temporary, ok := temporaries[i]
+		switch {
+		case ok:
+			c.emit(op.GetLocal, temporary)
+			// a named variadic argument already is an array
+			spread = spread || params[i].Variadic
+		case params[i].Variadic && arg != nil:
+			// a named variadic argument already is an array
+			spread = true
+			err := c.Compile(arg)
+			if err != nil {
+				return err
+			}
+		case params[i].Variadic:
+			// the vm collects the remaining arguments
+			for _, el := range rest {
+				err := c.Compile(el)
+				if err != nil {
+					return err
+				}
+			}
+			argCount = fixed + len(rest)
+		case arg != nil:
+			err := c.Compile(arg)
+			if err != nil {
+				return err
+			}
+		case params[i].Default != nil:
+			c.emit(op.Const, c.addConstant(params[i].Default))
+		default:
+			return fmt.Errorf("missing argument %q for %s", params[i].Name, callee)
+		}
+	}
+
+	err := c.Compile(node.Function)
+	if err != nil {
+		return err
+	}
+	if spread {
+		c.emit(op.CallSpread, argCount)
+	} else {
+		c.emit(op.Call, argCount)
+	}
+	return nil
+}
+
+// staticParameters returns the parameters of a callee, that is known at compile time.
+func (c *Compiler) staticParameters(fn ast.Expr) ([]runtime.Parameter, bool, error) {
+	ident, ok := fn.(*ast.ExprIdentifier)
+	if !ok {
+		return nil, false, nil
+	}
+	sym, ok := c.resolve(ident.Name.Value)
+	if !ok {
+		return nil, false, nil
+	}
+
+	switch decl := sym.Decl.(type) {
+	case *ast.DeclFunc:
+		params, err := c.parameterList(decl.Impl.Parameters)
+		return params, err == nil, err
+	case *ast.DeclExternFunc:
+		params, err := c.parameterList(decl.Parameters)
+		return params, err == nil, err
+	case *ast.DeclData:
+		params, err := c.fieldParameterList(decl.Fields)
+		return params, err == nil, err
+	default:
+		return nil, false, nil
+	}
+}
+
+func (c *Compiler) parameterList(decls []ast.DeclParameter) ([]runtime.Parameter, error) {
+	params := make([]runtime.Parameter, len(decls))
+	for i, p := range decls {
+		val, err := c.defaultValue(p.Annotations)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %w", p.Name.Value, err)
+		}
+		params[i] = runtime.Parameter{Name: p.Name.Value, Default: val, Variadic: p.Variadic}
+	}
+	return params, nil
+}
+
+func (c *Compiler) fieldParameterList(fields []ast.DeclField) ([]runtime.Parameter, error) {
+	params := make([]runtime.Parameter, len(fields))
+	for i, f := range fields {
+		val, err := c.defaultValue(f.Annotations)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", f.Name.Value, err)
+		}
+		params[i] = runtime.Parameter{Name: f.Name.Value, Default: val}
+	}
+	return params, nil
+}
+
+// defaults extracts the default values of the given parameters.
+func defaults(params []runtime.Parameter) []runtime.RuntimeValue {
+	vals := make([]runtime.RuntimeValue, len(params))
+	for i, p := range params {
+		vals[i] = p.Default
+	}
+	return vals
+}
+
+// defaultValue returns the value of a `@Default(value)` annotation or nil.
+// Defaults must be literals, so they can be shared by all calls.
+func (c *Compiler) defaultValue(annos ast.AnnotationChain) (runtime.RuntimeValue, error) {
+	for _, anno := range annos {
+		if anno.Reference[len(anno.Reference)-1].Value != "Default" {
+			continue
+		}
+		if len(anno.Arguments) != 1 {
+			return nil, fmt.Errorf("@Default requires exactly one value, got %d", len(anno.Arguments))
+		}
+		val, ok := c.literalValue(anno.Arguments[0])
+		if !ok {
+			return nil, fmt.Errorf("@Default value %s must be a literal", anno.Arguments[0].Expression())
+		}
+		return val, nil
+	}
+	return nil, nil
+}
+
+func (c *Compiler) literalValue(expr ast.Expr) (runtime.RuntimeValue, bool) {
+	switch expr := expr.(type) {
+	case *ast.ExprInt:
+		return c.plugins.Prelude().Int(expr.Literal), true
+	case *ast.ExprFloat:
+		return c.plugins.Prelude().Float(expr.Literal), true
+	case *ast.ExprString:
+		return c.plugins.Prelude().String(expr.Literal), true
+	case *ast.ExprChar:
+		return c.plugins.Prelude().Char(expr.Literal), true
+	case *ast.ExprBool:
+		return c.plugins.Prelude().Bool(expr.Literal), true
+	case *ast.ExprNull:
+		return c.plugins.Prelude().Null(), true
+	case *ast.ExprOperatorUnary:
+		if expr.Operator.Type != token.MINUS {
+			return nil, false
+		}
+		switch val, _ := c.literalValue(expr.Expr); val := val.(type) {
+		case runtime.Int:
+			return -val, true
+		case runtime.Float:
+			return -val, true
+		}
+	}
+	return nil, false
+}
+
+// compileExprWith compiles copy-with-update expressions like `person with { age: 31 }`.
+// The target is followed by name and value pairs for each updated field.
+func (c *Compiler) compileExprWith(node *ast.ExprWith) error {
+	err := c.checkWithFields(node)
+	if err != nil {
+		return err
+	}
+	err = c.Compile(node.Target)
+	if err != nil {
+		return err
+	}
+	for _, field := range node.Fields {
+		c.emit(op.Const, c.addConstant(c.plugins.Prelude().String(field.Name.Value)))
+		err := c.Compile(field.Value)
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(op.CopyWith, len(node.Fields))
+	return nil
+}
+
+// checkWithFields verifies that the updated fields exist.
+// If the data type of the target is statically known, it must declare all fields.
+// Otherwise at least one visible data type or one of a declared module must declare all of them,
+// but as the target may still lack them, the fields are reported as unverified.
+func (c *Compiler) checkWithFields(node *ast.ExprWith) error {
+	if decl := c.typeScope().StaticData(node.Target); decl != nil {
+		for _, field := range node.Fields {
+			if !declaresField(decl, field.Name.Value) {
+				return fmt.Errorf("data %s has no field %q", decl.Name.Value, field.Name.Value)
+			}
+		}
+		return nil
+	}
+
+	var tables []*ast.SymbolTable
+	for table := c.scopes[c.scopeIdx].symbols; table != nil; table = table.Parent {
+		tables = append(tables, table)
+	}
+	for _, mod := range c.modules {
+		tables = append(tables, mod.Symbols)
+	}
+	names := make([]string, len(node.Fields))
+	for i, field := range node.Fields {
+		names[i] = field.Name.Value
+	}
+	for _, table := range tables {
+		for _, sym := range table.Symbols {
+			decl, ok := sym.Decl.(*ast.DeclData)
+			if !ok {
+				continue
+			}
+			declaresAll := true
+			for _, field := range node.Fields {
+				declaresAll = declaresAll && declaresField(decl, field.Name.Value)
+			}
+			if declaresAll {
+				return c.warn(node.Token, "unverified fields", "the data type of %s is not known, so it may not have the fields %s", node.Target.Expression(), strings.Join(names, ", "))
+			}
+		}
+	}
+	return fmt.Errorf("no data type has the fields %s", strings.Join(names, ", "))
+}
+
+func declaresField(decl *ast.DeclData, name string) bool {
+	for _, field := range decl.Fields {
+		if field.Name.Value == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Compiler) compileExprOperatorUnary(node *ast.ExprOperatorUnary) error {
 	err := c.Compile(node.Expr)
 	if err != nil {
@@ -467,6 +1078,16 @@ func (c *Compiler) compileExprOperatorBinary(node *ast.ExprOperatorBinary) error
 		c.changeOperand(jumpEnd, len(c.currentInstructions()))
 		return nil
 
+	case token.COALESCE:
+		jumpEnd := c.emitJumpNotNull()
+		c.emit(op.Pop)
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		c.changeOperand(jumpEnd, len(c.currentInstructions()))
+		return nil
+
 	case token.PLUS:
 		err = c.Compile(node.Right)
 		if err != nil {
@@ -557,15 +1178,68 @@ func (c *Compiler) compileSymbol(sym *ast.Symbol) error {
 			return err
 		}
 
+		params, err := c.fieldParameterList(decl.Fields)
+		if err != nil {
+			return err
+		}
+		dt.Defaults = defaults(params)
+		dt.Contracts = c.fieldContracts(decl.Name.Value, decl.Fields)
+
 		c.constants[*sym.ConstantId] = dt
 
 		return nil
 
+	case *ast.DeclExternFunc:
+		impl := c.plugins.Bind(c.scopes[c.scopeIdx].symbols, sym)
+		if impl == nil {
+			return fmt.Errorf("no implementation for extern func %s", decl.Name.Value)
+		}
+		c.constants[*sym.ConstantId] = impl
+
+		return nil
+
+	case *ast.DeclEnum:
+		et, err := runtime.MakeEnumType(sym)
+		if err != nil {
+			return err
+		}
+		for _, cs := range decl.Cases {
+			if caseSym, ok := c.resolve(cs.Case.Name().Value); ok && caseSym.ConstantId != nil {
+				et.Cases = append(et.Cases, runtime.TypeId(*caseSym.ConstantId))
+			}
+		}
+
+		c.constants[*sym.ConstantId] = et
+
+		return nil
+
+	case *ast.DeclAnnotation:
+		at, err := runtime.MakeAnnotationType(sym)
+		if err != nil {
+			return err
+		}
+
+		c.constants[*sym.ConstantId] = at
+
+		return nil
+
+	case *ast.DeclImport, *ast.DeclImportMember, *ast.DeclModule:
+		// bound to the declarations of the imported module
+		// or filled when the module has been compiled
+		return nil
+
 	case *ast.DeclFunc:
 		c.enterScope(decl.Impl.Symbols)
 
-		for _, child := range decl.Impl.Symbols.Symbols {
-			if child.Decl == nil {
+		// parameters occupy the first locals in declaration order
+		for _, param := range decl.Impl.Parameters {
+			err := c.reserveSymbol(decl.Impl.Symbols.Symbols[param.Name.Value])
+			if err != nil {
+				return err
+			}
+		}
+		for _, child := range decl.Impl.Symbols.OrderedSymbols() {
+			if _, ok := child.Decl.(*ast.DeclParameter); child.Decl == nil || ok {
 				continue
 			}
 			err := c.reserveSymbol(child)
@@ -573,24 +1247,54 @@ func (c *Compiler) compileSymbol(sym *ast.Symbol) error {
 				return err
 			}
 		}
+		if ct := c.returnContract(decl.Name.Value, decl.Annotations); ct != nil {
+			id := c.addContract(ct)
+			c.scopes[c.scopeIdx].returnContract = &id
+		}
+		c.emitParameterContracts(decl.Name.Value, decl.Impl.Parameters)
+
 		err := c.compileBlock(decl.Impl.Impl)
 		if err != nil {
 			return err
 		}
+		if !endsWithReturn(decl.Impl.Impl) {
+			// deferred blocks need to run when falling off the end
+			c.emit(op.ConstNull)
+			c.emitReturnContract()
+			c.emit(op.Return)
+		}
 		scope := c.leaveScope()
 
-		c.constants[*sym.ConstantId] = runtime.MakeCompiledFunction(
+		fn := runtime.MakeCompiledFunction(
 			scope.Instructions,
 			len(decl.Impl.Parameters),
 			sym,
 		)
+		params, err := c.parameterList(decl.Impl.Parameters)
+		if err != nil {
+			return err
+		}
+		fn.Defaults = defaults(params)
+		fn.Variadic = len(params) > 0 && params[len(params)-1].Variadic
+		fn.SourceMap = scope.sourceMap
+		fn.LocalNames = scope.localNames()[len(decl.Impl.Parameters):]
+		// including temporaries
+		fn.Locals = max(fn.Locals, len(fn.LocalNames))
+
+		c.constants[*sym.ConstantId] = fn
 
 		return nil
 
 	case *ast.DeclVariable:
 		switch decl.ExportScope() {
 		case ast.ExportScopeInternal, ast.ExportScopePublic:
-			c.enterScope(sym.ChildTable)
+			symbols := sym.ChildTable
+			if symbols == nil {
+				// initializers without own symbols resolve within the declaring scope
+				symbols = c.scopes[c.scopeIdx].symbols
+			}
+			c.enterScope(symbols)
+			c.mapSource(decl.Token)
 
 			err := c.Compile(decl.Value)
 			if err != nil {
@@ -598,6 +1302,7 @@ func (c *Compiler) compileSymbol(sym *ast.Symbol) error {
 			}
 
 			scope := c.leaveScope()
+			scope.Name = sym.Name
 
 			c.globals[*sym.GlobalId] = scope
 
@@ -622,4 +1327,95 @@ func (c *Compiler) compileSymbol(sym *ast.Symbol) error {
 	default:
 		return fmt.Errorf("unknown declaration %T", decl)
 	}
-}
\ No newline at end of file
+}
+
+func (c *Compiler) compileExprPropagate(node *ast.ExprPropagate) error {
+	if !c.inFunction() {
+		return fmt.Errorf("%s: ? can only be used inside functions", node.Expression())
+	}
+	rt, err := c.resultTypes()
+	if err != nil {
+		return err
+	}
+
+	err = c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+	c.emit(op.Propagate, rt.Ok, rt.Err)
+	return nil
+}
+
+// resolveNames reports all undefined names at once, before generating any code.
+// Private names of declared modules also point at their declaration.
+// Warnings are collected separately, unless they are promoted to errors.
+func (c *Compiler) resolveNames(node ast.Node) error {
+	var errs []error
+	for _, diag := range resolve.ResolveWithModules(node, c.lookupModule) {
+		if diag.Severity == resolve.SeverityWarning {
+			if !c.promoteWarnings {
+				c.warnings = append(c.warnings, diag)
+				continue
+			}
+			diag.Severity = resolve.SeverityError
+		}
+		errs = append(errs, diag)
+	}
+	return errors.Join(errs...)
+}
+
+// inFunction reports whether the current scope is inside a function body.
+func (c *Compiler) inFunction() bool {
+	for st := c.scopes[c.scopeIdx].symbols; st != nil; st = st.Parent {
+		if _, ok := st.OpenedBy.(*ast.ExprFunc); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resultTypes resolves the data types `Ok` and `Err` of the enum `Result` and optionally the data type `Error`.
+// If the prelude is declared, its types are used, so declarations named alike don't take over `?`.
+// Otherwise, they are resolved within the current scope.
+// Each data type must have exactly one field.
+func (c *Compiler) resultTypes() (*runtime.ResultTypes, error) {
+	resolve := c.resolve
+	if _, ok := c.modules[PreludeModule]; ok {
+		resolve = c.preludeMember
+	}
+	lookup := func(name string) (int, bool) {
+		sym, ok := resolve(name)
+		if !ok || sym.ConstantId == nil {
+			return -1, false
+		}
+		decl, ok := sym.Decl.(*ast.DeclData)
+		if !ok || len(decl.Fields) != 1 {
+			return -1, false
+		}
+		return *sym.ConstantId, true
+	}
+	hasCase := func(enum *ast.DeclEnum, name string) bool {
+		return slices.ContainsFunc(enum.Cases, func(cs *ast.DeclEnumCase) bool {
+			return len(cs.Case) == 1 && cs.Case[0].Value == name
+		})
+	}
+
+	sym, ok := resolve("Result")
+	if !ok {
+		return nil, fmt.Errorf("? requires an enum Result")
+	}
+	enum, ok := sym.Decl.(*ast.DeclEnum)
+	if !ok || !hasCase(enum, "Ok") || !hasCase(enum, "Err") {
+		return nil, fmt.Errorf("? requires an enum Result with the cases Ok and Err")
+	}
+	okId, ok := lookup("Ok")
+	if !ok {
+		return nil, fmt.Errorf("? requires a data type Ok with one field")
+	}
+	errId, ok := lookup("Err")
+	if !ok {
+		return nil, fmt.Errorf("? requires a data type Err with one field")
+	}
+	errorId, _ := lookup("Error")
+	return &runtime.ResultTypes{Ok: okId, Err: errId, Error: errorId}, nil
+}
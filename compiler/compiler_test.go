@@ -1,6 +1,7 @@
 package compiler_test
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 	"testing"
@@ -460,51 +461,161 @@ func TestArrayExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input:             "[]",
-			expectedConstants: []any{0},
+			expectedConstants: []any{},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.Const, 0),
-				code.Make(code.Array),
+				code.Make(code.Array, 0),
 				code.Make(code.Pop),
 			},
 		},
 		{
 			input:             "[42, 1337]",
-			expectedConstants: []any{42, 1337, 2},
+			expectedConstants: []any{42, 1337},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.Const, 0),
 				code.Make(code.Const, 1),
-				code.Make(code.Const, 2),
-				code.Make(code.Array),
+				code.Make(code.Array, 2),
 				code.Make(code.Pop),
 			},
 		},
 		{
 			input:             "[42 + 1337]",
-			expectedConstants: []any{42, 1337, 1},
+			expectedConstants: []any{42, 1337},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.Const, 0),
 				code.Make(code.Const, 1),
 				code.Make(code.Add),
-				code.Make(code.Const, 2),
-				code.Make(code.Array),
+				code.Make(code.Array, 1),
 				code.Make(code.Pop),
 			},
 		},
 		{
 			label:             "array index",
 			input:             "[1, 2, 3][1]",
-			expectedConstants: []any{1, 2, 3, 3, 1},
+			expectedConstants: []any{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Const, 0),
+				code.Make(code.Const, 1),
+				code.Make(code.Const, 2),
+				code.Make(code.Array, 3),
+				code.Make(code.Const, 0),
+				code.Make(code.GetIndex),
+				code.Make(code.Pop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstantInterning(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			label:             "equal literals",
+			input:             `[1, 1, 1.5, 1.5, 1.0, "a", "a", 'a', 'a']`,
+			expectedConstants: []any{1, 1.5, 1.0, "a", 'a'},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.Const, 0),
+				code.Make(code.Const, 0),
+				code.Make(code.Const, 1),
 				code.Make(code.Const, 1),
 				code.Make(code.Const, 2),
 				code.Make(code.Const, 3),
-				code.Make(code.Array),
+				code.Make(code.Const, 3),
+				code.Make(code.Const, 4),
 				code.Make(code.Const, 4),
+				code.Make(code.Array, 9),
+				code.Make(code.Pop),
+			},
+		},
+		{
+			label:             "field names",
+			input:             `[null?.name, "name"]`,
+			expectedConstants: []any{"name"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.ConstNull),
+				code.Make(code.Dup),
+				code.Make(code.ConstNull),
+				code.Make(code.Equal),
+				code.Make(code.JumpTrue, 10),
+				code.Make(code.GetField, 0),
+				code.Make(code.Const, 0),
+				code.Make(code.Array, 2),
+				code.Make(code.Pop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestNullSafeOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			label:             "null coalescing",
+			input:             "null ?? 1",
+			expectedConstants: []any{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.ConstNull),
+				code.Make(code.Dup),
+				code.Make(code.ConstNull),
+				code.Make(code.NotEqual),
+				code.Make(code.JumpTrue, 11),
+				code.Make(code.Pop),
+				code.Make(code.Const, 0),
+				code.Make(code.Pop),
+			},
+		},
+		{
+			label:             "optional index",
+			input:             "null?[0]",
+			expectedConstants: []any{0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.ConstNull),
+				code.Make(code.Dup),
+				code.Make(code.ConstNull),
+				code.Make(code.Equal),
+				code.Make(code.JumpTrue, 11),
+				code.Make(code.Const, 0),
 				code.Make(code.GetIndex),
 				code.Make(code.Pop),
 			},
 		},
+		{
+			label:             "optional member chain",
+			input:             "null?.a.b",
+			expectedConstants: []any{"a", "b"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.ConstNull),
+				code.Make(code.Dup),
+				code.Make(code.ConstNull),
+				code.Make(code.Equal),
+				code.Make(code.JumpTrue, 13),
+				code.Make(code.GetField, 0),
+				code.Make(code.GetField, 1),
+				code.Make(code.Pop),
+			},
+		},
+		{
+			label:             "optional invocation",
+			input:             "null?.a(1)",
+			expectedConstants: []any{1, "a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Const, 0),
+				code.Make(code.ConstNull),
+				code.Make(code.Dup),
+				code.Make(code.ConstNull),
+				code.Make(code.Equal),
+				code.Make(code.JumpTrue, 19),
+				code.Make(code.GetField, 1),
+				code.Make(code.Call, 1),
+				code.Make(code.Jump, 25),
+				code.Make(code.Pop),
+				code.Make(code.Pop),
+				code.Make(code.ConstNull),
+				code.Make(code.Jump, 25),
+				code.Make(code.Pop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -514,40 +625,37 @@ func TestDictExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input:             "[:]",
-			expectedConstants: []any{0},
+			expectedConstants: []any{},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.Const, 0),
-				code.Make(code.Dict),
+				code.Make(code.Dict, 0),
 				code.Make(code.Pop),
 			},
 		},
 		{
 			label:             "dict with two key-value pairs",
 			input:             "[1: 2, 3: 4]",
-			expectedConstants: []any{1, 2, 3, 4, 2},
+			expectedConstants: []any{1, 2, 3, 4},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.Const, 0),
 				code.Make(code.Const, 1),
 				code.Make(code.Const, 2),
 				code.Make(code.Const, 3),
-				code.Make(code.Const, 4),
-				code.Make(code.Dict),
+				code.Make(code.Dict, 2),
 				code.Make(code.Pop),
 			},
 		},
 		{
 			label:             "dict with expressions",
 			input:             "[1 + 1: 2 * 2]",
-			expectedConstants: []any{1, 1, 2, 2, 1},
+			expectedConstants: []any{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.Const, 0),
-				code.Make(code.Const, 1),
+				code.Make(code.Const, 0),
 				code.Make(code.Add),
-				code.Make(code.Const, 2),
-				code.Make(code.Const, 3),
+				code.Make(code.Const, 1),
+				code.Make(code.Const, 1),
 				code.Make(code.Mul),
-				code.Make(code.Const, 4),
-				code.Make(code.Dict),
+				code.Make(code.Dict, 1),
 				code.Make(code.Pop),
 			},
 		},
@@ -809,44 +917,770 @@ func TestDeclData(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-func runCompilerTests(t *testing.T, tests []compilerTestCase) {
-	t.Helper()
+func TestCopyWith(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			label: "with on data value",
+			input: `
+				data Person {
+					name
+					age
+				}
+				Person("Max", 42) with { age: 43 }
+				`,
+			expectedConstants: []any{
+				compiledDataType{
+					name: "Person",
+					fields: []compiledField{
+						{name: "name"},
+						{name: "age"},
+					},
+				},
+				"Max",
+				42,
+				"age",
+				43,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Const, 1),
+				code.Make(code.Const, 2),
+				code.Make(code.Const, 0),
+				code.Make(code.Call, 2),
+				code.Make(code.Const, 3),
+				code.Make(code.Const, 4),
+				code.Make(code.CopyWith, 1),
+				code.Make(code.Pop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCopyWithUnknownFields(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{
+			input: `
+				data Person { name }
+				Person("Max") with { age: 43 }
+			`,
+			err: `data Person has no field "age"`,
+		},
+		{
+			input: `
+				data Person { name }
+				let max = Person("Max")
+				max with { name: "Moritz" } with { age: 43 }
+			`,
+			err: `data Person has no field "age"`,
+		},
+		{
+			input: `
+				data Person { name }
+				func rename(@Person person) {
+					return person with { nickname: "Max" }
+				}
+			`,
+			err: `data Person has no field "nickname"`,
+		},
+		{
+			input: `
+				data Person { name }
+				data Pet { age }
+				func update(any) {
+					return any with { name: "Max", age: 1 }
+				}
+			`,
+			err: `no data type has the fields name, age`,
+		},
+	}
 
 	for i, tt := range tests {
-		t.Run(fmt.Sprintf("%d. %s", i, tt.label), func(t *testing.T) {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.err), func(t *testing.T) {
 			program := prepareSourceFileParsing(t, tt.input)
 
-			compiler := compiler.New()
-			err := compiler.Compile(program)
-			if err != nil {
-				t.Fatalf("compiler error: %s", err)
+			err := compiler.New().Compile(program)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
 			}
+		})
+	}
+}
 
-			bytecode := compiler.Bytecode()
+func TestNamedAndDefaultArguments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			label: "named arguments in parameter order",
+			input: `
+				data Person {
+					name
+					age
+				}
+				Person(age: 3, name: "A")
+				`,
+			expectedConstants: []any{
+				compiledDataType{
+					name: "Person",
+					fields: []compiledField{
+						{name: "name"},
+						{name: "age"},
+					},
+				},
+				"A",
+				3,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Const, 1),
+				code.Make(code.Const, 2),
+				code.Make(code.Const, 0),
+				code.Make(code.Call, 2),
+				code.Make(code.Pop),
+			},
+		},
+		{
+			label: "omitted default argument",
+			input: `
+				data Person {
+					name
+					@Default(-1) age
+				}
+				Person("A")
+				`,
+			expectedConstants: []any{
+				compiledDataType{
+					name: "Person",
+					fields: []compiledField{
+						{name: "name"},
+						{name: "age"},
+					},
+				},
+				"A",
+				-1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Const, 1),
+				code.Make(code.Const, 2),
+				code.Make(code.Const, 0),
+				code.Make(code.Call, 2),
+				code.Make(code.Pop),
+			},
+		},
+		{
+			label: "reordered named arguments in source order",
+			input: `
+				data Person {
+					name
+					age
+				}
+				Person(age: [3], name: ["A"])
+				`,
+			expectedConstants: []any{
+				compiledDataType{
+					name: "Person",
+					fields: []compiledField{
+						{name: "name"},
+						{name: "age"},
+					},
+				},
+				3,
+				"A",
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Const, 1),
+				code.Make(code.Array, 1),
+				code.Make(code.SetLocal, 0),
+				code.Make(code.Const, 2),
+				code.Make(code.Array, 1),
+				code.Make(code.SetLocal, 1),
+				code.Make(code.GetLocal, 1),
+				code.Make(code.GetLocal, 0),
+				code.Make(code.Const, 0),
+				code.Make(code.Call, 2),
+				code.Make(code.Pop),
+			},
+		},
+	}
 
-			err = testInstructions(t, tt.expectedInstructions, bytecode.Instructions)
-			if err != nil {
-				t.Fatalf("testInstructions failed: %s", err)
-			}
+	runCompilerTests(t, tests)
+}
 
-			err = testConstants(t, tt.expectedConstants, bytecode.Constants)
-			if err != nil {
-				t.Fatalf("testConstants failed: %s", err)
-			}
+func TestInvalidNamedAndDefaultArguments(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{
+			input: `
+				data Person { name }
+				Person(nickname: "A")
+			`,
+			err: `Person has no parameter "nickname"`,
+		},
+		{
+			input: `
+				data Person { name }
+				Person("A", name: "B")
+			`,
+			err: `argument "name" for Person passed more than once`,
+		},
+		{
+			input: `
+				func greet(name, greeting) { return greeting }
+				greet(greeting: "Hi")
+			`,
+			err: `missing argument "name" for greet`,
+		},
+		{
+			input: `
+				func greet(@Default(name) greeting) { return greeting }
+				greet()
+			`,
+			err: `parameter "greeting": @Default value name must be a literal`,
+		},
+	}
 
-			err = testGlobals(t, tt.expectedGlobals, bytecode.Globals)
-			if err != nil {
-				t.Fatalf("testGlobals failed: %s", err)
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.err), func(t *testing.T) {
+			program := prepareSourceFileParsing(t, tt.input)
+
+			err := compiler.New().Compile(program)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
 			}
 		})
 	}
 }
 
-func prepareSourceFileParsing(t *testing.T, input string) *ast.SourceFile {
-	l, err := lexer.New(staticmodule.NewSourceString("testing:///test/test.zirr", input))
-	if err != nil {
-		t.Fatal(err)
-	}
+func TestInvalidPropagation(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{
+			input: `
+				enum Result {
+					data Ok { value }
+					data Err { error }
+				}
+				Ok(1)?
+			`,
+			err: `(Ok(1)?): ? can only be used inside functions`,
+		},
+		{
+			input: `
+				data Ok { value }
+				func unwrap(result) {
+					return result?
+				}
+			`,
+			err: `? requires an enum Result`,
+		},
+		{
+			input: `
+				data Ok { value }
+				data Err { error }
+				enum Result {
+					Ok
+				}
+				func unwrap(result) {
+					return result?
+				}
+			`,
+			err: `? requires an enum Result with the cases Ok and Err`,
+		},
+		{
+			input: `
+				enum Result {
+					data Ok { value }
+					data Err {
+						error
+						reason
+					}
+				}
+				func unwrap(result) {
+					return result?
+				}
+			`,
+			err: `? requires a data type Err with one field`,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.err), func(t *testing.T) {
+			program := prepareSourceFileParsing(t, tt.input)
+
+			err := compiler.New().Compile(program)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestDefer(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			label: "deferred block is skipped",
+			input: `
+			func example() {
+				defer {
+					return recover()
+				}
+				return panic(42)
+			}
+			`,
+			expectedConstants: []any{
+				compiledFunction{
+					name:   "example",
+					params: 0,
+					ins: []code.Instructions{
+						code.Make(code.Defer, 6),
+						code.Make(code.Recover),
+						code.Make(code.Return),
+						code.Make(code.EndDefer),
+						code.Make(code.Const, 1),
+						code.Make(code.Panic),
+						code.Make(code.Return),
+					},
+				},
+				42,
+			},
+			expectedInstructions: []code.Instructions{},
+		},
+		{
+			label: "implicit return",
+			input: `
+			func example() {
+				defer {}
+			}
+			`,
+			expectedConstants: []any{
+				compiledFunction{
+					name:   "example",
+					params: 0,
+					ins: []code.Instructions{
+						code.Make(code.Defer, 4),
+						code.Make(code.EndDefer),
+						code.Make(code.ConstNull),
+						code.Make(code.Return),
+					},
+				},
+			},
+			expectedInstructions: []code.Instructions{},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSwitch(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			label: "value and default cases",
+			input: `(switch 1 {
+			case 2:
+				3
+			case _:
+				4
+			})`,
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Const, 0),
+				code.Make(code.Dup),
+				code.Make(code.Const, 1),
+				code.Make(code.Equal),
+				code.Make(code.JumpFalse, 18),
+				code.Make(code.Pop),
+				code.Make(code.Const, 2),
+				code.Make(code.Jump, 25),
+				code.Make(code.Pop),
+				code.Make(code.Const, 3),
+				code.Make(code.Jump, 25),
+				code.Make(code.Pop),
+			},
+		},
+		{
+			label: "no matching statement case",
+			input: `switch 1 {
+			case 2:
+				3
+			}`,
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.Const, 0),
+				code.Make(code.Dup),
+				code.Make(code.Const, 1),
+				code.Make(code.Equal),
+				code.Make(code.JumpFalse, 19),
+				code.Make(code.Pop),
+				code.Make(code.Const, 2),
+				code.Make(code.Pop),
+				code.Make(code.Jump, 20),
+				code.Make(code.Pop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestInvalidSwitch(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{
+			input: `
+				switch 1 {
+				case @unknown:
+					1
+				}
+			`,
+			err: `unknown type in case @unknown`,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.err), func(t *testing.T) {
+			program := prepareSourceFileParsing(t, tt.input)
+
+			err := compiler.New().Compile(program)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestInvalidDefer(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{
+			input: `
+				func example() {
+					return recover()
+				}
+			`,
+			err: `recover() can only be used inside defer blocks`,
+		},
+		{
+			input: `
+				if true {
+					defer {}
+				}
+			`,
+			err: `defer can only be used inside functions`,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.err), func(t *testing.T) {
+			program := prepareSourceFileParsing(t, tt.input)
+
+			err := compiler.New().Compile(program)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestUndefinedNames(t *testing.T) {
+	input := `
+	func greet(person) {
+		return persn
+	}
+	greet(unknown)
+	`
+	program := prepareSourceFileParsing(t, input)
+
+	want := strings.Join([]string{
+		`testing:///test/test.zirr:3:10: resolve error: undefined name, "persn" is not declared, did you mean "person"?`,
+		`testing:///test/test.zirr:5:8: resolve error: undefined name, "unknown" is not declared`,
+	}, "\n")
+	err := compiler.New().Compile(program)
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestCopyWithUnverifiedFields(t *testing.T) {
+	input := `
+	data Person { name }
+	data Pet { age }
+	func update(person) {
+		return person with { age: 1 }
+	}
+	update(Person("Max"))
+	`
+
+	comp := compiler.New()
+	err := comp.Compile(prepareSourceFileParsing(t, input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var got []string
+	for _, w := range comp.Warnings() {
+		got = append(got, w.Error())
+	}
+	want := `testing:///test/test.zirr:5:17: resolve warning: unverified fields, the data type of person is not known, so it may not have the fields age`
+	if strings.Join(got, "\n") != want {
+		t.Errorf("expected warnings %q, got %q", want, got)
+	}
+
+	comp = compiler.New()
+	comp.PromoteWarnings()
+	err = comp.Compile(prepareSourceFileParsing(t, input))
+	want = `testing:///test/test.zirr:5:17: resolve error: unverified fields, the data type of person is not known, so it may not have the fields age`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	input := `
+	@Deprecated("use greet")
+	func hello() {
+		return 1
+	}
+	@Suppress("deprecated")
+	func legacy() {
+		return hello()
+	}
+	hello()
+	legacy()
+	`
+
+	comp := compiler.New()
+	err := comp.Compile(prepareSourceFileParsing(t, input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var got []string
+	for _, w := range comp.Warnings() {
+		got = append(got, w.Error())
+	}
+	want := `testing:///test/test.zirr:10:2: resolve warning: deprecated, hello is deprecated: use greet`
+	if strings.Join(got, "\n") != want {
+		t.Errorf("expected warnings %q, got %q", want, got)
+	}
+
+	comp = compiler.New()
+	comp.PromoteWarnings()
+	err = comp.Compile(prepareSourceFileParsing(t, input))
+	want = `testing:///test/test.zirr:10:2: resolve error: deprecated, hello is deprecated: use greet`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+	if len(comp.Warnings()) != 0 {
+		t.Errorf("expected promoted warnings to be errors only, got %v", comp.Warnings())
+	}
+}
+
+func TestTypeCheck(t *testing.T) {
+	input := `
+	@Returns(String)
+	func answer() {
+		return 42
+	}
+	`
+	err := compiler.New().Compile(prepareSourceFileParsing(t, input))
+	if err != nil {
+		t.Fatalf("expected type checks to be opt-in, got %s", err)
+	}
+
+	comp := compiler.New()
+	comp.EnableTypeCheck()
+	err = comp.Compile(prepareSourceFileParsing(t, input))
+	want := `testing:///test/test.zirr:4:3: type error: type mismatch for return value, want @String, got Int`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestContracts(t *testing.T) {
+	input := `
+	@Returns(Int)
+	func twice(@Int n, @Type("Float") @Default(1.5) factor, rest) {
+		return n
+	}
+	`
+	program := prepareSourceFileParsing(t, input)
+
+	comp := compiler.New()
+	comp.EnableContracts()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	err = testConstants(t, []any{
+		compiledFunction{
+			name:   "twice",
+			params: 3,
+			ins: []code.Instructions{
+				code.Make(code.GetLocal, 0),
+				code.Make(code.AssertContract, 1),
+				code.Make(code.Pop),
+				code.Make(code.GetLocal, 1),
+				code.Make(code.AssertContract, 2),
+				code.Make(code.Pop),
+				code.Make(code.GetLocal, 0),
+				code.Make(code.AssertContract, 0),
+				code.Make(code.Return),
+			},
+		},
+	}, bytecode.Constants)
+	if err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+
+	want := []string{
+		"return value of twice: @Int [Int]",
+		"parameter n of twice: @Int [Int]",
+		"parameter factor of twice: @Float [Float]",
+	}
+	got := make([]string, len(bytecode.Contracts))
+	for i, ct := range bytecode.Contracts {
+		checks := make([]string, len(ct.Checks))
+		for j, check := range ct.Checks {
+			checks[j] = fmt.Sprintf("%s %v", check.Want, check.Builtins)
+		}
+		got[i] = ct.Subject + ": " + strings.Join(checks, ", ")
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected contracts\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestEncodeBytecode(t *testing.T) {
+	program := prepareSourceFileParsing(t, `
+	data Person { name }
+	func greet(person, greeting...) {
+		let name = person.name
+		return name
+	}
+	greet(Person("Max"))
+	`)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	var buf bytes.Buffer
+	err = bytecode.Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	encoded := buf.Bytes()
+
+	decoded, err := compiler.DecodeBytecode(bytes.NewReader(encoded), nil)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	err = testInstructions(t, []code.Instructions{bytecode.Instructions}, decoded.Instructions)
+	if err != nil {
+		t.Fatalf("wrong instructions: %s", err)
+	}
+	err = testConstants(t, []any{
+		compiledDataType{name: "Person", fields: []compiledField{{"name"}}},
+		compiledFunction{
+			name:   "greet",
+			params: 1,
+			ins:    []code.Instructions{bytecode.Constants[1].(*runtime.CompiledFunction).Instructions},
+		},
+		"name",
+		"Max",
+	}, decoded.Constants)
+	if err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+
+	fn := decoded.Constants[1].(*runtime.CompiledFunction)
+	if strings.Join(fn.ParamNames, ", ") != "person, greeting" || !fn.Variadic {
+		t.Errorf("unexpected parameters %v, variadic %v", fn.ParamNames, fn.Variadic)
+	}
+	if fn.Locals != 3 {
+		t.Errorf("expected 3 locals, got %d", fn.Locals)
+	}
+	if strings.Join(fn.LocalNames, ", ") != "name" {
+		t.Errorf("unexpected local names %v", fn.LocalNames)
+	}
+	if len(fn.SourceMap) != 2 {
+		t.Fatalf("expected a source mapping per statement, got %v", fn.SourceMap)
+	}
+	if m, ok := fn.SourceMap.Lookup(len(fn.Instructions) - 1); !ok || m.File != "testing:///test/test.zirr" {
+		t.Errorf("expected the return statement to be mapped, got %v", m)
+	}
+
+	tests := []struct {
+		label string
+		data  []byte
+		err   string
+	}{
+		{"empty", nil, "not a zirric bytecode file"},
+		{"magic", []byte("ZIRR\x00\x01"), "not a zirric bytecode file"},
+		{"format version", append([]byte("ZIRC\x00\x01"), encoded[6:]...), "unsupported bytecode format version 1, want 4"},
+		{"opcode set", append(append([]byte{}, encoded[:6]...), 0, 0, 0, 0), fmt.Sprintf("bytecode requires opcode set 00000000, have %08x", code.SetVersion())},
+		{"truncated", encoded[:len(encoded)-1], "invalid bytecode: EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			_, err := compiler.DecodeBytecode(bytes.NewReader(tt.data), nil)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.label), func(t *testing.T) {
+			program := prepareSourceFileParsing(t, tt.input)
+
+			compiler := compiler.New()
+			err := compiler.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			bytecode := compiler.Bytecode()
+
+			err = testInstructions(t, tt.expectedInstructions, bytecode.Instructions)
+			if err != nil {
+				t.Fatalf("testInstructions failed: %s", err)
+			}
+
+			err = testConstants(t, tt.expectedConstants, bytecode.Constants)
+			if err != nil {
+				t.Fatalf("testConstants failed: %s", err)
+			}
+
+			err = testGlobals(t, tt.expectedGlobals, bytecode.Globals)
+			if err != nil {
+				t.Fatalf("testGlobals failed: %s", err)
+			}
+		})
+	}
+}
+
+func prepareSourceFileParsing(t *testing.T, input string) *ast.SourceFile {
+	l, err := lexer.New(staticmodule.NewSourceString("testing:///test/test.zirr", input))
+	if err != nil {
+		t.Fatal(err)
+	}
 	p := parser.NewSourceParser(l, nil, "test.zirr")
 	srcFile := p.ParseSourceFile()
 	checkParserErrors(t, p, input)
@@ -950,8 +1784,8 @@ func testConstants(
 				return fmt.Errorf("constant %d is not a function: %T", i, actual[i])
 			}
 
-			if got.Symbol.Name != want.name {
-				return fmt.Errorf("wrong function name at %d.\nwant=%q\ngot=%q", i, want.name, got.Symbol.Name)
+			if got.Name != want.name {
+				return fmt.Errorf("wrong function name at %d.\nwant=%q\ngot=%q", i, want.name, got.Name)
 			}
 
 			if got.Arity() != want.params {
@@ -969,17 +1803,17 @@ func testConstants(
 				return fmt.Errorf("constant %d is not a data type: %T", i, actual[i])
 			}
 
-			if got.Symbol.Name != want.name {
-				return fmt.Errorf("wrong data type name at %d.\nwant=%q\ngot=%q", i, want.name, got.Symbol.Name)
+			if got.Name != want.name {
+				return fmt.Errorf("wrong data type name at %d.\nwant=%q\ngot=%q", i, want.name, got.Name)
 			}
 
-			if len(got.FieldSymbols) != len(want.fields) {
-				return fmt.Errorf("wrong amount of fields at %d.\nwant=%d\ngot=%d", i, len(want.fields), len(got.FieldSymbols))
+			if len(got.Fields) != len(want.fields) {
+				return fmt.Errorf("wrong amount of fields at %d.\nwant=%d\ngot=%d", i, len(want.fields), len(got.Fields))
 			}
 
 			for j, field := range want.fields {
-				if got.FieldSymbols[j].Name != field.name {
-					return fmt.Errorf("wrong field name at %d.%d.\nwant=%q\ngot=%q", i, j, field.name, got.FieldSymbols[j].Name)
+				if got.Fields[j] != field.name {
+					return fmt.Errorf("wrong field name at %d.%d.\nwant=%q\ngot=%q", i, j, field.name, got.Fields[j])
 				}
 			}
 
@@ -1024,3 +1858,363 @@ type compiledDataType struct {
 type compiledField struct {
 	name string
 }
+
+func TestDisassemble(t *testing.T) {
+	program := prepareSourceFileParsing(t, `func greet(person, @Default("!") suffix) {
+	let name = person.name
+	if name == "" {
+		return "Hello"
+	}
+	return "Hello " + name + suffix
+}
+let greeter = greet
+greeter(null, suffix: "?")
+`)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	want := strings.TrimPrefix(`
+main:
+  ; testing:///test/test.zirr:9:1
+  0000 constnull
+  0001 const 5                  ; "?"
+  0004 getglobal 0              ; greeter
+  0007 callnamed 2 6            ; ["suffix"]
+  0012 pop
+
+global 0 greeter:
+  ; testing:///test/test.zirr:8:1
+  0000 const 0                  ; func greet(#2)
+
+constant 0 func greet(person, suffix):
+  ; testing:///test/test.zirr:2:2
+  0000 getlocal 0               ; person
+  0003 getfield 1               ; "name"
+  0006 setlocal 2               ; name
+  ; testing:///test/test.zirr:3:2
+  0009 getlocal 2               ; name
+  0012 const 2                  ; ""
+  0015 eq
+  0016 jumpfalse L0
+  ; testing:///test/test.zirr:4:3
+  0019 const 3                  ; "Hello"
+  0022 return
+L0:
+  ; testing:///test/test.zirr:6:2
+  0023 const 4                  ; "Hello "
+  0026 getlocal 2               ; name
+  0029 add
+  0030 getlocal 1               ; suffix
+  0033 add
+  0034 return
+
+`, "\n")
+	got := comp.Bytecode().String()
+	if got != want {
+		t.Errorf("unexpected disassembly\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestWideJumps(t *testing.T) {
+	terms := make([]string, 70000)
+	for i := range terms {
+		terms[i] = fmt.Sprint(i)
+	}
+	program := prepareSourceFileParsing(t, fmt.Sprintf(`
+	func pick(flag) {
+		if flag {
+			return %s
+		}
+		return 42
+	}
+	`, strings.Join(terms, " + ")))
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+	fn := bytecode.Constants[0].(*runtime.CompiledFunction)
+
+	jump, err := code.Decode(fn.Instructions[code.Len(code.GetLocal, false):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jump.Opcode != code.JumpFalse || !jump.Wide {
+		t.Fatalf("expected a wide jumpfalse, got %v", jump)
+	}
+	target, err := code.Decode(fn.Instructions[jump.Operands[0]:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Opcode != code.Const || bytecode.Constants[target.Operands[0]] != runtime.Int(42) {
+		t.Fatalf("expected the jump to target const 42, got %v", target)
+	}
+	if m, ok := fn.SourceMap.Lookup(jump.Operands[0]); !ok || m.Offset != jump.Operands[0] {
+		t.Errorf("expected the source map to follow the jump target, got %v", fn.SourceMap)
+	}
+}
+
+func TestOptimization(t *testing.T) {
+	tests := []struct {
+		label string
+		level compiler.OptimizationLevel
+		input string
+		want  string
+	}{
+		{
+			label: "constant folding",
+			level: compiler.OptimizeFull,
+			input: "let isFalse = 0 != 0\nlet x = -(2 * 3) + 1.5",
+			want: `
+main:
+
+global 0 isFalse:
+  ; testing:///test/test.zirr:1:1
+  0000 constfalse
+
+global 1 x:
+  ; testing:///test/test.zirr:2:1
+  0000 const 6                  ; -4.500000
+
+`,
+		},
+		{
+			label: "unreachable branches",
+			level: compiler.OptimizeFull,
+			input: "func pick() {\n\tif true {\n\t\treturn 1\n\t} else {\n\t\treturn 2\n\t}\n}",
+			want: `
+main:
+
+constant 0 func pick():
+  ; testing:///test/test.zirr:3:3
+  0000 const 1                  ; 1
+  0003 return
+
+`,
+		},
+		{
+			label: "jump threading",
+			level: compiler.OptimizePeephole,
+			input: "func pick(a, b) {\n\tif a {\n\t\tif b {\n\t\t\treturn 1\n\t\t} else {\n\t\t\tpick(a, b)\n\t\t}\n\t} else {\n\t\tpick(b, a)\n\t}\n\treturn 3\n}",
+			want: `
+main:
+
+constant 0 func pick(a, b):
+  ; testing:///test/test.zirr:2:2
+  0000 getlocal 0               ; a
+  0003 jumpfalse L1
+  ; testing:///test/test.zirr:3:3
+  0006 getlocal 1               ; b
+  0009 jumpfalse L0
+  ; testing:///test/test.zirr:4:4
+  0012 const 1                  ; 1
+  0015 return
+  0016 jump L2
+L0:
+  ; testing:///test/test.zirr:6:4
+  0019 getlocal 0               ; a
+  0022 getlocal 1               ; b
+  0025 const 0                  ; func pick(#2)
+  0028 call 2
+  0031 pop
+  0032 jump L2
+L1:
+  ; testing:///test/test.zirr:9:3
+  0035 getlocal 1               ; b
+  0038 getlocal 0               ; a
+  0041 const 0                  ; func pick(#2)
+  0044 call 2
+  0047 pop
+L2:
+  ; testing:///test/test.zirr:11:2
+  0048 const 2                  ; 3
+  0051 return
+
+`,
+		},
+		{
+			label: "push and pop",
+			level: compiler.OptimizePeephole,
+			input: "func pick(a) {\n\ta\n\treturn a\n}",
+			want: `
+main:
+
+constant 0 func pick(a):
+  ; testing:///test/test.zirr:3:2
+  0000 getlocal 0               ; a
+  0003 return
+
+`,
+		},
+		{
+			label: "division by zero is kept",
+			level: compiler.OptimizeFull,
+			input: "let x = 1 / 0",
+			want: `
+main:
+
+global 0 x:
+  ; testing:///test/test.zirr:1:1
+  0000 const 0                  ; 1
+  0003 const 1                  ; 0
+  0006 div
+
+`,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.label), func(t *testing.T) {
+			program := prepareSourceFileParsing(t, tt.input)
+
+			comp := compiler.New()
+			comp.SetOptimizationLevel(tt.level)
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+			want := strings.TrimPrefix(tt.want, "\n")
+			got := comp.Bytecode().String()
+			if got != want {
+				t.Errorf("unexpected disassembly\nwant:\n%s\ngot:\n%s", want, got)
+			}
+		})
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		label string
+		input string
+		want  string
+	}{
+		{
+			label: "through if expressions",
+			input: "func count(n, acc) {\n\treturn if n == 0 { acc } else if n == 1 { count(0, acc + 1) } else { count(n - 1, acc + 1) }\n}",
+			want: `
+main:
+
+constant 0 func count(n, acc):
+  ; testing:///test/test.zirr:2:2
+  0000 getlocal 0               ; n
+  0003 const 1                  ; 0
+  0006 eq
+  0007 jumpfalse L0
+  0010 getlocal 1               ; acc
+  0013 return
+L0:
+  0014 getlocal 0               ; n
+  0017 const 2                  ; 1
+  0020 eq
+  0021 jumpfalse L1
+  0024 const 1                  ; 0
+  0027 getlocal 1               ; acc
+  0030 const 2                  ; 1
+  0033 add
+  0034 const 0                  ; func count(#2)
+  0037 tailcall 2
+  0040 return
+L1:
+  0041 getlocal 0               ; n
+  0044 const 2                  ; 1
+  0047 sub
+  0048 getlocal 1               ; acc
+  0051 const 2                  ; 1
+  0054 add
+  0055 const 0                  ; func count(#2)
+  0058 tailcall 2
+  0061 return
+
+`,
+		},
+		{
+			label: "through switch expressions",
+			input: "func count(n, xs...) {\n\treturn switch n {\n\tcase 0:\n\t\txs\n\tcase _:\n\t\tcount(n - 1, xs...)\n\t}\n}",
+			want: `
+main:
+
+constant 0 func count(n, xs...):
+  ; testing:///test/test.zirr:2:2
+  0000 getlocal 0               ; n
+  0003 dup
+  0004 const 1                  ; 0
+  0007 eq
+  0008 jumpfalse L0
+  0011 pop
+  0012 getlocal 1               ; xs
+  0015 return
+L0:
+  0016 pop
+  0017 getlocal 0               ; n
+  0020 const 2                  ; 1
+  0023 sub
+  0024 getlocal 1               ; xs
+  0027 const 0                  ; func count(#1)
+  0030 tailcallspread 2
+  0033 return
+
+`,
+		},
+		{
+			label: "not in tail position",
+			input: "func deep(n) {\n\treturn 1 + deep(n - 1)\n}",
+			want: `
+main:
+
+constant 0 func deep(n):
+  ; testing:///test/test.zirr:2:2
+  0000 const 1                  ; 1
+  0003 getlocal 0               ; n
+  0006 const 1                  ; 1
+  0009 sub
+  0010 const 0                  ; func deep(#1)
+  0013 call 1
+  0016 add
+  0017 return
+
+`,
+		},
+		{
+			label: "within deferred blocks",
+			input: "func cleanup() {\n\tdefer {\n\t\treturn cleanup()\n\t}\n}",
+			want: `
+main:
+
+constant 0 func cleanup():
+  ; testing:///test/test.zirr:2:2
+  0000 defer L0
+  ; testing:///test/test.zirr:3:3
+  0003 const 0                  ; func cleanup(#0)
+  0006 call 0
+  0009 return
+  0010 enddefer
+L0:
+  0011 constnull
+  0012 return
+
+`,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.label), func(t *testing.T) {
+			program := prepareSourceFileParsing(t, tt.input)
+
+			comp := compiler.New()
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+			want := strings.TrimPrefix(tt.want, "\n")
+			got := comp.Bytecode().String()
+			if got != want {
+				t.Errorf("unexpected disassembly\nwant:\n%s\ngot:\n%s", want, got)
+			}
+		})
+	}
+}
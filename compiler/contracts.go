@@ -0,0 +1,211 @@
+package compiler
+
+import (
+	"slices"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/op"
+	"github.com/vknabel/zirric/resolve"
+	"github.com/vknabel/zirric/runtime"
+	"github.com/vknabel/zirric/typecheck"
+)
+
+// EnableContracts makes the compiler emit runtime checks for annotated
+// parameters, data fields and `@Returns` of functions.
+// Must be called before compiling.
+func (c *Compiler) EnableContracts() {
+	c.checkContracts = true
+}
+
+func (c *Compiler) addContract(ct *runtime.Contract) int {
+	c.contracts = append(c.contracts, ct)
+	return len(c.contracts) - 1
+}
+
+// emitParameterContracts asserts the annotated parameters at the start of a function.
+// Variadic parameters are not checked.
+func (c *Compiler) emitParameterContracts(fn string, params []ast.DeclParameter) {
+	for i, p := range params {
+		if p.Variadic {
+			continue
+		}
+		ct := c.contract("parameter "+p.Name.Value+" of "+fn, p.Annotations)
+		if ct == nil {
+			continue
+		}
+		c.emit(op.GetLocal, i)
+		c.emit(op.AssertContract, c.addContract(ct))
+		c.emit(op.Pop)
+	}
+}
+
+// emitReturnContract asserts the return value on top of the stack, if the function declares `@Returns`.
+func (c *Compiler) emitReturnContract() {
+	if id := c.scopes[c.scopeIdx].returnContract; id != nil {
+		c.emit(op.AssertContract, *id)
+	}
+}
+
+// fieldContracts returns the contracts of all fields or nil if none are annotated.
+func (c *Compiler) fieldContracts(data string, fields []ast.DeclField) []*runtime.Contract {
+	var contracts []*runtime.Contract
+	for i, f := range fields {
+		ct := c.contract("field "+f.Name.Value+" of "+data, f.Annotations)
+		if ct == nil {
+			continue
+		}
+		if contracts == nil {
+			contracts = make([]*runtime.Contract, len(fields))
+		}
+		contracts[i] = ct
+	}
+	return contracts
+}
+
+// contract resolves `@Type(T)`, `@T` and `@Has(A)` annotations into a runtime contract.
+// Returns nil if contracts are disabled or no annotation can be checked.
+func (c *Compiler) contract(subject string, annos ast.AnnotationChain) *runtime.Contract {
+	if !c.checkContracts {
+		return nil
+	}
+	var checks []runtime.ContractCheck
+	for _, inst := range annos {
+		if check, ok := c.annotationCheck(inst); ok {
+			checks = append(checks, check)
+		}
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+	return &runtime.Contract{Subject: subject, Checks: checks}
+}
+
+// annotationCheck resolves a single `@Type(T)`, `@T` or `@Has(A)` annotation.
+func (c *Compiler) annotationCheck(inst *ast.DeclAnnotationInstance) (runtime.ContractCheck, bool) {
+	switch c.builtinAnnotation(inst) {
+	case "Type":
+		if name, ok := typeArgument(inst.Arguments); ok {
+			return c.typeContract(name)
+		}
+	case "Has":
+		if name, ok := typeArgument(inst.Arguments); ok {
+			return c.hasContract(name)
+		}
+	case "":
+		if len(inst.Reference) == 1 {
+			return c.typeContract(inst.Reference.Name().Value)
+		}
+	}
+	return runtime.ContractCheck{}, false
+}
+
+// returnContract resolves the `@Returns(T)` annotation of a function.
+func (c *Compiler) returnContract(fn string, annos ast.AnnotationChain) *runtime.Contract {
+	if !c.checkContracts {
+		return nil
+	}
+	for _, inst := range annos {
+		if c.builtinAnnotation(inst) != "Returns" {
+			continue
+		}
+		name, ok := typeArgument(inst.Arguments)
+		if !ok {
+			return nil
+		}
+		check, ok := c.typeContract(name)
+		if !ok {
+			return nil
+		}
+		return &runtime.Contract{Subject: "return value of " + fn, Checks: []runtime.ContractCheck{check}}
+	}
+	return nil
+}
+
+func (c *Compiler) builtinAnnotation(inst *ast.DeclAnnotationInstance) string {
+	return typecheck.BuiltinAnnotation(inst, c.resolve)
+}
+
+// typeArgument returns the type name of annotations like `@Type(Int)` or `@Type("Int")`.
+func typeArgument(args []ast.Expr) (string, bool) {
+	if len(args) != 1 {
+		return "", false
+	}
+	switch arg := args[0].(type) {
+	case *ast.ExprIdentifier:
+		return arg.Name.Value, true
+	case *ast.ExprString:
+		return arg.Literal, true
+	default:
+		return "", false
+	}
+}
+
+// typeContract accepts values of a builtin type, a data type or the cases of an enum.
+// Reports false for types, that cannot be checked like `Any` or extern types.
+func (c *Compiler) typeContract(name string) (runtime.ContractCheck, bool) {
+	check := runtime.ContractCheck{Want: "@" + name}
+	types, ok := c.typeScope().Types(ast.StaticReference{ast.Identifier{Value: name}})
+	if !ok {
+		return check, false
+	}
+	for _, sym := range types {
+		switch sym.Decl.(type) {
+		case *ast.DeclData:
+			if sym.ConstantId == nil {
+				// declared in a file, that is not compiled yet
+				return check, false
+			}
+			check.Types = append(check.Types, runtime.TypeId(*sym.ConstantId))
+		default:
+			if !c.acceptBuiltin(&check, sym.Name) {
+				return check, false
+			}
+		}
+	}
+	slices.Sort(check.Types)
+	return check, true
+}
+
+// typeScope looks up types within the current scope and the declared modules.
+func (c *Compiler) typeScope() resolve.TypeScope {
+	return resolve.TypeScope{Table: c.scopes[c.scopeIdx].symbols, Modules: c.lookupModule}
+}
+
+func (c *Compiler) acceptBuiltin(check *runtime.ContractCheck, name string) bool {
+	if name == "Any" || !typecheck.IsBuiltinType(name) {
+		// builtin types are checked by the kind of their values, but `Any` needs no check
+		return false
+	}
+	if !slices.Contains(check.Builtins, name) {
+		check.Builtins = append(check.Builtins, name)
+	}
+	return true
+}
+
+// hasContract accepts all data types and builtin types, that are annotated with the given annotation.
+// Types of all declared modules are included, as long as they are compiled before.
+func (c *Compiler) hasContract(name string) (runtime.ContractCheck, bool) {
+	check := runtime.ContractCheck{Want: "@Has(" + name + ")"}
+	modules := make([]*ast.ContextModule, 0, len(c.modules))
+	for _, mod := range c.modules {
+		modules = append(modules, mod)
+	}
+	types, ok := c.typeScope().Annotated(ast.StaticReference{ast.Identifier{Value: name}}, modules...)
+	if !ok {
+		return check, false
+	}
+
+	for _, sym := range types {
+		switch sym.Decl.(type) {
+		case *ast.DeclData:
+			if sym.ConstantId != nil {
+				check.Types = append(check.Types, runtime.TypeId(*sym.ConstantId))
+			}
+		case *ast.DeclExternType:
+			c.acceptBuiltin(&check, sym.Name)
+		}
+	}
+	slices.Sort(check.Types)
+	slices.Sort(check.Builtins)
+	return check, true
+}
@@ -1,9 +1,14 @@
 package compiler
 
 import (
+	"fmt"
+	"math"
+
 	"github.com/vknabel/zirric/ast"
 	"github.com/vknabel/zirric/op"
+	"github.com/vknabel/zirric/resolve"
 	"github.com/vknabel/zirric/runtime"
+	"github.com/vknabel/zirric/token"
 )
 
 type emittedInstruction struct {
@@ -13,8 +18,21 @@ type emittedInstruction struct {
 
 type CompilationScope struct {
 	Instructions op.Instructions
-	symbols      *ast.SymbolTable
-	locals       []*ast.Symbol
+	// The name of the initialized global, empty for other scopes.
+	Name    string
+	symbols *ast.SymbolTable
+	locals  []*ast.Symbol
+	// Maps the instructions to their statements.
+	sourceMap op.SourceMap
+	// Addresses of jumps by their position, that don't fit into their narrow placeholder.
+	farJumps map[int]int
+	// Top level statements keep their values, as the last popped one is the result of the program.
+	topLevel bool
+
+	// The nesting level of deferred blocks, that are currently compiled.
+	deferDepth int
+	// The contract id of returned values, nil if unchecked.
+	returnContract *int
 
 	lastInstruction     emittedInstruction
 	previousInstruction emittedInstruction
@@ -22,32 +40,73 @@ type CompilationScope struct {
 
 type Bytecode struct {
 	Instructions op.Instructions
-	Constants    []runtime.RuntimeValue
-	Globals      []*CompilationScope
+	// Maps the top level instructions to their statements.
+	SourceMap op.SourceMap
+	// The names of the locals of the top level instructions, which only hold temporaries.
+	LocalNames []string
+	Constants  []runtime.RuntimeValue
+	Globals    []*CompilationScope
+
+	// The prelude Result types, nil if not declared.
+	Result *runtime.ResultTypes
+	// The contracts referenced by AssertContract.
+	Contracts []*runtime.Contract
 }
 
 type Compiler struct {
 	constants []runtime.RuntimeValue
-	globals   []*CompilationScope
-	plugins   *runtime.ExternPluginRegistry
+	// The constant ids of interned literals.
+	interned map[any]int
+	globals  []*CompilationScope
+	plugins  *runtime.ExternPluginRegistry
+	result   *runtime.ResultTypes
+
+	checkContracts bool
+	contracts      []*runtime.Contract
+
+	checkTypes bool
+
+	optimization OptimizationLevel
+
+	promoteWarnings bool
+	warnings        []resolve.Diagnostic
+
+	// The importable modules by their dotted name.
+	modules map[string]*ast.ContextModule
+	// The constant ids of module values by the module table.
+	moduleValues map[*ast.SymbolTable]int
 
 	scopes   []*CompilationScope
 	scopeIdx int
+
+	// The first error of emitting instructions, reported once the file or module is compiled.
+	err error
 }
 
 func New() *Compiler {
+	return NewWithPlugins(runtime.MakeExternPluginRegistry())
+}
+
+// NewWithPlugins creates a compiler, that binds extern declarations using the given plugins.
+func NewWithPlugins(plugins *runtime.ExternPluginRegistry) *Compiler {
 	mainScope := &CompilationScope{
 		Instructions: op.Instructions{},
 		symbols:      ast.MakeSymbolTable(nil, nil),
 	}
 	return &Compiler{
 		constants: []runtime.RuntimeValue{},
-		plugins:   &runtime.ExternPluginRegistry{},
+		interned:  make(map[any]int),
+		plugins:   plugins,
 		scopes:    []*CompilationScope{mainScope},
 		scopeIdx:  0,
 	}
 }
 
+// Plugins returns the plugins, that bind extern declarations.
+func (c *Compiler) Plugins() *runtime.ExternPluginRegistry {
+	return c.plugins
+}
+
 func (c *Compiler) currentInstructions() op.Instructions {
 	return c.scopes[c.scopeIdx].Instructions
 }
@@ -55,12 +114,21 @@ func (c *Compiler) currentInstructions() op.Instructions {
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
+		SourceMap:    c.scopes[c.scopeIdx].sourceMap,
+		LocalNames:   c.scopes[c.scopeIdx].localNames(),
 		Constants:    c.constants,
 		Globals:      c.globals,
+		Result:       c.result,
+		Contracts:    c.contracts,
 	}
 }
 
 func (c *Compiler) emit(opcode op.Opcode, operands ...int) int {
+	for _, o := range operands {
+		if o < 0 || o > op.MaxOperand {
+			c.fail(fmt.Errorf("operand %d of %s exceeds the maximum of %d", o, opcode, op.MaxOperand))
+		}
+	}
 	ins := op.Make(opcode, operands...)
 	pos := c.addInstruction(ins)
 
@@ -78,10 +146,37 @@ func (c *Compiler) addInstruction(ins []byte) int {
 	return newPos
 }
 
+// addConstant adds a value to the constant pool.
+// Literals are interned, so equal literals share one constant.
+// Types, functions and modules are reserved by their declarations instead.
 func (c *Compiler) addConstant(v runtime.RuntimeValue) int {
+	key, ok := internKey(v)
+	if ok {
+		if id, ok := c.interned[key]; ok {
+			return id
+		}
+	}
 	c.constants = append(c.constants, v)
-	// TODO: addConstant, what about types?
-	return len(c.constants) - 1
+	id := len(c.constants) - 1
+	if ok {
+		c.interned[key] = id
+	}
+	return id
+}
+
+// floatBits keys interned floats, as 0.0 and -0.0 are equal but distinct.
+type floatBits uint64
+
+// internKey returns the key of interned literals.
+func internKey(v runtime.RuntimeValue) (any, bool) {
+	switch v := v.(type) {
+	case runtime.Int, runtime.String, runtime.Char:
+		return v, true
+	case runtime.Float:
+		return floatBits(math.Float64bits(float64(v))), true
+	default:
+		return nil, false
+	}
 }
 
 func (c *Compiler) addGlobal(scope *CompilationScope) int {
@@ -97,13 +192,91 @@ func (c *Compiler) enterScope(syms *ast.SymbolTable) {
 	c.scopeIdx++
 }
 
+// mapSource maps the following instructions to the source of a statement.
+func (c *Compiler) mapSource(tok token.Token) {
+	if tok.Source == nil {
+		return
+	}
+	scope := c.scopes[c.scopeIdx]
+	scope.sourceMap = scope.sourceMap.Add(op.SourceMapping{
+		Offset:   len(scope.Instructions),
+		File:     tok.Source.File,
+		Position: tok.Source.Offset,
+		Line:     tok.Source.Line,
+		Column:   tok.Source.Column,
+	})
+}
+
+// SourceMap maps the instructions of the scope to their statements.
+func (s *CompilationScope) SourceMap() op.SourceMap {
+	return s.sourceMap
+}
+
+// Locals returns the amount of locals of the scope.
+func (s *CompilationScope) Locals() int {
+	return len(s.locals)
+}
+
+// addTemporary reserves a local for an intermediate value.
+func (c *Compiler) addTemporary() int {
+	scope := c.scopes[c.scopeIdx]
+	id := len(scope.locals)
+	scope.locals = append(scope.locals, &ast.Symbol{Name: fmt.Sprintf("$%d", id)})
+	return id
+}
+
+// localNames returns the names of all locals of the scope by their id.
+func (s *CompilationScope) localNames() []string {
+	names := make([]string, len(s.locals))
+	for i, sym := range s.locals {
+		names[i] = sym.Name
+	}
+	return names
+}
+
+// leaveScope finishes the current scope, optimizes it and patches its far jumps.
 func (c *Compiler) leaveScope() *CompilationScope {
 	scope := c.scopes[c.scopeIdx]
 	c.scopes = c.scopes[:len(c.scopes)-1]
 	c.scopeIdx--
+	if c.optimization > OptimizeNone {
+		if err := c.optimize(scope); err != nil {
+			c.fail(err)
+		}
+	} else if len(scope.farJumps) > 0 {
+		if err := scope.relocate(0); err != nil {
+			c.fail(err)
+		}
+	}
 	return scope
 }
 
+// appendScope appends the instructions of a finished scope to the current scope.
+func (c *Compiler) appendScope(scope *CompilationScope) {
+	parent := c.scopes[c.scopeIdx]
+	base := len(parent.Instructions)
+	if err := scope.relocate(base); err != nil {
+		c.fail(err)
+		return
+	}
+	for _, m := range scope.sourceMap {
+		m.Offset += base
+		parent.sourceMap = parent.sourceMap.Add(m)
+	}
+	parent.Instructions = append(parent.Instructions, scope.Instructions...)
+	if len(scope.locals) > len(parent.locals) {
+		// the temporaries of the appended instructions
+		parent.locals = append(parent.locals, scope.locals[len(parent.locals):]...)
+	}
+}
+
+// fail keeps the first error, that can't be returned right away.
+func (c *Compiler) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
 func (c *Compiler) isLastInstruction(opcodes ...op.Opcode) bool {
 	if len(c.currentInstructions()) == 0 {
 		return false
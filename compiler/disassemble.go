@@ -0,0 +1,203 @@
+package compiler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vknabel/zirric/op"
+	"github.com/vknabel/zirric/runtime"
+)
+
+// maxInlineValue limits the length of constants shown next to their instructions.
+const maxInlineValue = 40
+
+// Disassemble writes a readable listing of the bytecode to w.
+// It lists the top level instructions, the initializer of each global and each compiled function.
+// Constants, globals, locals and contracts are shown by their values and names,
+// jump targets are shown as labels and statements are preceded by their source positions.
+func (b *Bytecode) Disassemble(w io.Writer) error {
+	d := &disassembler{w: bufio.NewWriter(w), bytecode: b}
+
+	d.block("main", b.Instructions, b.SourceMap, b.LocalNames)
+	for id, g := range b.Globals {
+		if g == nil {
+			continue
+		}
+		d.block(fmt.Sprintf("global %d %s", id, g.Name), g.Instructions, g.sourceMap, g.localNames())
+	}
+	for id, c := range b.Constants {
+		fn, ok := c.(*runtime.CompiledFunction)
+		if !ok {
+			continue
+		}
+		locals := append(slices.Clone(fn.ParamNames), fn.LocalNames...)
+		d.block(fmt.Sprintf("constant %d %s", id, signature(fn)), fn.Instructions, fn.SourceMap, locals)
+	}
+
+	if d.err != nil {
+		return d.err
+	}
+	return d.w.Flush()
+}
+
+// String returns the listing of Disassemble.
+func (b *Bytecode) String() string {
+	var out strings.Builder
+	_ = b.Disassemble(&out)
+	return out.String()
+}
+
+type disassembler struct {
+	w        *bufio.Writer
+	err      error
+	bytecode *Bytecode
+}
+
+// instruction is a decoded instruction at an offset, nil if it could not be decoded.
+type instruction struct {
+	offset int
+	*op.Instruction
+	err error
+}
+
+func (d *disassembler) printf(format string, args ...any) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, format, args...)
+}
+
+// block lists the instructions of one function or initializer.
+func (d *disassembler) block(title string, ins op.Instructions, sourceMap op.SourceMap, locals []string) {
+	d.printf("%s:\n", title)
+
+	var decoded []instruction
+	for offset := 0; offset < len(ins); {
+		in, err := op.Decode(ins[offset:])
+		if err != nil {
+			decoded = append(decoded, instruction{offset: offset, err: err})
+			offset++
+			continue
+		}
+		decoded = append(decoded, instruction{offset: offset, Instruction: &in})
+		offset += in.Len
+	}
+
+	labels := make(map[int]string)
+	var targets []int
+	for _, in := range decoded {
+		if in.Instruction != nil && isJump(in.Opcode) {
+			targets = append(targets, in.Operands[0])
+		}
+	}
+	slices.Sort(targets)
+	for _, target := range slices.Compact(targets) {
+		labels[target] = fmt.Sprintf("L%d", len(labels))
+	}
+
+	for _, in := range decoded {
+		if label, ok := labels[in.offset]; ok {
+			d.printf("%s:\n", label)
+		}
+		if m, ok := sourceMap.Lookup(in.offset); ok && m.Offset == in.offset {
+			d.printf("  ; %s\n", m)
+		}
+		if in.Instruction == nil {
+			d.printf("  %04d ERROR: %s\n", in.offset, in.err)
+			continue
+		}
+		line := d.instruction(in, labels)
+		if comment := d.comment(in, locals); comment != "" {
+			line = fmt.Sprintf("%-24s ; %s", line, comment)
+		}
+		d.printf("  %04d %s\n", in.offset, line)
+	}
+	if label, ok := labels[len(ins)]; ok {
+		d.printf("%s:\n", label)
+	}
+	d.printf("\n")
+}
+
+// instruction formats the mnemonic and operands, jump targets as labels.
+func (d *disassembler) instruction(in instruction, labels map[int]string) string {
+	var out strings.Builder
+	if in.Wide {
+		out.WriteString("wide ")
+	}
+	out.WriteString(in.Opcode.String())
+	for i, operand := range in.Operands {
+		if label, ok := labels[operand]; ok && i == 0 && isJump(in.Opcode) {
+			fmt.Fprintf(&out, " %s", label)
+			continue
+		}
+		fmt.Fprintf(&out, " %d", operand)
+	}
+	return out.String()
+}
+
+// comment describes what the operands refer to.
+func (d *disassembler) comment(in instruction, locals []string) string {
+	switch in.Opcode {
+	case op.Const, op.GetField, op.AssertType:
+		return d.constant(in.Operands[0])
+	case op.CallNamed, op.TailCallNamed:
+		return d.constant(in.Operands[1])
+	case op.Propagate:
+		return d.constant(in.Operands[0]) + ", " + d.constant(in.Operands[1])
+	case op.AssertContract, op.MatchContract:
+		id := in.Operands[0]
+		if id >= len(d.bytecode.Contracts) {
+			return fmt.Sprintf("unknown contract %d", id)
+		}
+		return d.bytecode.Contracts[id].Subject
+	case op.GetGlobal, op.SetGlobal:
+		id := in.Operands[0]
+		if id >= len(d.bytecode.Globals) || d.bytecode.Globals[id] == nil {
+			return fmt.Sprintf("unknown global %d", id)
+		}
+		return d.bytecode.Globals[id].Name
+	case op.GetLocal, op.SetLocal:
+		id := in.Operands[0]
+		if id >= len(locals) {
+			return ""
+		}
+		return locals[id]
+	default:
+		return ""
+	}
+}
+
+// constant inspects a constant, shortening long values.
+func (d *disassembler) constant(id int) string {
+	if id >= len(d.bytecode.Constants) || d.bytecode.Constants[id] == nil {
+		return fmt.Sprintf("unknown constant %d", id)
+	}
+	value := d.bytecode.Constants[id].Inspect()
+	if utf8.RuneCountInString(value) > maxInlineValue {
+		value = string([]rune(value)[:maxInlineValue-1]) + "…"
+	}
+	return value
+}
+
+// isJump reports whether the first operand of an opcode is an address.
+func isJump(opcode op.Opcode) bool {
+	switch opcode {
+	case op.Jump, op.JumpTrue, op.JumpFalse, op.Defer:
+		return true
+	default:
+		return false
+	}
+}
+
+// signature formats the name and parameters of a function.
+func signature(fn *runtime.CompiledFunction) string {
+	params := slices.Clone(fn.ParamNames)
+	if fn.Variadic && len(params) > 0 {
+		params[len(params)-1] += "..."
+	}
+	return fmt.Sprintf("func %s(%s)", fn.Name, strings.Join(params, ", "))
+}
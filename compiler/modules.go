@@ -0,0 +1,216 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/op"
+	"github.com/vknabel/zirric/runtime"
+)
+
+// PreludeModule is the name of the module, whose `Result` enum is unwrapped by `?`.
+// It doesn't need to be imported.
+const PreludeModule = "prelude"
+
+// DeclareModule makes a module importable by its dotted name like `a.b`.
+// Imported modules must be compiled by the same compiler before the modules importing them,
+// so both share their constants and globals.
+func (c *Compiler) DeclareModule(name string, module *ast.ContextModule) {
+	if c.modules == nil {
+		c.modules = make(map[string]*ast.ContextModule)
+	}
+	c.modules[name] = module
+}
+
+// lookupModule finds a declared module.
+func (c *Compiler) lookupModule(name ast.ModuleName) (*ast.ContextModule, bool) {
+	module, ok := c.modules[ast.StaticReference(name).String()]
+	return module, ok
+}
+
+// moduleMember finds a public declaration of a module.
+func (c *Compiler) moduleMember(name ast.ModuleName, member string) (*ast.Symbol, error) {
+	module, ok := c.lookupModule(name)
+	if !ok {
+		return nil, fmt.Errorf("module %s is not declared", ast.StaticReference(name))
+	}
+	if ast.IsPrivate(member) {
+		return nil, fmt.Errorf("%s is private to module %s", member, ast.StaticReference(name))
+	}
+	sym, ok := module.Symbols.Symbols[member]
+	if !ok || sym.Decl == nil {
+		return nil, fmt.Errorf("module %s has no member %s", ast.StaticReference(name), member)
+	}
+	return sym, nil
+}
+
+// preludeMember finds a declaration of the prelude, if it is declared.
+func (c *Compiler) preludeMember(name string) (*ast.Symbol, bool) {
+	module, ok := c.modules[PreludeModule]
+	if !ok {
+		return nil, false
+	}
+	sym, ok := module.Symbols.Symbols[name]
+	return sym, ok && sym.Decl != nil
+}
+
+// resolve finds the original symbol for name.
+// Imported members resolve to their declaration within the imported module.
+func (c *Compiler) resolve(name string) (*ast.Symbol, bool) {
+	sym, ok := c.scopes[c.scopeIdx].symbols.Resolve(name)
+	if !ok {
+		return nil, false
+	}
+	member, ok := sym.Decl.(*ast.DeclImportMember)
+	if !ok {
+		return sym, true
+	}
+	imported, err := c.moduleMember(member.ModuleName, member.Name.Value)
+	return imported, err == nil
+}
+
+// reserveImport checks, that an import refers to a declared module and its public members.
+// Imports do not occupy constants or globals on their own.
+// The `module` declaration refers to the value of the declaring module.
+func (c *Compiler) reserveImport(sym *ast.Symbol) error {
+	switch decl := sym.Decl.(type) {
+	case *ast.DeclImport:
+		if _, ok := c.lookupModule(decl.ModuleName); !ok {
+			return fmt.Errorf("module %s is not declared", ast.StaticReference(decl.ModuleName))
+		}
+		return nil
+	case *ast.DeclImportMember:
+		_, err := c.moduleMember(decl.ModuleName, decl.Name.Value)
+		return err
+	case *ast.DeclModule:
+		id := c.moduleValue(moduleTable(c.scopes[c.scopeIdx].symbols))
+		sym.ConstantId = &id
+		return nil
+	default:
+		return fmt.Errorf("unknown import %T", decl)
+	}
+}
+
+// importedModuleTable returns the table of an imported module.
+func (c *Compiler) importedModuleTable(decl *ast.DeclImport) (*ast.SymbolTable, error) {
+	module, ok := c.lookupModule(decl.ModuleName)
+	if !ok {
+		return nil, fmt.Errorf("module %s is not declared", ast.StaticReference(decl.ModuleName))
+	}
+	return module.Symbols, nil
+}
+
+// importedModule returns the module of `alias` in accesses like `alias.member`.
+func (c *Compiler) importedModule(target ast.Expr) (ast.ModuleName, bool) {
+	ident, ok := target.(*ast.ExprIdentifier)
+	if !ok {
+		return nil, false
+	}
+	sym, ok := c.scopes[c.scopeIdx].symbols.Resolve(ident.Name.Value)
+	if !ok {
+		return nil, false
+	}
+	decl, ok := sym.Decl.(*ast.DeclImport)
+	if !ok {
+		return nil, false
+	}
+	return decl.ModuleName, true
+}
+
+// compileModuleMember loads a declaration of an imported module.
+// Its constants and globals have been reserved when the module was compiled.
+func (c *Compiler) compileModuleMember(module ast.ModuleName, name ast.Identifier) error {
+	sym, err := c.moduleMember(module, name.Value)
+	if err != nil {
+		return err
+	}
+	switch sym.Decl.(type) {
+	case *ast.DeclFunc, *ast.DeclData, *ast.DeclEnum, *ast.DeclExternFunc, *ast.DeclAnnotation:
+		if sym.ConstantId == nil {
+			return fmt.Errorf("%s of module %s is not compiled yet", name.Value, ast.StaticReference(module))
+		}
+		c.emit(op.Const, *sym.ConstantId)
+		return nil
+	case *ast.DeclVariable:
+		if sym.GlobalId == nil {
+			return fmt.Errorf("%s of module %s is not compiled yet", name.Value, ast.StaticReference(module))
+		}
+		c.emit(op.GetGlobal, *sym.GlobalId)
+		return nil
+	default:
+		return fmt.Errorf("%s of module %s has unknown declaration type %T", name.Value, ast.StaticReference(module), sym.Decl)
+	}
+}
+
+// moduleValue returns the constant id of the module value of a module table.
+// The constant is reserved on first use and filled by exportModule.
+func (c *Compiler) moduleValue(table *ast.SymbolTable) int {
+	if id, ok := c.moduleValues[table]; ok {
+		return id
+	}
+	if c.moduleValues == nil {
+		c.moduleValues = make(map[*ast.SymbolTable]int)
+	}
+	id := c.addConstant(runtime.MakeModule(""))
+	c.moduleValues[table] = id
+	return id
+}
+
+// moduleTable returns the table of the module, that a source file table belongs to.
+func moduleTable(file *ast.SymbolTable) *ast.SymbolTable {
+	if file.Parent != nil {
+		return file.Parent
+	}
+	return file
+}
+
+// exportModule fills the module value with the public declarations of the module
+// and the annotations of its `module` declarations.
+func (c *Compiler) exportModule(table *ast.SymbolTable, files []*ast.SymbolTable) {
+	mod := c.constants[c.moduleValue(table)].(*runtime.Module)
+	for name, module := range c.modules {
+		if module.Symbols == table {
+			mod.Name = name
+		}
+	}
+	for _, file := range files {
+		for _, sym := range file.Symbols {
+			decl, ok := sym.Decl.(*ast.DeclModule)
+			if !ok || sym.Original() != sym {
+				continue
+			}
+			if mod.Name == "" {
+				mod.Name = decl.Name.Value
+			}
+			for _, inst := range decl.Annotations {
+				mod.Annotations = append(mod.Annotations, c.annotationValue(inst))
+			}
+		}
+	}
+
+	for name, sym := range table.Symbols {
+		if sym.Original() != sym || ast.IsPrivate(name) {
+			continue
+		}
+		switch sym.Decl.(type) {
+		case *ast.DeclFunc, *ast.DeclData, *ast.DeclEnum, *ast.DeclExternFunc, *ast.DeclAnnotation:
+			mod.Members[name] = c.constants[*sym.ConstantId]
+		case *ast.DeclVariable:
+			if sym.GlobalId != nil {
+				mod.Globals[name] = *sym.GlobalId
+			}
+		}
+	}
+}
+
+// annotationValue evaluates the literal arguments of an annotation instance.
+func (c *Compiler) annotationValue(inst *ast.DeclAnnotationInstance) runtime.Annotation {
+	anno := runtime.Annotation{
+		Name:      inst.Reference.String(),
+		Arguments: make([]runtime.RuntimeValue, len(inst.Arguments)),
+	}
+	for i, arg := range inst.Arguments {
+		anno.Arguments[i], _ = c.literalValue(arg)
+	}
+	return anno
+}
@@ -0,0 +1,420 @@
+package compiler
+
+import (
+	"github.com/vknabel/zirric/op"
+	"github.com/vknabel/zirric/runtime"
+)
+
+// OptimizationLevel selects the optimizations applied to each compiled function and initializer.
+type OptimizationLevel int
+
+const (
+	// OptimizeNone emits the instructions as they are compiled from the sources.
+	OptimizeNone OptimizationLevel = iota
+	// OptimizePeephole threads jumps and removes values, that are pushed and popped right away.
+	OptimizePeephole
+	// OptimizeFull additionally folds constant operations and removes unreachable branches.
+	OptimizeFull
+)
+
+// SetOptimizationLevel selects the optimizations of the compiler, OptimizeNone by default.
+// Must be called before compiling.
+func (c *Compiler) SetOptimizationLevel(level OptimizationLevel) {
+	c.optimization = level
+}
+
+// optimize rewrites the instructions of a finished scope until no optimization applies anymore.
+// Removed instructions pass their source mappings on to the following instruction.
+// Values popped by top level statements are kept, as any of them may be the result of the program.
+func (c *Compiler) optimize(s *CompilationScope) error {
+	b, err := s.decode()
+	if err != nil {
+		return err
+	}
+	o := &optimizer{c: c, block: b}
+	for changed := true; changed; {
+		changed = false
+		if c.optimization >= OptimizeFull {
+			changed = o.foldConstants() || changed
+			changed = o.eliminateDeadBranches() || changed
+		}
+		changed = o.threadJumps() || changed
+		if !s.topLevel {
+			changed = o.removePushPop() || changed
+		}
+	}
+	return s.encode(b, 0)
+}
+
+type optimizer struct {
+	c *Compiler
+	*block
+}
+
+// entries reports which instructions can be reached other than by falling through.
+// The start of each deferred block is entered, when the frame is left.
+func (o *optimizer) entries() []bool {
+	entries := make([]bool, len(o.ins)+1)
+	for i, target := range o.targets {
+		if target >= 0 {
+			entries[target] = true
+		}
+		if o.ins[i].Opcode == op.Defer {
+			entries[i+1] = true
+		}
+	}
+	return entries
+}
+
+// remove removes all instructions, that are not kept.
+// Jumps and source mappings to removed instructions move on to the next kept instruction.
+func (o *optimizer) remove(keep []bool) {
+	indices := make([]int, len(o.ins)+1)
+	n := 0
+	for i := range o.ins {
+		indices[i] = n
+		if keep[i] {
+			n++
+		}
+	}
+	indices[len(o.ins)] = n
+
+	ins := make([]op.Instruction, 0, n)
+	targets := make([]int, 0, n)
+	for i := range o.ins {
+		if !keep[i] {
+			continue
+		}
+		target := o.targets[i]
+		if target >= 0 {
+			target = indices[target]
+		}
+		ins = append(ins, o.ins[i])
+		targets = append(targets, target)
+	}
+
+	var sourceMap op.SourceMap
+	for _, m := range o.sourceMap {
+		m.Offset = indices[m.Offset]
+		sourceMap = sourceMap.Add(m)
+	}
+
+	o.ins = ins
+	o.targets = targets
+	o.sourceMap = sourceMap
+}
+
+// replace replaces the instruction at i, which must not be a jump.
+func (o *optimizer) replace(i int, opcode op.Opcode, operands ...int) {
+	o.ins[i] = op.Instruction{Opcode: opcode, Operands: operands}
+	o.targets[i] = -1
+}
+
+// constant returns the literal pushed by the instruction at i.
+func (o *optimizer) constant(i int) (runtime.RuntimeValue, bool) {
+	ins := o.ins[i]
+	switch ins.Opcode {
+	case op.ConstTrue:
+		return runtime.Bool(true), true
+	case op.ConstFalse:
+		return runtime.Bool(false), true
+	case op.ConstNull:
+		return runtime.Null{}, true
+	case op.Const:
+		switch v := o.c.constants[ins.Operands[0]].(type) {
+		case runtime.Int, runtime.Float, runtime.String, runtime.Char:
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// replaceConstant replaces the instruction at i by pushing a literal.
+func (o *optimizer) replaceConstant(i int, v runtime.RuntimeValue) {
+	switch v {
+	case runtime.Bool(true):
+		o.replace(i, op.ConstTrue)
+	case runtime.Bool(false):
+		o.replace(i, op.ConstFalse)
+	default:
+		o.replace(i, op.Const, o.c.addConstant(v))
+	}
+}
+
+// foldConstants evaluates operations on literals at compile time.
+// Operations, that would fail at runtime, are kept.
+// Results are folded again with the following operations, so nested expressions fold at once.
+func (o *optimizer) foldConstants() bool {
+	entries := o.entries()
+	keep := keepAll(len(o.ins))
+	changed := false
+	// the indices of the kept instructions so far
+	var kept []int
+	for i := range o.ins {
+		kept = append(kept, i)
+		n := len(kept)
+		if entries[i] || n < 2 {
+			continue
+		}
+		first, ok := o.constant(kept[n-2])
+		if !ok {
+			continue
+		}
+		if v, ok := foldUnary(o.ins[i].Opcode, first); ok {
+			o.replaceConstant(kept[n-2], v)
+			keep[i] = false
+			kept = kept[:n-1]
+			changed = true
+			continue
+		}
+		if n < 3 || entries[kept[n-2]] {
+			continue
+		}
+		lhs, ok := o.constant(kept[n-3])
+		if !ok {
+			continue
+		}
+		if v, ok := foldBinary(o.ins[i].Opcode, lhs, first); ok {
+			o.replaceConstant(kept[n-3], v)
+			keep[kept[n-2]] = false
+			keep[i] = false
+			kept = kept[:n-2]
+			changed = true
+		}
+	}
+	if changed {
+		o.remove(keep)
+	}
+	return changed
+}
+
+func foldUnary(opcode op.Opcode, v runtime.RuntimeValue) (runtime.RuntimeValue, bool) {
+	switch opcode {
+	case op.Negate:
+		switch v := v.(type) {
+		case runtime.Int:
+			return -v, true
+		case runtime.Float:
+			return -v, true
+		}
+	case op.Invert:
+		if v, ok := v.(runtime.Bool); ok {
+			return !v, true
+		}
+	}
+	return nil, false
+}
+
+func foldBinary(opcode op.Opcode, lhs, rhs runtime.RuntimeValue) (runtime.RuntimeValue, bool) {
+	switch opcode {
+	case op.Equal:
+		// literals are only equal to literals of the same kind
+		return runtime.Bool(lhs == rhs), true
+	case op.NotEqual:
+		return runtime.Bool(lhs != rhs), true
+	case op.Add, op.Sub, op.Mul, op.Div,
+		op.GreaterThan, op.GreaterThanOrEqual,
+		op.LessThan, op.LessThanOrEqual:
+	default:
+		return nil, false
+	}
+
+	l, lok := lhs.(runtime.Int)
+	r, rok := rhs.(runtime.Int)
+	if lok && rok {
+		return foldInt(opcode, l, r)
+	}
+	lf, lok := toFloat(lhs)
+	rf, rok := toFloat(rhs)
+	if lok && rok {
+		return foldFloat(opcode, lf, rf)
+	}
+	return nil, false
+}
+
+func toFloat(v runtime.RuntimeValue) (runtime.Float, bool) {
+	switch v := v.(type) {
+	case runtime.Int:
+		return runtime.Float(v), true
+	case runtime.Float:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func foldInt(opcode op.Opcode, lhs, rhs runtime.Int) (runtime.RuntimeValue, bool) {
+	switch opcode {
+	case op.Add:
+		return lhs + rhs, true
+	case op.Sub:
+		return lhs - rhs, true
+	case op.Mul:
+		return lhs * rhs, true
+	case op.Div:
+		if rhs == 0 {
+			return nil, false
+		}
+		return lhs / rhs, true
+	case op.LessThan:
+		return runtime.Bool(lhs < rhs), true
+	case op.LessThanOrEqual:
+		return runtime.Bool(lhs <= rhs), true
+	case op.GreaterThan:
+		return runtime.Bool(lhs > rhs), true
+	case op.GreaterThanOrEqual:
+		return runtime.Bool(lhs >= rhs), true
+	default:
+		return nil, false
+	}
+}
+
+func foldFloat(opcode op.Opcode, lhs, rhs runtime.Float) (runtime.RuntimeValue, bool) {
+	switch opcode {
+	case op.Add:
+		return lhs + rhs, true
+	case op.Sub:
+		return lhs - rhs, true
+	case op.Mul:
+		return lhs * rhs, true
+	case op.Div:
+		return lhs / rhs, true
+	case op.LessThan:
+		return runtime.Bool(lhs < rhs), true
+	case op.LessThanOrEqual:
+		return runtime.Bool(lhs <= rhs), true
+	case op.GreaterThan:
+		return runtime.Bool(lhs > rhs), true
+	case op.GreaterThanOrEqual:
+		return runtime.Bool(lhs >= rhs), true
+	default:
+		return nil, false
+	}
+}
+
+// eliminateDeadBranches decides conditional jumps on literals
+// and removes all instructions, that can't be reached anymore.
+func (o *optimizer) eliminateDeadBranches() bool {
+	entries := o.entries()
+	keep := keepAll(len(o.ins))
+	changed := false
+	for i := 0; i+1 < len(o.ins); i++ {
+		jump := o.ins[i+1].Opcode
+		if (jump != op.JumpTrue && jump != op.JumpFalse) || entries[i+1] {
+			continue
+		}
+		cond, ok := o.constant(i)
+		if !ok {
+			continue
+		}
+		// only false is falsy
+		taken := (cond == runtime.Bool(false)) == (jump == op.JumpFalse)
+		if taken {
+			o.ins[i] = op.Instruction{Opcode: op.Jump, Operands: []int{0}}
+			o.targets[i] = o.targets[i+1]
+		} else {
+			keep[i] = false
+		}
+		keep[i+1] = false
+		changed = true
+		i++
+	}
+	if changed {
+		o.remove(keep)
+	}
+
+	reachable := make([]bool, len(o.ins))
+	pending := []int{0}
+	for len(pending) > 0 {
+		i := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if i >= len(o.ins) || reachable[i] {
+			continue
+		}
+		reachable[i] = true
+		switch o.ins[i].Opcode {
+		case op.Jump:
+			pending = append(pending, o.targets[i])
+		case op.Return, op.Panic, op.EndDefer:
+		default:
+			pending = append(pending, i+1)
+			if o.targets[i] >= 0 {
+				pending = append(pending, o.targets[i])
+			}
+		}
+	}
+	for _, ok := range reachable {
+		if !ok {
+			o.remove(reachable)
+			return true
+		}
+	}
+	return changed
+}
+
+// threadJumps retargets jumps to unconditional jumps at their final targets
+// and removes jumps to the following instruction.
+func (o *optimizer) threadJumps() bool {
+	keep := keepAll(len(o.ins))
+	changed := false
+	for i, ins := range o.ins {
+		if ins.Opcode != op.Jump && ins.Opcode != op.JumpTrue && ins.Opcode != op.JumpFalse {
+			continue
+		}
+		target := o.targets[i]
+		visited := map[int]bool{i: true}
+		for target < len(o.ins) && o.ins[target].Opcode == op.Jump && !visited[target] {
+			visited[target] = true
+			target = o.targets[target]
+		}
+		if target != o.targets[i] {
+			o.targets[i] = target
+			changed = true
+		}
+		if target != i+1 {
+			continue
+		}
+		if ins.Opcode == op.Jump {
+			keep[i] = false
+		} else {
+			// the condition is still consumed
+			o.replace(i, op.Pop)
+		}
+		changed = true
+	}
+	if changed {
+		o.remove(keep)
+	}
+	return changed
+}
+
+// removePushPop removes values, that are popped right after they have been pushed without side effects.
+func (o *optimizer) removePushPop() bool {
+	entries := o.entries()
+	keep := keepAll(len(o.ins))
+	changed := false
+	for i := 0; i+1 < len(o.ins); i++ {
+		if o.ins[i+1].Opcode != op.Pop || entries[i+1] {
+			continue
+		}
+		switch o.ins[i].Opcode {
+		case op.Const, op.ConstTrue, op.ConstFalse, op.ConstNull, op.GetLocal, op.Dup:
+			keep[i] = false
+			keep[i+1] = false
+			changed = true
+			i++
+		}
+	}
+	if changed {
+		o.remove(keep)
+	}
+	return changed
+}
+
+func keepAll(n int) []bool {
+	keep := make([]bool, n)
+	for i := range keep {
+		keep[i] = true
+	}
+	return keep
+}
@@ -0,0 +1,133 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/vknabel/zirric/op"
+)
+
+// block holds the decoded instructions of a scope.
+// Jumps target instructions by their index, so instructions can be replaced, removed and widened,
+// before the block is encoded again.
+type block struct {
+	ins []op.Instruction
+	// the index of the instruction each jump targets, -1 for others, len(ins) for the end
+	targets []int
+	// the source mappings with the index of their first instruction as offset
+	sourceMap op.SourceMap
+}
+
+// relocate re-encodes the instructions of a finished scope to start at base within another scope.
+// Jump addresses are moved along and jumps are widened, when their addresses don't fit into narrow operands.
+// The source map stays relative to the start of the scope.
+func (s *CompilationScope) relocate(base int) error {
+	if base == 0 && len(s.farJumps) == 0 {
+		return nil
+	}
+	b, err := s.decode()
+	if err != nil {
+		return err
+	}
+	return s.encode(b, base)
+}
+
+// decode decodes the instructions of the scope and resolves the addresses of its jumps.
+func (s *CompilationScope) decode() (*block, error) {
+	var (
+		b = &block{}
+		// the index of each instruction by its offset, including the end
+		indices = make(map[int]int)
+	)
+	for offset := 0; offset < len(s.Instructions); {
+		ins, err := op.Decode(s.Instructions[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("relocate instruction %d: %w", offset, err)
+		}
+		indices[offset] = len(b.ins)
+		b.ins = append(b.ins, ins)
+		offset += ins.Len
+	}
+	indices[len(s.Instructions)] = len(b.ins)
+
+	b.targets = make([]int, len(b.ins))
+	offset := 0
+	for i, ins := range b.ins {
+		b.targets[i] = -1
+		if isJump(ins.Opcode) {
+			address := ins.Operands[0]
+			if far, ok := s.farJumps[offset]; ok {
+				address = far
+			}
+			target, ok := indices[address]
+			if !ok {
+				return nil, fmt.Errorf("relocate instruction %d: %s to %d does not target an instruction", offset, ins.Opcode, address)
+			}
+			b.targets[i] = target
+		}
+		offset += ins.Len
+	}
+
+	for _, m := range s.sourceMap {
+		i, ok := indices[m.Offset]
+		if !ok {
+			continue
+		}
+		m.Offset = i
+		b.sourceMap = append(b.sourceMap, m)
+	}
+	return b, nil
+}
+
+// encode replaces the instructions of the scope by the block starting at base.
+// As widening a jump moves all following instructions, this repeats until all addresses fit.
+func (s *CompilationScope) encode(b *block, base int) error {
+	offsets := make([]int, len(b.ins)+1)
+	wide := make([]bool, len(b.ins))
+	for i, ins := range b.ins {
+		// jumps start narrow, as their addresses are not known yet
+		if b.targets[i] < 0 {
+			wide[i] = slices.ContainsFunc(ins.Operands, func(operand int) bool {
+				return operand > op.MaxNarrowOperand
+			})
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		offset := base
+		for i, ins := range b.ins {
+			offsets[i] = offset
+			offset += op.Len(ins.Opcode, wide[i])
+		}
+		offsets[len(b.ins)] = offset
+
+		for i, target := range b.targets {
+			if target >= 0 && !wide[i] && offsets[target] > op.MaxNarrowOperand {
+				wide[i] = true
+				changed = true
+			}
+		}
+	}
+	if end := offsets[len(b.ins)]; end > op.MaxOperand {
+		return fmt.Errorf("instructions of %d bytes exceed the maximum of %d", end, op.MaxOperand)
+	}
+
+	encoded := make(op.Instructions, 0, offsets[len(b.ins)]-base)
+	for i, ins := range b.ins {
+		if b.targets[i] >= 0 {
+			ins.Operands[0] = offsets[b.targets[i]]
+		}
+		encoded = append(encoded, op.Make(ins.Opcode, ins.Operands...)...)
+	}
+
+	var sourceMap op.SourceMap
+	for _, m := range b.sourceMap {
+		m.Offset = offsets[m.Offset] - base
+		sourceMap = sourceMap.Add(m)
+	}
+
+	s.Instructions = encoded
+	s.sourceMap = sourceMap
+	s.farJumps = nil
+	return nil
+}
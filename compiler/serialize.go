@@ -0,0 +1,688 @@
+package compiler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/op"
+	"github.com/vknabel/zirric/runtime"
+)
+
+// FormatVersion is the version of the serialized bytecode format of `.zirrc` files.
+// It changes whenever the layout of the format changes.
+const FormatVersion uint16 = 4
+
+// formatMagic starts every `.zirrc` file.
+var formatMagic = [4]byte{'Z', 'I', 'R', 'C'}
+
+// ErrInvalidFormat is returned when decoding data, that is not serialized bytecode.
+var ErrInvalidFormat = errors.New("not a zirric bytecode file")
+
+// Tags of the serialized constant kinds.
+const (
+	tagNull byte = iota
+	tagBool
+	tagInt
+	tagFloat
+	tagChar
+	tagString
+	tagArray
+	tagDict
+	tagFunction
+	tagData
+	tagEnum
+	tagAnnotation
+	tagExtern
+	tagModule
+	// Marks missing defaults and contracts.
+	tagAbsent
+)
+
+// Encode serializes the bytecode into the `.zirrc` format.
+// All integers are big endian, lengths and ids are varints.
+//
+// Extern functions are only serialized by name and parameters,
+// as their implementations are bound again when decoding.
+func (b *Bytecode) Encode(w io.Writer) error {
+	enc := newEncoder(w, 0, b.Constants)
+	enc.header(formatMagic)
+	enc.bytecode(b)
+	if enc.err != nil {
+		return enc.err
+	}
+	return enc.w.Flush()
+}
+
+// newEncoder creates an encoder for constants, whose ids start at base.
+func newEncoder(w io.Writer, base int, constants []runtime.RuntimeValue) *encoder {
+	enc := &encoder{w: bufio.NewWriter(w), ids: make(map[runtime.RuntimeValue]int), externs: make(map[string]int)}
+	for i, c := range constants {
+		switch c := c.(type) {
+		case runtime.ExternFunc:
+			enc.externs[c.Name()] = base + i
+		case *runtime.CompiledFunction, *runtime.DataType, *runtime.EnumType, *runtime.AnnotationType, *runtime.Module:
+			enc.ids[c] = base + i
+		}
+	}
+	return enc
+}
+
+func (enc *encoder) header(magic [4]byte) {
+	enc.raw(magic[:])
+	enc.fixed(FormatVersion)
+	enc.fixed(op.SetVersion())
+}
+
+func (enc *encoder) bytecode(b *Bytecode) {
+	enc.bytes(b.Instructions)
+	enc.sourceMap(b.SourceMap)
+	enc.strings(b.LocalNames)
+	enc.uint(len(b.Constants))
+	for id, c := range b.Constants {
+		if err := enc.value(c); err != nil {
+			enc.fail("constant %d: %w", id, err)
+		}
+	}
+	enc.uint(len(b.Globals))
+	for _, g := range b.Globals {
+		enc.string(g.Name)
+		enc.bytes(g.Instructions)
+		enc.sourceMap(g.sourceMap)
+		enc.strings(g.localNames())
+	}
+	enc.bool(b.Result != nil)
+	if b.Result != nil {
+		enc.int(b.Result.Ok)
+		enc.int(b.Result.Err)
+		enc.int(b.Result.Error)
+	}
+	enc.uint(len(b.Contracts))
+	for _, ct := range b.Contracts {
+		enc.contract(ct)
+	}
+}
+
+// DecodeBytecode reads bytecode in the `.zirrc` format.
+// Extern functions are bound by the given plugins.
+// Neither the sources nor the AST are required to run the decoded bytecode.
+func DecodeBytecode(r io.Reader, plugins *runtime.ExternPluginRegistry) (*Bytecode, error) {
+	dec := &decoder{r: bufio.NewReader(r), plugins: plugins}
+	err := dec.header(formatMagic)
+	if err != nil {
+		return nil, err
+	}
+	b := dec.bytecode()
+	if dec.err != nil {
+		return nil, fmt.Errorf("invalid bytecode: %w", dec.err)
+	}
+	err = fillModules(dec.modules, b.Constants)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (dec *decoder) header(magic [4]byte) error {
+	var got [4]byte
+	dec.raw(got[:])
+	if dec.err != nil || got != magic {
+		return ErrInvalidFormat
+	}
+	var (
+		version uint16
+		opset   uint32
+	)
+	dec.fixed(&version)
+	dec.fixed(&opset)
+	if dec.err != nil {
+		return ErrInvalidFormat
+	}
+	if version != FormatVersion {
+		return fmt.Errorf("unsupported bytecode format version %d, want %d", version, FormatVersion)
+	}
+	if opset != op.SetVersion() {
+		return fmt.Errorf("bytecode requires opcode set %08x, have %08x", opset, op.SetVersion())
+	}
+	return nil
+}
+
+func (dec *decoder) bytecode() *Bytecode {
+	b := &Bytecode{}
+	b.Instructions = dec.bytes()
+	b.SourceMap = dec.sourceMap()
+	b.LocalNames = dec.strings()
+	b.Constants = make([]runtime.RuntimeValue, dec.length())
+	for id := range b.Constants {
+		if dec.err != nil {
+			break
+		}
+		b.Constants[id] = dec.value()
+	}
+	b.Globals = make([]*CompilationScope, dec.length())
+	for i := range b.Globals {
+		b.Globals[i] = &CompilationScope{Name: dec.string(), Instructions: dec.bytes()}
+		b.Globals[i].sourceMap = dec.sourceMap()
+		for _, name := range dec.strings() {
+			b.Globals[i].locals = append(b.Globals[i].locals, &ast.Symbol{Name: name})
+		}
+	}
+	if dec.bool() {
+		b.Result = &runtime.ResultTypes{Ok: dec.int(), Err: dec.int(), Error: dec.int()}
+	}
+	b.Contracts = make([]*runtime.Contract, dec.length())
+	for i := range b.Contracts {
+		b.Contracts[i] = dec.contract()
+	}
+	return b
+}
+
+// fillModules sets the members of decoded modules, once all constants are known.
+func fillModules(modules []decodedModule, constants []runtime.RuntimeValue) error {
+	for _, m := range modules {
+		for name, id := range m.members {
+			if id >= len(constants) {
+				return fmt.Errorf("module %s: member %s refers to unknown constant %d", m.module.Name, name, id)
+			}
+			m.module.Members[name] = constants[id]
+		}
+	}
+	return nil
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	err error
+
+	// The constant ids of functions, types and modules.
+	ids map[runtime.RuntimeValue]int
+	// The constant ids of extern functions by name.
+	externs map[string]int
+}
+
+func (enc *encoder) fail(format string, args ...any) {
+	if enc.err == nil {
+		enc.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (enc *encoder) raw(p []byte) {
+	if enc.err == nil {
+		_, enc.err = enc.w.Write(p)
+	}
+}
+
+func (enc *encoder) fixed(v any) {
+	if enc.err == nil {
+		enc.err = binary.Write(enc.w, binary.BigEndian, v)
+	}
+}
+
+func (enc *encoder) uint(v int) {
+	enc.raw(binary.AppendUvarint(nil, uint64(v)))
+}
+
+func (enc *encoder) int(v int) {
+	enc.raw(binary.AppendVarint(nil, int64(v)))
+}
+
+func (enc *encoder) bool(v bool) {
+	if v {
+		enc.raw([]byte{1})
+	} else {
+		enc.raw([]byte{0})
+	}
+}
+
+func (enc *encoder) bytes(p []byte) {
+	enc.uint(len(p))
+	enc.raw(p)
+}
+
+func (enc *encoder) string(s string) {
+	enc.bytes([]byte(s))
+}
+
+func (enc *encoder) strings(ss []string) {
+	enc.uint(len(ss))
+	for _, s := range ss {
+		enc.string(s)
+	}
+}
+
+func (enc *encoder) sourceMap(sm op.SourceMap) {
+	enc.uint(len(sm))
+	for _, m := range sm {
+		enc.uint(m.Offset)
+		enc.string(m.File)
+		enc.uint(m.Position)
+		enc.uint(m.Line)
+		enc.uint(m.Column)
+	}
+}
+
+func (enc *encoder) value(v runtime.RuntimeValue) error {
+	switch v := v.(type) {
+	case nil:
+		enc.raw([]byte{tagAbsent})
+	case runtime.Null:
+		enc.raw([]byte{tagNull})
+	case runtime.Bool:
+		enc.raw([]byte{tagBool})
+		enc.bool(bool(v))
+	case runtime.Int:
+		enc.raw([]byte{tagInt})
+		enc.int(int(v))
+	case runtime.Float:
+		enc.raw([]byte{tagFloat})
+		enc.fixed(math.Float64bits(float64(v)))
+	case runtime.Char:
+		enc.raw([]byte{tagChar})
+		enc.int(int(v))
+	case runtime.String:
+		enc.raw([]byte{tagString})
+		enc.string(string(v))
+	case runtime.Array:
+		enc.raw([]byte{tagArray})
+		return enc.values(v)
+	case runtime.Dict:
+		enc.raw([]byte{tagDict})
+		keys := make([]runtime.RuntimeValue, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// stable output for equal bytecode
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Inspect() < keys[j].Inspect() })
+		enc.uint(len(keys))
+		for _, k := range keys {
+			if err := enc.value(k); err != nil {
+				return err
+			}
+			if err := enc.value(v[k]); err != nil {
+				return err
+			}
+		}
+	case *runtime.CompiledFunction:
+		enc.raw([]byte{tagFunction})
+		enc.string(v.Name)
+		enc.bytes(v.Instructions)
+		enc.uint(v.Params)
+		enc.strings(v.ParamNames)
+		enc.bool(v.Variadic)
+		enc.uint(v.Locals)
+		enc.strings(v.LocalNames)
+		enc.sourceMap(v.SourceMap)
+		return enc.values(v.Defaults)
+	case *runtime.DataType:
+		enc.raw([]byte{tagData})
+		enc.string(v.Name)
+		enc.uint(int(v.Id))
+		enc.strings(v.Fields)
+		enc.uint(len(v.Contracts))
+		for _, ct := range v.Contracts {
+			enc.bool(ct != nil)
+			if ct != nil {
+				enc.contract(ct)
+			}
+		}
+		return enc.values(v.Defaults)
+	case *runtime.EnumType:
+		enc.raw([]byte{tagEnum})
+		enc.string(v.Name)
+		enc.uint(int(v.Id))
+		enc.uint(len(v.Cases))
+		for _, id := range v.Cases {
+			enc.uint(int(id))
+		}
+	case *runtime.AnnotationType:
+		enc.raw([]byte{tagAnnotation})
+		enc.string(v.Name)
+		enc.uint(int(v.Id))
+	case runtime.ExternFunc:
+		enc.raw([]byte{tagExtern})
+		enc.string(v.Name())
+		params := v.Parameters()
+		enc.uint(len(params))
+		for _, p := range params {
+			enc.string(p.Name)
+			enc.bool(p.Variadic)
+		}
+	case *runtime.Module:
+		enc.raw([]byte{tagModule})
+		enc.string(v.Name)
+		enc.uint(len(v.Annotations))
+		for _, anno := range v.Annotations {
+			enc.string(anno.Name)
+			if err := enc.values(anno.Arguments); err != nil {
+				return err
+			}
+		}
+		members := make(map[string]int, len(v.Members))
+		for name, member := range v.Members {
+			id, ok := enc.constantId(member)
+			if !ok {
+				return fmt.Errorf("member %s of module %s is not a constant", name, v.Name)
+			}
+			members[name] = id
+		}
+		enc.ints(members)
+		enc.ints(v.Globals)
+	default:
+		return fmt.Errorf("cannot serialize %T", v)
+	}
+	return nil
+}
+
+func (enc *encoder) values(vs []runtime.RuntimeValue) error {
+	enc.uint(len(vs))
+	for _, v := range vs {
+		if err := enc.value(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ints writes a map in the order of its keys.
+func (enc *encoder) ints(m map[string]int) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	enc.uint(len(keys))
+	for _, k := range keys {
+		enc.string(k)
+		enc.uint(m[k])
+	}
+}
+
+func (enc *encoder) constantId(v runtime.RuntimeValue) (int, bool) {
+	if ef, ok := v.(runtime.ExternFunc); ok {
+		id, ok := enc.externs[ef.Name()]
+		return id, ok
+	}
+	switch v.(type) {
+	case *runtime.CompiledFunction, *runtime.DataType, *runtime.EnumType, *runtime.AnnotationType, *runtime.Module:
+		id, ok := enc.ids[v]
+		return id, ok
+	default:
+		return 0, false
+	}
+}
+
+func (enc *encoder) contract(ct *runtime.Contract) {
+	enc.string(ct.Subject)
+	enc.uint(len(ct.Checks))
+	for _, check := range ct.Checks {
+		enc.string(check.Want)
+		enc.strings(check.Builtins)
+		enc.uint(len(check.Types))
+		for _, id := range check.Types {
+			enc.uint(int(id))
+		}
+	}
+}
+
+// maxDecodedLength guards against allocating huge slices for corrupt lengths.
+const maxDecodedLength = 1 << 24
+
+type decoder struct {
+	r       *bufio.Reader
+	err     error
+	plugins *runtime.ExternPluginRegistry
+
+	// Module members are filled once all constants have been decoded.
+	modules []decodedModule
+}
+
+type decodedModule struct {
+	module  *runtime.Module
+	members map[string]int
+}
+
+func (dec *decoder) fail(format string, args ...any) {
+	if dec.err == nil {
+		dec.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (dec *decoder) raw(p []byte) {
+	if dec.err == nil {
+		_, dec.err = io.ReadFull(dec.r, p)
+	}
+}
+
+func (dec *decoder) fixed(v any) {
+	if dec.err == nil {
+		dec.err = binary.Read(dec.r, binary.BigEndian, v)
+	}
+}
+
+func (dec *decoder) byte() byte {
+	var b [1]byte
+	dec.raw(b[:])
+	return b[0]
+}
+
+func (dec *decoder) uint() int {
+	if dec.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(dec.r)
+	if err != nil {
+		dec.err = err
+		return 0
+	}
+	if v > math.MaxInt32 {
+		dec.fail("value %d out of range", v)
+		return 0
+	}
+	return int(v)
+}
+
+// length reads the length of a slice.
+func (dec *decoder) length() int {
+	n := dec.uint()
+	if n > maxDecodedLength {
+		dec.fail("length %d out of range", n)
+		return 0
+	}
+	return n
+}
+
+func (dec *decoder) int() int {
+	if dec.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(dec.r)
+	if err != nil {
+		dec.err = err
+		return 0
+	}
+	return int(v)
+}
+
+func (dec *decoder) bool() bool {
+	return dec.byte() != 0
+}
+
+func (dec *decoder) bytes() []byte {
+	p := make([]byte, dec.length())
+	dec.raw(p)
+	return p
+}
+
+func (dec *decoder) string() string {
+	return string(dec.bytes())
+}
+
+func (dec *decoder) strings() []string {
+	ss := make([]string, dec.length())
+	for i := range ss {
+		ss[i] = dec.string()
+	}
+	return ss
+}
+
+func (dec *decoder) sourceMap() op.SourceMap {
+	var sm op.SourceMap
+	n := dec.length()
+	for i := 0; i < n && dec.err == nil; i++ {
+		sm = append(sm, op.SourceMapping{Offset: dec.uint(), File: dec.string(), Position: dec.uint(), Line: dec.uint(), Column: dec.uint()})
+	}
+	return sm
+}
+
+func (dec *decoder) value() runtime.RuntimeValue {
+	tag := dec.byte()
+	if dec.err != nil {
+		return nil
+	}
+	switch tag {
+	case tagAbsent:
+		return nil
+	case tagNull:
+		return runtime.Null{}
+	case tagBool:
+		return runtime.Bool(dec.bool())
+	case tagInt:
+		return runtime.Int(dec.int())
+	case tagFloat:
+		var bits uint64
+		dec.fixed(&bits)
+		return runtime.Float(math.Float64frombits(bits))
+	case tagChar:
+		return runtime.Char(dec.int())
+	case tagString:
+		return runtime.String(dec.string())
+	case tagArray:
+		return runtime.Array(dec.values())
+	case tagDict:
+		n := dec.length()
+		dict := make(runtime.Dict, n)
+		for i := 0; i < n && dec.err == nil; i++ {
+			k := dec.value()
+			dict[k] = dec.value()
+		}
+		return dict
+	case tagFunction:
+		fn := &runtime.CompiledFunction{Name: dec.string()}
+		fn.Instructions = dec.bytes()
+		fn.Params = dec.uint()
+		fn.ParamNames = dec.strings()
+		fn.Variadic = dec.bool()
+		fn.Locals = dec.uint()
+		fn.LocalNames = dec.strings()
+		fn.SourceMap = dec.sourceMap()
+		fn.Defaults = dec.values()
+		return fn
+	case tagData:
+		dt := &runtime.DataType{Name: dec.string(), Id: runtime.TypeId(dec.uint())}
+		dt.Fields = dec.strings()
+		if n := dec.length(); n > 0 {
+			dt.Contracts = make([]*runtime.Contract, n)
+			for i := range dt.Contracts {
+				if dec.bool() {
+					dt.Contracts[i] = dec.contract()
+				}
+			}
+		}
+		dt.Defaults = dec.values()
+		return dt
+	case tagEnum:
+		et := &runtime.EnumType{Name: dec.string(), Id: runtime.TypeId(dec.uint())}
+		if n := dec.length(); n > 0 {
+			et.Cases = make([]runtime.TypeId, n)
+			for i := range et.Cases {
+				et.Cases[i] = runtime.TypeId(dec.uint())
+			}
+		}
+		return et
+	case tagAnnotation:
+		return &runtime.AnnotationType{Name: dec.string(), Id: runtime.TypeId(dec.uint())}
+	case tagExtern:
+		return dec.extern()
+	case tagModule:
+		mod := runtime.MakeModule(dec.string())
+		n := dec.length()
+		for i := 0; i < n && dec.err == nil; i++ {
+			mod.Annotations = append(mod.Annotations, runtime.Annotation{Name: dec.string(), Arguments: dec.values()})
+		}
+		members := dec.ints()
+		for name, id := range dec.ints() {
+			mod.Globals[name] = id
+		}
+		dec.modules = append(dec.modules, decodedModule{mod, members})
+		return mod
+	default:
+		dec.fail("unknown constant tag %d", tag)
+		return nil
+	}
+}
+
+func (dec *decoder) values() []runtime.RuntimeValue {
+	n := dec.length()
+	if n == 0 {
+		return nil
+	}
+	vs := make([]runtime.RuntimeValue, n)
+	for i := range vs {
+		vs[i] = dec.value()
+	}
+	return vs
+}
+
+func (dec *decoder) ints() map[string]int {
+	n := dec.length()
+	m := make(map[string]int, n)
+	for i := 0; i < n && dec.err == nil; i++ {
+		m[dec.string()] = dec.uint()
+	}
+	return m
+}
+
+// extern binds an extern function by its name and parameters.
+// Plugins receive a declaration without a module, as no sources are available.
+func (dec *decoder) extern() runtime.RuntimeValue {
+	decl := &ast.DeclExternFunc{Name: ast.Identifier{Value: dec.string()}}
+	decl.Parameters = make([]ast.DeclParameter, dec.length())
+	for i := range decl.Parameters {
+		decl.Parameters[i].Name = ast.Identifier{Value: dec.string()}
+		decl.Parameters[i].Variadic = dec.bool()
+	}
+	if dec.err != nil {
+		return nil
+	}
+	if dec.plugins == nil {
+		dec.fail("no plugins to bind extern func %s", decl.Name.Value)
+		return nil
+	}
+	sym := &ast.Symbol{Name: decl.Name.Value, Decl: decl}
+	impl := dec.plugins.Bind(nil, sym)
+	if impl == nil {
+		dec.fail("no implementation for extern func %s", decl.Name.Value)
+	}
+	return impl
+}
+
+func (dec *decoder) contract() *runtime.Contract {
+	ct := &runtime.Contract{Subject: dec.string()}
+	ct.Checks = make([]runtime.ContractCheck, dec.length())
+	for i := range ct.Checks {
+		ct.Checks[i].Want = dec.string()
+		ct.Checks[i].Builtins = dec.strings()
+		if n := dec.length(); n > 0 {
+			ct.Checks[i].Types = make([]runtime.TypeId, n)
+			for j := range ct.Checks[i].Types {
+				ct.Checks[i].Types[j] = runtime.TypeId(dec.uint())
+			}
+		}
+	}
+	return ct
+}
@@ -0,0 +1,99 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/op"
+	"github.com/vknabel/zirric/runtime"
+)
+
+// compileSwitch runs the first case, that matches the value.
+// The value stays on the stack while the cases are tested and is popped before the matching case runs.
+// Switch expressions evaluate to null, if no case matches.
+// In tail position, each case of a switch expression returns on its own, so calls in all cases are tail calls.
+// The default case falls through to the return of the enclosing statement.
+func (c *Compiler) compileSwitch(value ast.Expr, cases []ast.SwitchCase, isExpr bool, tail bool) error {
+	err := c.Compile(value)
+	if err != nil {
+		return err
+	}
+
+	var (
+		jumpEnds   = make([]int, 0, len(cases))
+		hasDefault bool
+	)
+	for _, sc := range cases {
+		jumpNext := -1
+		if !sc.Default {
+			c.emit(op.Dup)
+			err = c.compileCasePattern(sc)
+			if err != nil {
+				return err
+			}
+			jumpNext = c.emit(op.JumpFalse, placeholderJumpAddress)
+		}
+
+		c.emit(op.Pop)
+		switch {
+		case isExpr && tail:
+			err = c.compileReturned(sc.Expr)
+		case isExpr:
+			err = c.Compile(sc.Expr)
+		default:
+			err = c.compileBlock(sc.Block)
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case tail && sc.Default:
+			// the default case falls through to the return of the enclosing statement
+		case tail:
+			c.emit(op.Return)
+		default:
+			jumpEnds = append(jumpEnds, c.emit(op.Jump, placeholderJumpAddress))
+		}
+
+		if sc.Default {
+			// all later cases are unreachable
+			hasDefault = true
+			break
+		}
+		c.changeOperand(jumpNext, len(c.currentInstructions()))
+	}
+
+	if !hasDefault {
+		c.emit(op.Pop)
+		if isExpr {
+			c.emit(op.ConstNull)
+		}
+	}
+
+	endPos := len(c.currentInstructions())
+	for _, pos := range jumpEnds {
+		c.changeOperand(pos, endPos)
+	}
+	return nil
+}
+
+// compileCasePattern replaces the value on top of the stack with whether it matches the case.
+// Type patterns are checked like contracts, other patterns by equality.
+func (c *Compiler) compileCasePattern(sc ast.SwitchCase) error {
+	if sc.Type == nil {
+		err := c.Compile(sc.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(op.Equal)
+		return nil
+	}
+
+	check, ok := c.annotationCheck(sc.Type)
+	if !ok {
+		return fmt.Errorf("unknown type in case %s", sc.Pattern())
+	}
+	id := c.addContract(&runtime.Contract{Subject: "case " + sc.Pattern(), Checks: []runtime.ContractCheck{check}})
+	c.emit(op.MatchContract, id)
+	return nil
+}
@@ -0,0 +1,27 @@
+package compiler
+
+import (
+	"errors"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/typecheck"
+)
+
+// EnableTypeCheck makes the compiler fail on values, that do not match the types declared by annotations.
+// Modules and files are checked once their names are resolved, before generating any code.
+// Must be called before compiling.
+func (c *Compiler) EnableTypeCheck() {
+	c.checkTypes = true
+}
+
+// typeCheck reports all type mismatches of a module or file at once.
+func (c *Compiler) typeCheck(node ast.Node) error {
+	if !c.checkTypes {
+		return nil
+	}
+	var errs []error
+	for _, diag := range typecheck.Check(node) {
+		errs = append(errs, diag)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,18 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/vknabel/zirric/op"
+)
+
+// Version identifies the code generation of the compiler.
+// It changes whenever the same sources compile to different bytecode.
+const Version = "0.1.0"
+
+// Fingerprint identifies the compiler version and all options, that affect the generated bytecode
+// or whether the sources compile at all.
+// Bytecode compiled by compilers with different fingerprints must not be mixed.
+func (c *Compiler) Fingerprint() string {
+	return fmt.Sprintf("zirric %s, format %d, opcodes %08x, contracts %t, type check %t, optimization %d, promoted warnings %t", Version, FormatVersion, op.SetVersion(), c.checkContracts, c.checkTypes, c.optimization, c.promoteWarnings)
+}
@@ -0,0 +1,36 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/vknabel/zirric/resolve"
+	"github.com/vknabel/zirric/token"
+)
+
+// PromoteWarnings makes the compiler fail on warnings like deprecated or unused declarations.
+// Warnings can still be suppressed per declaration like `@Suppress("deprecated")`.
+// Must be called before compiling.
+func (c *Compiler) PromoteWarnings() {
+	c.promoteWarnings = true
+}
+
+// Warnings returns the warnings of all compiled modules and files in source order per module.
+func (c *Compiler) Warnings() []resolve.Diagnostic {
+	return c.warnings
+}
+
+// warn collects a warning found while compiling or fails with it, if warnings are promoted.
+func (c *Compiler) warn(tok token.Token, summary string, format string, a ...any) error {
+	diag := resolve.Diagnostic{
+		Token:    tok,
+		Severity: resolve.SeverityWarning,
+		Summary:  summary,
+		Details:  fmt.Sprintf(format, a...),
+	}
+	if c.promoteWarnings {
+		diag.Severity = resolve.SeverityError
+		return diag
+	}
+	c.warnings = append(c.warnings, diag)
+	return nil
+}
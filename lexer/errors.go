@@ -0,0 +1,45 @@
+package lexer
+
+import (
+	"fmt"
+
+	"github.com/vknabel/zirric/token"
+)
+
+// LexError describes a malformed token.
+//
+// The span given by Offset and Length points at the offending characters,
+// which might be narrower than the whole token.
+type LexError struct {
+	Token   token.Token
+	Offset  int
+	Length  int
+	Summary string
+	// Locates the offending characters.
+	Source *token.Source
+}
+
+// Error implements error.
+func (e LexError) Error() string {
+	return fmt.Sprintf("lexical error: %s", e.Summary)
+}
+
+// Span returns the offending characters of the token.
+func (e LexError) Span() string {
+	start := e.Offset - e.Token.Source.Offset
+	return e.Token.Literal[start : start+e.Length]
+}
+
+func (l *Lexer) Errors() []LexError {
+	return l.errors
+}
+
+func (l *Lexer) detectError(tok token.Token, offset, length int, format string, a ...any) {
+	l.errors = append(l.errors, LexError{
+		Token:   tok,
+		Offset:  offset,
+		Length:  length,
+		Summary: fmt.Sprintf(format, a...),
+		Source:  l.source(offset),
+	})
+}
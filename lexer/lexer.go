@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/vknabel/zirric/registry"
@@ -14,6 +15,10 @@ type Lexer struct {
 	peekPos  int  // current reading position in input (after current char)
 	currPos  int  // current position in input (points to current char)
 	ch       byte // current char under examination
+	// the offsets, at which lines start
+	lines []int
+
+	errors []LexError
 }
 
 func New(src registry.Source) (*Lexer, error) {
@@ -24,6 +29,12 @@ func New(src registry.Source) (*Lexer, error) {
 	l := &Lexer{
 		src:   src,
 		input: string(raw),
+		lines: []int{0},
+	}
+	for i, ch := range raw {
+		if ch == '\n' {
+			l.lines = append(l.lines, i+1)
+		}
 	}
 	l.advance()
 	return l, nil
@@ -34,12 +45,12 @@ func (l *Lexer) NextToken() token.Token {
 
 	tok.Leading = l.parseLeadingDecorations()
 	l.startPos = l.currPos
-	tok.Source = token.MakeSource(string(l.src.URI()), l.currPos)
+	tok.Source = l.source(l.currPos)
 
 	switch l.ch {
 	case '!': // BANG, NEQ
 		if l.peekChar() == '=' {
-			tok = token.Token{Type: token.NEQ, Literal: "!="}
+			tok = token.Token{Type: token.NEQ, Literal: "!=", Source: tok.Source}
 			l.advance()
 		} else {
 			tok = l.newToken(token.BANG, l.ch)
@@ -48,7 +59,7 @@ func (l *Lexer) NextToken() token.Token {
 		tok = l.newToken(token.PLUS, l.ch)
 	case '-': // MINUS, new ARROW
 		if l.peekChar() == '>' {
-			tok = token.Token{Type: token.RIGHT_ARROW, Literal: "->"}
+			tok = token.Token{Type: token.RIGHT_ARROW, Literal: "->", Source: tok.Source}
 			l.advance()
 		} else {
 			tok = l.newToken(token.MINUS, l.ch)
@@ -77,33 +88,54 @@ func (l *Lexer) NextToken() token.Token {
 	case '=': // ASSIGN, EQ, ARROW
 		switch l.peekChar() {
 		case '=':
-			tok = token.Token{Type: token.EQ, Literal: "=="}
+			tok = token.Token{Type: token.EQ, Literal: "==", Source: tok.Source}
 			l.advance()
 		case '>':
-			tok = token.Token{Type: token.RIGHT_ARROW, Literal: "->"}
+			tok = token.Token{Type: token.RIGHT_ARROW, Literal: "->", Source: tok.Source}
 			l.advance()
 		default:
 			tok = l.newToken(token.ASSIGN, l.ch)
 		}
 	case '&': // AND
 		if l.peekChar() == '&' {
-			tok = token.Token{Type: token.AND, Literal: "&&"}
+			tok = token.Token{Type: token.AND, Literal: "&&", Source: tok.Source}
 			l.advance()
 		} else {
-			tok = l.newToken(token.ILLEGAL, l.ch)
+			tok = l.newIllegalToken("unexpected %q, did you mean %q?", l.ch, "&&")
 		}
 	case '|': // OR
 		if l.peekChar() == '|' {
-			tok = token.Token{Type: token.OR, Literal: "||"}
+			tok = token.Token{Type: token.OR, Literal: "||", Source: tok.Source}
 			l.advance()
 		} else {
-			tok = l.newToken(token.ILLEGAL, l.ch)
+			tok = l.newIllegalToken("unexpected %q, did you mean %q?", l.ch, "||")
+		}
+
+	case '?': // QUESTION, QUESTION_DOT, QUESTION_LBRACKET, COALESCE
+		switch l.peekChar() {
+		case '.':
+			tok = token.Token{Type: token.QUESTION_DOT, Literal: "?.", Source: tok.Source}
+			l.advance()
+		case '[':
+			tok = token.Token{Type: token.QUESTION_LBRACKET, Literal: "?[", Source: tok.Source}
+			l.advance()
+		case '?':
+			tok = token.Token{Type: token.COALESCE, Literal: "??", Source: tok.Source}
+			l.advance()
+		default:
+			tok = l.newToken(token.QUESTION, l.ch)
 		}
 
 	case ':': // COLON
 		tok = l.newToken(token.COLON, l.ch)
-	case '.': // DOT
-		tok = l.newToken(token.DOT, l.ch)
+	case '.': // DOT, ELLIPSIS
+		if strings.HasPrefix(l.input[l.currPos:], "...") {
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "...", Source: tok.Source}
+			l.advance()
+			l.advance()
+		} else {
+			tok = l.newToken(token.DOT, l.ch)
+		}
 	case ',': // COMMA
 		tok = l.newToken(token.COMMA, l.ch)
 	case '(': // LPAREN
@@ -130,6 +162,7 @@ func (l *Lexer) NextToken() token.Token {
 		if !ok {
 			tok.Type = token.ILLEGAL
 			tok.Literal = l.input[l.startPos:l.currPos]
+			l.detectError(tok, l.startPos, len(tok.Literal), "unterminated char literal")
 			break
 		}
 		tok.Literal = literal
@@ -141,10 +174,9 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal, tok.Type = l.parseNumber()
-			return tok
+			return l.parseNumber(tok)
 		} else {
-			tok = l.newToken(token.ILLEGAL, l.ch)
+			tok = l.newIllegalToken("unexpected character %q", l.ch)
 		}
 	}
 
@@ -248,70 +280,6 @@ func (l *Lexer) parseIdentifier() string {
 	return l.input[position:l.currPos]
 }
 
-func (l *Lexer) parseNumber() (string, token.TokenType) {
-	position := l.currPos
-
-	// Handle special prefixes: 0x, 0b, 0B
-	if l.ch == '0' && l.peekChar() == 'x' {
-		// Hexadecimal: 0x...
-		l.advance() // consume '0'
-		l.advance() // consume 'x'
-		for isHexDigit(l.ch) {
-			l.advance()
-		}
-		return l.input[position:l.currPos], token.INT
-	}
-
-	if l.ch == '0' && (l.peekChar() == 'b' || l.peekChar() == 'B') {
-		// Binary: 0b... or 0B...
-		l.advance() // consume '0'
-		l.advance() // consume 'b' or 'B'
-		for isBinaryDigit(l.ch) {
-			l.advance()
-		}
-		return l.input[position:l.currPos], token.INT
-	}
-
-	// Parse regular decimal number (including octal starting with 0)
-	for isDigit(l.ch) {
-		l.advance()
-	}
-
-	// Check for decimal point
-	if l.ch == '.' && isDigit(l.peekChar()) {
-		l.advance() // consume '.'
-		for isDigit(l.ch) {
-			l.advance()
-		}
-		// Check for scientific notation in float
-		if l.ch == 'e' || l.ch == 'E' {
-			l.advance() // consume 'e' or 'E'
-			if l.ch == '+' || l.ch == '-' {
-				l.advance() // consume sign
-			}
-			for isDigit(l.ch) {
-				l.advance()
-			}
-		}
-		return l.input[position:l.currPos], token.FLOAT
-	}
-
-	// Check for scientific notation in integer (e.g., 2e10)
-	if l.ch == 'e' || l.ch == 'E' {
-		l.advance() // consume 'e' or 'E'
-		if l.ch == '+' || l.ch == '-' {
-			l.advance() // consume sign
-		}
-		for isDigit(l.ch) {
-			l.advance()
-		}
-		return l.input[position:l.currPos], token.FLOAT
-	}
-
-	// Regular integer (decimal or octal)
-	return l.input[position:l.currPos], token.INT
-}
-
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
@@ -320,18 +288,29 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func isHexDigit(ch byte) bool {
-	return isDigit(ch) || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
-}
-
-func isBinaryDigit(ch byte) bool {
-	return ch == '0' || ch == '1'
+// source locates an offset of the input by its line and column.
+// Columns count bytes.
+func (l *Lexer) source(offset int) *token.Source {
+	src := token.MakeSource(string(l.src.URI()), offset)
+	line, found := slices.BinarySearch(l.lines, offset)
+	if !found {
+		line--
+	}
+	src.Line = line + 1
+	src.Column = offset - l.lines[line] + 1
+	return src
 }
 
 func (l *Lexer) newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{
 		Type:    tokenType,
 		Literal: string(ch),
-		Source:  token.MakeSource(string(l.src.URI()), l.currPos),
+		Source:  l.source(l.currPos),
 	}
 }
+
+func (l *Lexer) newIllegalToken(format string, a ...any) token.Token {
+	tok := l.newToken(token.ILLEGAL, l.ch)
+	l.detectError(tok, l.currPos, 1, format, a...)
+	return tok
+}
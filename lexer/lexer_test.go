@@ -690,6 +690,22 @@ func TestAllTokens(t *testing.T) {
 				{token.EOF, ""},
 			},
 		},
+		{
+			name:  "member of hexadecimal integer",
+			input: `0x1F.foo 0x1.8`,
+			expected: []struct {
+				expectedType    token.TokenType
+				expectedLiteral string
+			}{
+				{token.INT, "0x1F"},
+				{token.DOT, "."},
+				{token.IDENT, "foo"},
+				{token.INT, "0x1"},
+				{token.DOT, "."},
+				{token.INT, "8"},
+				{token.EOF, ""},
+			},
+		},
 		{
 			name:  "octal integer",
 			input: `0777`,
@@ -900,6 +916,59 @@ func TestAllTokens(t *testing.T) {
 				{token.EOF, ""},
 			},
 		},
+		{
+			name:  "null-safe operators",
+			input: `a?.b?[c] ?? d`,
+			expected: []struct {
+				expectedType    token.TokenType
+				expectedLiteral string
+			}{
+				{token.IDENT, "a"},
+				{token.QUESTION_DOT, "?."},
+				{token.IDENT, "b"},
+				{token.QUESTION_LBRACKET, "?["},
+				{token.IDENT, "c"},
+				{token.RBRACKET, "]"},
+				{token.COALESCE, "??"},
+				{token.IDENT, "d"},
+				{token.EOF, ""},
+			},
+		},
+		{
+			name:  "ellipsis",
+			input: `f(xs...) a.b ..`,
+			expected: []struct {
+				expectedType    token.TokenType
+				expectedLiteral string
+			}{
+				{token.IDENT, "f"},
+				{token.LPAREN, "("},
+				{token.IDENT, "xs"},
+				{token.ELLIPSIS, "..."},
+				{token.RPAREN, ")"},
+				{token.IDENT, "a"},
+				{token.DOT, "."},
+				{token.IDENT, "b"},
+				{token.DOT, "."},
+				{token.DOT, "."},
+				{token.EOF, ""},
+			},
+		},
+		{
+			name:  "propagation operator",
+			input: `f()? ?`,
+			expected: []struct {
+				expectedType    token.TokenType
+				expectedLiteral string
+			}{
+				{token.IDENT, "f"},
+				{token.LPAREN, "("},
+				{token.RPAREN, ")"},
+				{token.QUESTION, "?"},
+				{token.QUESTION, "?"},
+				{token.EOF, ""},
+			},
+		},
 		{
 			name:  "illegal and",
 			input: `&`,
@@ -1127,3 +1196,135 @@ func TestDecorativeLexer(t *testing.T) {
 		})
 	}
 }
+
+func TestNumberLiterals(t *testing.T) {
+	testCases := []struct {
+		input   string
+		tokType token.TokenType
+	}{
+		{"1_000_000", token.INT},
+		{"0x_FF", token.INT},
+		{"0XFF", token.INT},
+		{"0o755", token.INT},
+		{"0O755", token.INT},
+		{"0b1010_1010", token.INT},
+		{"0_777", token.INT},
+		{"1_000.000_1", token.FLOAT},
+		{"1e1_0", token.FLOAT},
+		{"0x1.8p3", token.FLOAT},
+		{"0x1p-2", token.FLOAT},
+		{"0X_1FFFP-16", token.FLOAT},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.input, func(t *testing.T) {
+			l, err := lexer.New(staticmodule.NewSourceString("testing:///test/test.zirr", tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tok := l.NextToken()
+			if tok.Type != tt.tokType {
+				t.Errorf("tokentype wrong. expected=%q, got=%q", tt.tokType, tok.Type)
+			}
+			if tok.Literal != tt.input {
+				t.Errorf("literal wrong. expected=%q, got=%q", tt.input, tok.Literal)
+			}
+			if errs := l.Errors(); len(errs) > 0 {
+				t.Errorf("unexpected errors: %v", errs)
+			}
+			if eof := l.NextToken(); eof.Type != token.EOF {
+				t.Errorf("expected EOF, got %q %q", eof.Type, eof.Literal)
+			}
+		})
+	}
+}
+
+func TestMalformedNumberLiterals(t *testing.T) {
+	testCases := []struct {
+		input   string
+		literal string
+		span    string
+		offset  int
+		summary string
+	}{
+		{"0x", "0x", "0x", 0, "hexadecimal literal has no digits"},
+		{"0b", "0b", "0b", 0, "binary literal has no digits"},
+		{"0o", "0o", "0o", 0, "octal literal has no digits"},
+		{"0b102", "0b102", "2", 4, `invalid digit '2' in binary literal`},
+		{"0o78", "0o78", "8", 3, `invalid digit '8' in octal literal`},
+		{"0789", "0789", "8", 2, `invalid digit '8' in octal literal`},
+		{"1e", "1e", "e", 1, "exponent has no digits"},
+		{"1.5e+", "1.5e+", "e+", 3, "exponent has no digits"},
+		{"0x1.8p", "0x1.8p", "p", 5, "exponent has no digits"},
+		{"0xFG", "0xFG", "G", 3, `invalid character 'G' in hexadecimal literal`},
+		{"123abc", "123abc", "abc", 3, `invalid character 'a' in decimal literal`},
+		{"1__000", "1__000", "_", 2, "'_' must separate successive digits"},
+		{"1000_", "1000_", "_", 4, "'_' must separate successive digits"},
+		{"1_.5", "1_.5", "_", 1, "'_' must separate successive digits"},
+		{"x 0x", "0x", "0x", 2, "hexadecimal literal has no digits"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.input, func(t *testing.T) {
+			l, err := lexer.New(staticmodule.NewSourceString("testing:///test/test.zirr", tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var tok token.Token
+			for tok = l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+				if tok.Type == token.ILLEGAL {
+					break
+				}
+			}
+			if tok.Type != token.ILLEGAL || tok.Literal != tt.literal {
+				t.Fatalf("expected ILLEGAL %q, got %q %q", tt.literal, tok.Type, tok.Literal)
+			}
+
+			errs := l.Errors()
+			if len(errs) != 1 {
+				t.Fatalf("expected exactly one error, got %v", errs)
+			}
+			if errs[0].Summary != tt.summary {
+				t.Errorf("summary wrong. expected=%q, got=%q", tt.summary, errs[0].Summary)
+			}
+			if errs[0].Offset != tt.offset {
+				t.Errorf("offset wrong. expected=%d, got=%d", tt.offset, errs[0].Offset)
+			}
+			if errs[0].Span() != tt.span {
+				t.Errorf("span wrong. expected=%q, got=%q", tt.span, errs[0].Span())
+			}
+		})
+	}
+}
+
+func TestSourcePositions(t *testing.T) {
+	input := "let a = 1\n\tb != 0b12\n"
+	l, err := lexer.New(staticmodule.NewSourceString("testing:///test/test.zirr", input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []struct {
+		literal string
+		source  string
+	}{
+		{"let", "testing:///test/test.zirr:1:1"},
+		{"a", "testing:///test/test.zirr:1:5"},
+		{"=", "testing:///test/test.zirr:1:7"},
+		{"1", "testing:///test/test.zirr:1:9"},
+		{"b", "testing:///test/test.zirr:2:2"},
+		{"!=", "testing:///test/test.zirr:2:4"},
+		{"0b12", "testing:///test/test.zirr:2:7"},
+	}
+	for _, want := range expect {
+		tok := l.NextToken()
+		if tok.Literal != want.literal || tok.Source.String() != want.source {
+			t.Errorf("expected %q at %s, got %q at %s", want.literal, want.source, tok.Literal, tok.Source)
+		}
+	}
+
+	errs := l.Errors()
+	if len(errs) != 1 || errs[0].Source.String() != "testing:///test/test.zirr:2:10" {
+		t.Errorf("expected an error at the invalid digit, got %v", errs)
+	}
+}
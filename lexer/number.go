@@ -0,0 +1,203 @@
+package lexer
+
+import (
+	"github.com/vknabel/zirric/token"
+)
+
+// parseNumber parses integer and float literals in these forms:
+//
+//	42 1_000_000       // decimal
+//	0x2A 0o52 0b101010 // hexadecimal, octal and binary
+//	0777               // legacy octal
+//	3.14 2e10 1.5e-3   // decimal floats
+//	0x1.8p3 0x1p-2     // hexadecimal floats
+//
+// A '.' after a hexadecimal literal only starts a fraction, if hexadecimal digits and a 'p' exponent follow,
+// so `0x1F.foo` is a member access of an integer.
+// Malformed literals are returned as ILLEGAL tokens and are reported as LexError.
+func (l *Lexer) parseNumber(tok token.Token) token.Token {
+	var (
+		start  = l.currPos
+		base   = 10
+		prefix byte
+		kind   = token.INT
+		digits int
+
+		errOffset = -1
+		errLength int
+		errFormat string
+		errArgs   []any
+	)
+	fail := func(offset, length int, format string, a ...any) {
+		if errOffset >= 0 && errOffset <= offset {
+			return
+		}
+		errOffset, errLength, errFormat, errArgs = offset, length, format, a
+	}
+
+	if l.ch == '0' {
+		switch lower(l.peekChar()) {
+		case 'x':
+			base, prefix = 16, 'x'
+		case 'o':
+			base, prefix = 8, 'o'
+		case 'b':
+			base, prefix = 2, 'b'
+		}
+		if prefix != 0 {
+			l.advance() // consume '0'
+			l.advance() // consume prefix
+		}
+	}
+
+	digits, invalid := l.scanDigits(base)
+	if invalid >= 0 && prefix != 0 {
+		fail(invalid, 1, "invalid digit %q in %s literal", l.input[invalid], baseName(base))
+	}
+
+	if l.ch == '.' && (base == 10 && isDigit(l.peekChar()) || base == 16 && l.hexFractionFollows()) {
+		kind = token.FLOAT
+		l.advance() // consume '.'
+		fraction, _ := l.scanDigits(base)
+		digits += fraction
+	}
+	if prefix != 0 && digits == 0 {
+		fail(start, l.currPos-start, "%s literal has no digits", baseName(base))
+	}
+
+	if exp := lower(l.ch); base == 10 && exp == 'e' || base == 16 && exp == 'p' {
+		kind = token.FLOAT
+		expStart := l.currPos
+		l.advance() // consume 'e' or 'p'
+		if l.ch == '+' || l.ch == '-' {
+			l.advance() // consume sign
+		}
+		if n, _ := l.scanDigits(10); n == 0 {
+			fail(expStart, l.currPos-expStart, "exponent has no digits")
+		}
+	}
+
+	if base == 10 && kind == token.INT && l.input[start] == '0' {
+		for i := start; i < l.currPos; i++ {
+			if l.input[i] == '8' || l.input[i] == '9' {
+				fail(i, 1, "invalid digit %q in octal literal", l.input[i])
+				break
+			}
+		}
+	}
+
+	if isLetter(l.ch) || isDigit(l.ch) {
+		trailingStart := l.currPos
+		for isLetter(l.ch) || isDigit(l.ch) {
+			l.advance()
+		}
+		fail(trailingStart, l.currPos-trailingStart, "invalid character %q in %s literal", l.input[trailingStart], baseName(base))
+	}
+
+	tok.Literal = l.input[start:l.currPos]
+	tok.Type = kind
+
+	if i := invalidSeparator(tok.Literal); i >= 0 {
+		fail(start+i, 1, "'_' must separate successive digits")
+	}
+	if errOffset >= 0 {
+		tok.Type = token.ILLEGAL
+		l.detectError(tok, errOffset, errLength, errFormat, errArgs...)
+	}
+	return tok
+}
+
+// hexFractionFollows reports whether the current '.' is followed by hexadecimal digits and a 'p' exponent.
+func (l *Lexer) hexFractionFollows() bool {
+	i := l.peekPos
+	if i >= len(l.input) || !isHexDigit(l.input[i]) {
+		return false
+	}
+	for i < len(l.input) && (isHexDigit(l.input[i]) || l.input[i] == '_') {
+		i++
+	}
+	return i < len(l.input) && lower(l.input[i]) == 'p'
+}
+
+// scanDigits consumes digits of the given base and '_' separators.
+// Decimal digits exceeding the base are consumed as well and the offset of the first one is returned.
+func (l *Lexer) scanDigits(base int) (count int, invalid int) {
+	invalid = -1
+	for {
+		switch {
+		case l.ch == '_':
+		case base == 16 && isHexDigit(l.ch):
+			count++
+		case base != 16 && isDigit(l.ch):
+			if int(l.ch-'0') >= base && invalid < 0 {
+				invalid = l.currPos
+			}
+			count++
+		default:
+			return count, invalid
+		}
+		l.advance()
+	}
+}
+
+// invalidSeparator returns the index of the first misplaced '_' in a number literal or -1.
+// Separators are only allowed between successive digits or between a base prefix and a digit.
+func invalidSeparator(literal string) int {
+	var (
+		prefix   byte
+		previous byte = '.' // one of '_', '0' (any digit) or '.' (anything else)
+		i        int
+	)
+
+	// a base prefix counts as a digit
+	if len(literal) >= 2 && literal[0] == '0' {
+		prefix = lower(literal[1])
+		if prefix == 'x' || prefix == 'o' || prefix == 'b' {
+			previous = '0'
+			i = 2
+		}
+	}
+
+	for ; i < len(literal); i++ {
+		ch := literal[i]
+		switch {
+		case ch == '_':
+			if previous != '0' {
+				return i
+			}
+			previous = '_'
+		case isDigit(ch) || prefix == 'x' && isHexDigit(ch):
+			previous = '0'
+		default:
+			if previous == '_' {
+				return i - 1
+			}
+			previous = '.'
+		}
+	}
+	if previous == '_' {
+		return len(literal) - 1
+	}
+	return -1
+}
+
+func baseName(base int) string {
+	switch base {
+	case 2:
+		return "binary"
+	case 8:
+		return "octal"
+	case 16:
+		return "hexadecimal"
+	default:
+		return "decimal"
+	}
+}
+
+func lower(ch byte) byte {
+	return ('a' - 'A') | ch
+}
+
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+}
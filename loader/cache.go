@@ -0,0 +1,309 @@
+package loader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/vknabel/zirric/compiler"
+	"github.com/vknabel/zirric/registry"
+	"github.com/vknabel/zirric/world"
+)
+
+// Cache stores the compiled artifacts of modules,
+// so unchanged modules are neither parsed nor compiled again.
+// It produces the following structure:
+//
+//	<root>/
+//	├── imports/
+//	│   └── <source hash>         // the modules imported by the sources
+//	├── modules/
+//	│   └── <module hash>.zirrm   // the artifact of a compiled module
+//	└── programs/
+//	    └── <program hash>        // the module hashes of a program in compilation order
+//
+// A source hash covers the name and all files of a module.
+// A module hash covers the fingerprint of the compiler, the source hash of the module
+// and the module hash of the module compiled right before,
+// as modules share their constants and globals with all modules compiled before.
+// Once a module changes, it and all modules compiled after it are compiled again.
+// A program hash covers the source hashes of all modules, that are loaded transitively,
+// including the prelude, and the fingerprint of the compiler.
+type Cache struct {
+	fs billy.Filesystem
+}
+
+// NewCache creates a cache within root of the filesystem of the world.
+func NewCache(w world.World, root string) (*Cache, error) {
+	fs, err := w.FS.Chroot(root)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{fs: fs}, nil
+}
+
+// Build returns the bytecode of the root package.
+// If all modules are cached, nothing is parsed.
+// Otherwise the package is loaded, the artifacts of all cached modules
+// up to the first changed one are restored and the remaining modules are compiled with c and stored.
+// The compiler must not have compiled anything else before.
+// Warnings are only reported for modules, that are actually compiled.
+func (l *Loader) Build(root string, c *compiler.Compiler, cache *Cache) (*compiler.Bytecode, error) {
+	h := l.hasher(cache, c.Fingerprint())
+	if key, ok := h.program(root); ok {
+		artifacts, err := cache.program(key, c)
+		if err == nil && c.Restore(artifacts...) == nil {
+			return c.Bytecode(), nil
+		}
+		// corrupt or incompatible entries are compiled again
+	}
+
+	program, err := l.Load(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, mod := range program.Modules {
+		c.DeclareModule(mod.Name, mod.Context)
+	}
+
+	var (
+		keys      = make([]string, len(program.Modules))
+		previous  string
+		restoring = true
+	)
+	for i, mod := range program.Modules {
+		sources, err := h.sources(mod.Name)
+		if err != nil {
+			return nil, err
+		}
+		err = cache.write(path.Join("imports", sources), []byte(strings.Join(mod.Imports, "\n")))
+		if err != nil {
+			return nil, fmt.Errorf("cache: %w", err)
+		}
+		keys[i] = h.artifact(previous, sources)
+		previous = keys[i]
+
+		if restoring {
+			artifact, err := cache.artifact(keys[i], c)
+			if err == nil && c.Restore(artifact) == nil {
+				continue
+			}
+			restoring = false
+		}
+		artifact, err := c.CompileModule(mod.Name)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", mod.Name, err)
+		}
+		var buf bytes.Buffer
+		err = artifact.Encode(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("cache: %w", err)
+		}
+		err = cache.write(path.Join("modules", keys[i]+".zirrm"), buf.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("cache: %w", err)
+		}
+	}
+
+	key, ok := h.program(root)
+	if !ok {
+		return nil, fmt.Errorf("cache: no hash for package %s", root)
+	}
+	err = cache.write(path.Join("programs", key), []byte(strings.Join(keys, "\n")))
+	if err != nil {
+		return nil, fmt.Errorf("cache: %w", err)
+	}
+	return c.Bytecode(), nil
+}
+
+// program reads the artifacts of all modules of a program in compilation order.
+func (cache *Cache) program(key string, c *compiler.Compiler) ([]*compiler.ModuleArtifact, error) {
+	data, err := util.ReadFile(cache.fs, path.Join("programs", key))
+	if err != nil {
+		return nil, err
+	}
+	var artifacts []*compiler.ModuleArtifact
+	for _, module := range strings.Split(string(data), "\n") {
+		artifact, err := cache.artifact(module, c)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
+// artifact reads the artifact of a compiled module.
+func (cache *Cache) artifact(key string, c *compiler.Compiler) (*compiler.ModuleArtifact, error) {
+	f, err := cache.fs.Open(path.Join("modules", key+".zirrm"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return compiler.DecodeModuleArtifact(f, c.Plugins())
+}
+
+// imports returns the cached imports of the sources of a module.
+func (cache *Cache) imports(hash string) ([]string, bool) {
+	data, err := util.ReadFile(cache.fs, path.Join("imports", hash))
+	if err != nil {
+		return nil, false
+	}
+	if len(data) == 0 {
+		return nil, true
+	}
+	return strings.Split(string(data), "\n"), true
+}
+
+// write replaces a file at once, so concurrent runs never read partial entries.
+func (cache *Cache) write(name string, data []byte) error {
+	dir := path.Dir(name)
+	err := cache.fs.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	tmp, err := util.TempFile(cache.fs, dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Join(err, cache.fs.Remove(tmp.Name()))
+	}
+	return cache.fs.Rename(tmp.Name(), name)
+}
+
+// hasher derives the hashes of modules without parsing them.
+type hasher struct {
+	loader      *Loader
+	cache       *Cache
+	fingerprint string
+
+	sourceHashes map[string]string
+	moduleHashes map[string]string
+	visiting     map[string]bool
+}
+
+func (l *Loader) hasher(cache *Cache, fingerprint string) *hasher {
+	return &hasher{
+		loader:       l,
+		cache:        cache,
+		fingerprint:  fingerprint,
+		sourceHashes: make(map[string]string),
+		moduleHashes: make(map[string]string),
+		visiting:     make(map[string]bool),
+	}
+}
+
+// program hashes all modules of the root package and the prelude.
+// Reports false, if any module, that is loaded transitively, has not been cached yet.
+func (h *hasher) program(root string) (string, bool) {
+	mods, err := h.loader.packageModules(root)
+	if err != nil {
+		return "", false
+	}
+	names := make([]string, 0, len(mods))
+	for name := range mods {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if _, ok := h.loader.packages[compiler.PreludeModule]; ok {
+		// the prelude is loaded and used by the compiler, even if no module imports it
+		names = append([]string{compiler.PreludeModule}, names...)
+	}
+
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n%s\n", h.fingerprint, root)
+	for _, name := range names {
+		hash, ok := h.module(name)
+		if !ok {
+			return "", false
+		}
+		fmt.Fprintf(sum, "%s %s\n", name, hash)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), true
+}
+
+// module hashes the sources of a module and the hashes of its imports.
+func (h *hasher) module(name string) (string, bool) {
+	if hash, ok := h.moduleHashes[name]; ok {
+		return hash, true
+	}
+	if h.visiting[name] {
+		// import cycles are reported when loading
+		return "", false
+	}
+	h.visiting[name] = true
+	defer delete(h.visiting, name)
+
+	sources, err := h.sources(name)
+	if err != nil {
+		return "", false
+	}
+	imports, ok := h.cache.imports(sources)
+	if !ok {
+		return "", false
+	}
+
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n", sources)
+	for _, imp := range imports {
+		hash, ok := h.module(imp)
+		if !ok {
+			return "", false
+		}
+		fmt.Fprintf(sum, "%s %s\n", imp, hash)
+	}
+	hash := hex.EncodeToString(sum.Sum(nil))
+	h.moduleHashes[name] = hash
+	return hash, true
+}
+
+// artifact hashes a module by its sources and the hash of the module compiled before.
+func (h *hasher) artifact(previous string, sources string) string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n%s\n%s\n", h.fingerprint, previous, sources)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// sources hashes the name and all files of a module.
+func (h *hasher) sources(name string) (string, error) {
+	if hash, ok := h.sourceHashes[name]; ok {
+		return hash, nil
+	}
+	mod, err := h.loader.module(name)
+	if err != nil {
+		return "", err
+	}
+	srcs, err := mod.Sources()
+	if err != nil {
+		return "", fmt.Errorf("module %s: %w", name, err)
+	}
+	slices.SortFunc(srcs, func(lhs, rhs registry.Source) int {
+		return strings.Compare(string(lhs.URI()), string(rhs.URI()))
+	})
+
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n", name)
+	for _, src := range srcs {
+		data, err := src.Read()
+		if err != nil {
+			return "", fmt.Errorf("module %s: %w", name, err)
+		}
+		fmt.Fprintf(sum, "%s %d\n", src.URI(), len(data))
+		sum.Write(data)
+	}
+	hash := hex.EncodeToString(sum.Sum(nil))
+	h.sourceHashes[name] = hash
+	return hash, nil
+}
@@ -0,0 +1,237 @@
+// Package loader discovers the modules, that are transitively imported by a root package,
+// and compiles them in dependency order.
+//
+// Modules are imported by the name of their package followed by the path within the package.
+// Given a package `app`, `import app` refers to its root directory
+// and `import app.views` to the module in `views/`.
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/compiler"
+	"github.com/vknabel/zirric/parser"
+	"github.com/vknabel/zirric/registry"
+	"github.com/vknabel/zirric/token"
+)
+
+// Module is a parsed module and the modules it imports.
+type Module struct {
+	Name    string
+	Context *ast.ContextModule
+	Imports []string
+}
+
+// Program contains all loaded modules in dependency order.
+// Each module succeeds the modules it imports.
+type Program struct {
+	Modules []*Module
+}
+
+// ImportCycleError reports modules, that import each other.
+type ImportCycleError struct {
+	// The import, that closes the cycle.
+	Token token.Token
+	// The module names along the cycle, starting and ending with the same module.
+	Cycle []string
+}
+
+// Error implements error.
+func (e ImportCycleError) Error() string {
+	return fmt.Sprintf("import cycle: %s", strings.Join(e.Cycle, " -> "))
+}
+
+type loadState int
+
+const (
+	unvisited loadState = iota
+	loading
+	loaded
+)
+
+// Loader resolves module names to the modules of the given packages.
+type Loader struct {
+	packages map[string]registry.ResolvedPackage
+	modules  map[string]map[string]registry.ResolvedModule
+
+	states  map[string]loadState
+	stack   []string
+	program *Program
+}
+
+// New creates a loader for packages by their import name.
+func New(packages map[string]registry.ResolvedPackage) *Loader {
+	return &Loader{
+		packages: packages,
+		modules:  make(map[string]map[string]registry.ResolvedModule),
+	}
+}
+
+// Load parses all modules of the root package and all modules they import transitively.
+// If a prelude package is given, its root module is loaded first.
+func (l *Loader) Load(root string) (*Program, error) {
+	l.states = make(map[string]loadState)
+	l.stack = nil
+	l.program = &Program{}
+
+	mods, err := l.packageModules(root)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(mods))
+	for name := range mods {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if _, ok := l.packages[compiler.PreludeModule]; ok {
+		// the prelude precedes all modules, even if they don't import it
+		names = append([]string{compiler.PreludeModule}, names...)
+	}
+
+	for _, name := range names {
+		err := l.load(name, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return l.program, nil
+}
+
+func (l *Loader) load(name string, importedBy *ast.DeclImport) error {
+	switch l.states[name] {
+	case loaded:
+		return nil
+	case loading:
+		start := slices.Index(l.stack, name)
+		cycle := append(slices.Clone(l.stack[start:]), name)
+		return ImportCycleError{Token: importedBy.Token, Cycle: cycle}
+	}
+
+	resolved, err := l.module(name)
+	if err != nil {
+		if importedBy != nil {
+			return fmt.Errorf("%s, imported by %s", err, l.stack[len(l.stack)-1])
+		}
+		return err
+	}
+
+	l.states[name] = loading
+	l.stack = append(l.stack, name)
+
+	mp := parser.NewModuleParse(resolved)
+	ctx, err := mp.Parse(resolved)
+	if err != nil {
+		return fmt.Errorf("module %s: %w", name, err)
+	}
+	var errs []error
+	for _, perr := range mp.Errors() {
+		errs = append(errs, perr)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("module %s: %w", name, errors.Join(errs...))
+	}
+
+	mod := &Module{Name: name, Context: ctx}
+	for _, imp := range imports(ctx) {
+		dependency := ast.StaticReference(imp.ModuleName).String()
+		if !slices.Contains(mod.Imports, dependency) {
+			mod.Imports = append(mod.Imports, dependency)
+		}
+		err := l.load(dependency, imp)
+		if err != nil {
+			return err
+		}
+	}
+
+	l.stack = l.stack[:len(l.stack)-1]
+	l.states[name] = loaded
+	l.program.Modules = append(l.program.Modules, mod)
+	return nil
+}
+
+// module finds a module by the name of its package followed by its path.
+func (l *Loader) module(name string) (registry.ResolvedModule, error) {
+	pkg, _, _ := strings.Cut(name, ".")
+	mods, err := l.packageModules(pkg)
+	if err != nil {
+		return nil, err
+	}
+	mod, ok := mods[name]
+	if !ok {
+		return nil, fmt.Errorf("module %s not found in package %s", name, pkg)
+	}
+	return mod, nil
+}
+
+// packageModules discovers the modules of a package once and names them.
+func (l *Loader) packageModules(pkg string) (map[string]registry.ResolvedModule, error) {
+	if mods, ok := l.modules[pkg]; ok {
+		return mods, nil
+	}
+	resolved, ok := l.packages[pkg]
+	if !ok {
+		return nil, fmt.Errorf("package %s not found", pkg)
+	}
+	discovered, err := resolved.ResolveModules()
+	if err != nil {
+		return nil, fmt.Errorf("package %s: %w", pkg, err)
+	}
+
+	base := registry.LogicalURI(resolved.Source())
+	mods := make(map[string]registry.ResolvedModule, len(discovered))
+	for _, mod := range discovered {
+		mods[moduleName(pkg, base, mod.URI())] = mod
+	}
+	l.modules[pkg] = mods
+	return mods, nil
+}
+
+// moduleName derives the dotted name of a module from its path within the package.
+func moduleName(pkg string, base, uri registry.LogicalURI) string {
+	path := strings.TrimPrefix(string(uri), string(base))
+	segments := []string{pkg}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, ".")
+}
+
+// imports returns the imports of all files of a module in source order.
+func imports(ctx *ast.ContextModule) []*ast.DeclImport {
+	var imps []*ast.DeclImport
+	for _, src := range ctx.Files {
+		var fileImps []*ast.DeclImport
+		for _, sym := range src.Symbols.Symbols {
+			if imp, ok := sym.Decl.(*ast.DeclImport); ok && sym.Original() == sym {
+				fileImps = append(fileImps, imp)
+			}
+		}
+		slices.SortFunc(fileImps, func(lhs, rhs *ast.DeclImport) int {
+			return lhs.Token.Source.Offset - rhs.Token.Source.Offset
+		})
+		imps = append(imps, fileImps...)
+	}
+	return imps
+}
+
+// Compile compiles all modules in dependency order with a shared compiler,
+// so all modules share the same constants and globals.
+func (p *Program) Compile(c *compiler.Compiler) error {
+	for _, mod := range p.Modules {
+		c.DeclareModule(mod.Name, mod.Context)
+	}
+	for _, mod := range p.Modules {
+		err := c.Compile(mod.Context)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", mod.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,633 @@
+package loader_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/vknabel/zirric/compiler"
+	"github.com/vknabel/zirric/loader"
+	"github.com/vknabel/zirric/registry"
+	"github.com/vknabel/zirric/registry/staticmodule"
+	"github.com/vknabel/zirric/runtime"
+	"github.com/vknabel/zirric/version"
+	"github.com/vknabel/zirric/vm"
+	"github.com/vknabel/zirric/world"
+)
+
+type testPackage struct {
+	source  string
+	modules map[string]string
+}
+
+func (p testPackage) Source() string { return p.source }
+
+func (p testPackage) Version() version.Version { return version.Parse("1.0.0") }
+
+func (p testPackage) Resolve(ctx context.Context) (registry.ResolvedPackage, error) {
+	return p, nil
+}
+
+func (p testPackage) ResolveModules() ([]registry.ResolvedModule, error) {
+	var mods []registry.ResolvedModule
+	for path, src := range p.modules {
+		uri := registry.LogicalURI(p.source).Join(path)
+		mods = append(mods, staticmodule.NewModule(uri, []registry.Source{
+			staticmodule.NewSourceString(uri.Join("main.zirr"), src),
+		}))
+	}
+	return mods, nil
+}
+
+func TestLoadDependencyOrder(t *testing.T) {
+	packages := map[string]registry.ResolvedPackage{
+		"app": testPackage{
+			source: "testing:///app",
+			modules: map[string]string{
+				".":     "import app.views { render }\nimport lib = util.strings\nrender(lib.answer)",
+				"views": "import util.strings\nfunc render(value) { return value + strings.answer }",
+			},
+		},
+		"util": testPackage{
+			source: "testing:///util",
+			modules: map[string]string{
+				"strings": "let answer = 21",
+			},
+		},
+	}
+
+	program, err := loader.New(packages).Load("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, mod := range program.Modules {
+		names = append(names, mod.Name)
+	}
+	want := []string{"util.strings", "app.views", "app"}
+	if len(names) != len(want) {
+		t.Fatalf("expected modules %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("expected modules %v, got %v", want, names)
+		}
+	}
+
+	comp := compiler.New()
+	err = program.Compile(comp)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := vm.New(comp.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	got, ok := machine.LastPoppedStackElem().(runtime.Int)
+	if !ok || got != 42 {
+		t.Errorf("expected 42, got %v", machine.LastPoppedStackElem())
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		label   string
+		modules map[string]string
+		err     string
+	}{
+		{
+			label: "import cycle",
+			modules: map[string]string{
+				"a": "import app.b\nlet x = b.y",
+				"b": "import app.c\nlet y = c.z",
+				"c": "import app.a\nlet z = a.x",
+			},
+			err: "import cycle: app.a -> app.b -> app.c -> app.a",
+		},
+		{
+			label: "self import",
+			modules: map[string]string{
+				"a": "import app.a",
+			},
+			err: "import cycle: app.a -> app.a",
+		},
+		{
+			label: "unknown module",
+			modules: map[string]string{
+				"a": "import app.missing",
+			},
+			err: "module app.missing not found in package app, imported by app.a",
+		},
+		{
+			label: "unknown package",
+			modules: map[string]string{
+				"a": "import missing.b",
+			},
+			err: "package missing not found, imported by app.a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			packages := map[string]registry.ResolvedPackage{
+				"app": testPackage{source: "testing:///app", modules: tt.modules},
+			}
+			_, err := loader.New(packages).Load("app")
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	packages := map[string]registry.ResolvedPackage{
+		"app": testPackage{source: "testing:///app", modules: map[string]string{
+			"a": "import app.b",
+			"b": "import app.a",
+		}},
+	}
+	_, err := loader.New(packages).Load("app")
+	var cycle loader.ImportCycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("expected an import cycle error, got %v", err)
+	}
+	if cycle.Token.Source == nil || cycle.Token.Source.File != "testing:///app/b/main.zirr" {
+		t.Errorf("expected the cycle to be closed by the import of app/b, got %v", cycle.Token.Source)
+	}
+}
+
+func TestCompileImportedMembers(t *testing.T) {
+	tests := []struct {
+		label string
+		main  string
+		err   string
+	}{
+		{"private member", "import lib.math { _secret }\n_secret", "testing:///app/./main.zirr:1:19: resolve error: private declaration, _secret is private to module lib.math"},
+		{"private access", "import lib.math\nmath._secret", "testing:///app/./main.zirr:2:6: resolve error: private declaration, _secret is private to module lib.math"},
+		{"undeclared member", "import lib.math { sum }", "testing:///app/./main.zirr:1:19: resolve error: undefined name, \"sum\" is not declared in module lib.math"},
+		{"undeclared access", "import lib.math\nmath.sum", "testing:///app/./main.zirr:2:6: resolve error: undefined name, \"sum\" is not declared in module lib.math"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			packages := map[string]registry.ResolvedPackage{
+				"app": testPackage{source: "testing:///app", modules: map[string]string{".": tt.main}},
+				"lib": testPackage{source: "testing:///lib", modules: map[string]string{
+					"math": "let _secret = 1\nfunc double(n) { return n * 2 }",
+				}},
+			}
+			program, err := loader.New(packages).Load("app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = program.Compile(compiler.New())
+			if err == nil || err.Error() != "module app: "+tt.err {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestModuleValues(t *testing.T) {
+	packages := map[string]registry.ResolvedPackage{
+		"app": testPackage{source: "testing:///app", modules: map[string]string{
+			".": "import lib.math\nfunc apply(m) { return m.double(m.base) }\napply(math)",
+		}},
+		"lib": testPackage{source: "testing:///lib", modules: map[string]string{
+			"math": "@Deprecated(\"use numbers\")\nmodule math\nlet base = 21\nlet _hidden = 0\nfunc double(n) { return n * 2 }",
+		}},
+	}
+	program, err := loader.New(packages).Load("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	comp := compiler.New()
+	err = program.Compile(comp)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := vm.New(comp.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	got, ok := machine.LastPoppedStackElem().(runtime.Int)
+	if !ok || got != 42 {
+		t.Errorf("expected 42, got %v", machine.LastPoppedStackElem())
+	}
+	var deprecations []string
+	for _, w := range comp.Warnings() {
+		if w.Summary == "deprecated" {
+			deprecations = append(deprecations, w.Details)
+		}
+	}
+	if len(deprecations) != 1 || deprecations[0] != "module lib.math is deprecated: use numbers" {
+		t.Errorf("expected a deprecation warning for lib.math, got %v", deprecations)
+	}
+
+	var modules []*runtime.Module
+	for _, c := range comp.Bytecode().Constants {
+		if mod, ok := c.(*runtime.Module); ok {
+			modules = append(modules, mod)
+		}
+	}
+	if len(modules) != 2 {
+		t.Fatalf("expected a module value per module, got %d", len(modules))
+	}
+	math := modules[0]
+	if math.Inspect() != "module lib.math" {
+		t.Errorf("expected module lib.math first, got %q", math.Inspect())
+	}
+	if _, ok := math.Annotation("Deprecated"); !ok {
+		t.Errorf("expected module lib.math to be deprecated")
+	}
+	if _, ok := math.Global("_hidden"); ok {
+		t.Errorf("expected private variables to be hidden")
+	}
+}
+
+func TestPreludeResult(t *testing.T) {
+	packages := map[string]registry.ResolvedPackage{
+		"app": testPackage{source: "testing:///app", modules: map[string]string{
+			".":     "import app.parse\ndata Ok { value }\nfunc double(n) {\n\tlet value = parse.positive(n)?\n\treturn value * 2\n}\ndouble(21)",
+			"parse": "import prelude\nfunc positive(n) { return if n > 0 { prelude.Ok(n) } else { prelude.Err(n) } }",
+		}},
+		"prelude": testPackage{source: "testing:///prelude", modules: map[string]string{
+			".": "enum Result {\n\tdata Ok { value }\n\tdata Err { error }\n}\ndata Error { message }",
+		}},
+	}
+	program, err := loader.New(packages).Load("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.Modules[0].Name != "prelude" {
+		t.Fatalf("expected the prelude to be loaded first, got %s", program.Modules[0].Name)
+	}
+	comp := compiler.New()
+	err = program.Compile(comp)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := vm.New(comp.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	got, ok := machine.LastPoppedStackElem().(runtime.Int)
+	if !ok || got != 42 {
+		t.Errorf("expected 42, got %v", machine.LastPoppedStackElem())
+	}
+}
+
+func TestBuildCache(t *testing.T) {
+	packages := func(answer, offset string) map[string]registry.ResolvedPackage {
+		// each module warns about its unused function, when it is compiled,
+		// and the root module shares the literal 2 and the prelude with restored modules
+		return map[string]registry.ResolvedPackage{
+			"app": testPackage{source: "testing:///app", modules: map[string]string{
+				".":     "import app.views\nimport prelude\nfunc _app() {}\nfunc answer() { return prelude.Ok(views.render() + 2 * " + offset + ")? }\nanswer()",
+				"views": "import util.strings\nfunc _views() {}\nfunc render() { return strings.answer * 2 }",
+			}},
+			"util": testPackage{source: "testing:///util", modules: map[string]string{
+				"strings": "func _strings() {}\nlet answer = " + answer,
+			}},
+			"prelude": testPackage{source: "testing:///prelude", modules: map[string]string{
+				".": "enum Result {\n\tdata Ok { value }\n\tdata Err { error }\n}",
+			}},
+		}
+	}
+	w := world.World{FS: memfs.New()}
+	cache, err := loader.NewCache(w, ".cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		label    string
+		answer   string
+		offset   string
+		expected runtime.Int
+		compiled []string
+		programs int
+	}{
+		{"first build", "21", "0", 42, []string{"_strings", "_views", "_app"}, 1},
+		{"unchanged sources", "21", "0", 42, nil, 1},
+		{"changed root module", "21", "1", 44, []string{"_app"}, 2},
+		{"changed transitive import", "20", "0", 40, []string{"_strings", "_views", "_app"}, 3},
+		{"restored sources", "21", "0", 42, nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			comp := compiler.New()
+			bytecode, err := loader.New(packages(tt.answer, tt.offset)).Build("app", comp, cache)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var compiled []string
+			for _, w := range comp.Warnings() {
+				compiled = append(compiled, w.Token.Literal)
+			}
+			if !slices.Equal(compiled, tt.compiled) {
+				t.Errorf("expected compiled modules %v, got %v", tt.compiled, compiled)
+			}
+			entries, err := w.FS.ReadDir(".cache/programs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.programs {
+				t.Errorf("expected %d cached programs, got %d", tt.programs, len(entries))
+			}
+
+			// restored modules must not differ from compiling all of them
+			program, err := loader.New(packages(tt.answer, tt.offset)).Load("app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fresh := compiler.New()
+			err = program.Compile(fresh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var freshEncoded, encoded bytes.Buffer
+			if err := fresh.Bytecode().Encode(&freshEncoded); err != nil {
+				t.Fatal(err)
+			}
+			if err := bytecode.Encode(&encoded); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(freshEncoded.Bytes(), encoded.Bytes()) {
+				t.Errorf("expected the same bytecode as compiling all modules")
+			}
+
+			machine := vm.New(bytecode)
+			err = machine.Run()
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			got, ok := machine.LastPoppedStackElem().(runtime.Int)
+			if !ok || got != tt.expected {
+				t.Errorf("expected %d, got %v", tt.expected, machine.LastPoppedStackElem())
+			}
+		})
+	}
+}
+
+func TestBuildCacheChangedPrelude(t *testing.T) {
+	packages := func(prelude string) map[string]registry.ResolvedPackage {
+		// the app doesn't import the prelude, but the compiler still depends on it
+		return map[string]registry.ResolvedPackage{
+			"app": testPackage{source: "testing:///app", modules: map[string]string{
+				".": "func _app() {}\nfunc answer() { return 42 }\nanswer()",
+			}},
+			"prelude": testPackage{source: "testing:///prelude", modules: map[string]string{
+				".": "func _prelude() {}\n" + prelude,
+			}},
+		}
+	}
+	w := world.World{FS: memfs.New()}
+	cache, err := loader.NewCache(w, ".cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		label    string
+		prelude  string
+		compiled []string
+	}{
+		{"first build", "data Error { message }", []string{"_prelude", "_app"}},
+		{"unchanged prelude", "data Error { message }", nil},
+		{"changed prelude", "data Error { message }\nenum Result {\n\tdata Ok { value }\n\tdata Err { error }\n}", []string{"_prelude", "_app"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			comp := compiler.New()
+			bytecode, err := loader.New(packages(tt.prelude)).Build("app", comp, cache)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var compiled []string
+			for _, w := range comp.Warnings() {
+				compiled = append(compiled, w.Token.Literal)
+			}
+			if !slices.Equal(compiled, tt.compiled) {
+				t.Errorf("expected compiled modules %v, got %v", tt.compiled, compiled)
+			}
+
+			program, err := loader.New(packages(tt.prelude)).Load("app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fresh := compiler.New()
+			err = program.Compile(fresh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bytecode.Constants) != len(fresh.Bytecode().Constants) {
+				t.Errorf("expected %d constants, got %d", len(fresh.Bytecode().Constants), len(bytecode.Constants))
+			}
+		})
+	}
+}
+
+func TestBuildCachePromotedWarnings(t *testing.T) {
+	packages := map[string]registry.ResolvedPackage{
+		"app": testPackage{source: "testing:///app", modules: map[string]string{
+			".": "@Deprecated(\"use answer\")\nfunc legacy() { return 42 }\nlegacy()",
+		}},
+	}
+	w := world.World{FS: memfs.New()}
+	cache, err := loader.NewCache(w, ".cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = loader.New(packages).Build("app", compiler.New(), cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a cached program without promoted warnings must not satisfy a promoting build
+	comp := compiler.New()
+	comp.PromoteWarnings()
+	_, err = loader.New(packages).Build("app", comp, cache)
+	if err == nil || !strings.Contains(err.Error(), "legacy is deprecated") {
+		t.Errorf("expected deprecation error, got %v", err)
+	}
+}
+
+func TestTypeCheck(t *testing.T) {
+	packages := map[string]registry.ResolvedPackage{
+		"app": testPackage{source: "testing:///app", modules: map[string]string{
+			".": "func twice(@Int n) { return n * 2 }\ntwice(\"21\")",
+		}},
+	}
+	w := world.World{FS: memfs.New()}
+	cache, err := loader.NewCache(w, ".cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = loader.New(packages).Build("app", compiler.New(), cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a cached program without type checks must not satisfy a checking build
+	comp := compiler.New()
+	comp.EnableTypeCheck()
+	_, err = loader.New(packages).Build("app", comp, cache)
+	want := `module app: testing:///app/./main.zirr:2:7: type error: type mismatch for argument n of twice, want @Int, got String`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestContractsOfOtherModules(t *testing.T) {
+	packages := map[string]registry.ResolvedPackage{
+		"app": testPackage{source: "testing:///app", modules: map[string]string{
+			".":      "import app.shapes\ndata Triangle\nenum Shape {\nshapes.Circle\nTriangle\n}\nfunc area(@Shape shape) { return 1 }\narea(shapes.Circle())\narea(\"circle\")",
+			"shapes": "data Circle",
+		}},
+	}
+
+	program, err := loader.New(packages).Load("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	comp := compiler.New()
+	comp.EnableContracts()
+	err = program.Compile(comp)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = vm.New(comp.Bytecode()).Run()
+	want := "contract violation for parameter shape of area: want @Shape, got String, called at top level"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestHasContractsOfOtherModules(t *testing.T) {
+	packages := map[string]registry.ResolvedPackage{
+		"app": testPackage{source: "testing:///app", modules: map[string]string{
+			".":      "import app.shapes { Round, Circle, Square }\nfunc area(@Has(Round) shape) { return 1 }\narea(Circle())\narea(Square())",
+			"shapes": "annotation Round {}\n@Round\ndata Circle\ndata Square",
+		}},
+	}
+
+	program, err := loader.New(packages).Load("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	comp := compiler.New()
+	comp.EnableContracts()
+	err = program.Compile(comp)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = vm.New(comp.Bytecode()).Run()
+	want := "contract violation for parameter shape of area: want @Has(Round), got Square, called at top level"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestWithImportedValues(t *testing.T) {
+	tests := []struct {
+		label    string
+		input    string
+		expected int64
+		err      string
+	}{
+		{
+			label:    "imported member",
+			input:    "import app.people { alice }\n(alice with { age: 43 }).age",
+			expected: 43,
+		},
+		{
+			label:    "module member",
+			input:    "import app.people\n(people.alice with { age: 44 }).age",
+			expected: 44,
+		},
+		{
+			label: "unknown field",
+			input: "import app.people { alice }\nalice with { height: 2 }",
+			err:   `data Person has no field "height"`,
+		},
+		{
+			label:    "dynamic target",
+			input:    "import app.people\nfunc older(person) { return person with { age: 45 } }\nolder(people.alice).age",
+			expected: 45,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			packages := map[string]registry.ResolvedPackage{
+				"app": testPackage{source: "testing:///app", modules: map[string]string{
+					".":      tt.input,
+					"people": "data Person {\nname\nage\n}\nlet alice = Person(\"Alice\", 42)",
+				}},
+			}
+			program, err := loader.New(packages).Load("app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			comp := compiler.New()
+			err = program.Compile(comp)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+			machine := vm.New(comp.Bytecode())
+			err = machine.Run()
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			got, ok := machine.LastPoppedStackElem().(runtime.Int)
+			if !ok || int64(got) != tt.expected {
+				t.Errorf("expected %d, got %v", tt.expected, machine.LastPoppedStackElem())
+			}
+		})
+	}
+}
+
+func TestModuleJumps(t *testing.T) {
+	packages := map[string]registry.ResolvedPackage{
+		"app": testPackage{source: "testing:///app", modules: map[string]string{
+			// jumps of later modules are moved behind the instructions of earlier ones
+			".":     "import app.flags\nif flags.enabled {\n42\n} else {\n0\n}",
+			"flags": "let enabled = true\nif enabled {\nenabled\n} else {\nenabled\n}",
+		}},
+	}
+
+	program, err := loader.New(packages).Load("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	comp := compiler.New()
+	err = program.Compile(comp)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := vm.New(comp.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	got, ok := machine.LastPoppedStackElem().(runtime.Int)
+	if !ok || got != 42 {
+		t.Errorf("expected 42, got %v", machine.LastPoppedStackElem())
+	}
+}
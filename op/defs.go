@@ -4,6 +4,16 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+)
+
+const (
+	// MaxNarrowOperand is the largest operand, that fits into an instruction without Wide prefix.
+	MaxNarrowOperand = math.MaxUint16
+	// MaxOperand is the largest operand of any instruction.
+	MaxOperand = math.MaxUint32
 )
 
 type Instructions []byte
@@ -23,26 +33,61 @@ func LookupDefinition(op byte) (*Definition, error) {
 	return def, nil
 }
 
+// String returns the mnemonic of the opcode.
+func (op Opcode) String() string {
+	if def, ok := definitions[op]; ok {
+		return def.Name
+	}
+	return fmt.Sprintf("opcode %d", byte(op))
+}
+
+// SetVersion identifies the opcodes and their operand widths.
+// Serialized instructions can only be run by a vm with the same opcode set.
+func SetVersion() uint32 {
+	h := fnv.New32a()
+	for op := 0; op < 256; op++ {
+		def, ok := definitions[Opcode(op)]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(h, "%d %s %v;", op, def.Name, def.OperandWidths)
+	}
+	return h.Sum32()
+}
+
+// Make encodes an instruction.
+// If any operand exceeds MaxNarrowOperand, the instruction is prefixed by Wide
+// and all of its operands are twice as wide.
 func Make(op Opcode, operands ...int) []byte {
 	def, ok := definitions[op]
 	if !ok {
 		return []byte{}
 	}
 
-	instructionLen := 1
-	for _, w := range def.OperandWidths {
-		instructionLen += w
+	wide := false
+	for _, o := range operands {
+		wide = wide || o > MaxNarrowOperand
 	}
 
-	instruction := make([]byte, instructionLen)
-	instruction[0] = byte(op)
+	instruction := make([]byte, Len(op, wide))
+	offset := 0
+	if wide {
+		instruction[0] = byte(Wide)
+		offset++
+	}
+	instruction[offset] = byte(op)
+	offset++
 
-	offset := 1
 	for i, o := range operands {
 		width := def.OperandWidths[i]
+		if wide {
+			width *= 2
+		}
 		switch width {
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
 		}
 		offset += width
 	}
@@ -50,6 +95,59 @@ func Make(op Opcode, operands ...int) []byte {
 	return instruction
 }
 
+// Len returns the length of an instruction in bytes, including its Wide prefix.
+func Len(op Opcode, wide bool) int {
+	def, ok := definitions[op]
+	if !ok {
+		return 0
+	}
+	operands := 0
+	for _, w := range def.OperandWidths {
+		operands += w
+	}
+	if wide {
+		// the prefix and the opcode
+		return 2 + 2*operands
+	}
+	return 1 + operands
+}
+
+// Instruction is a decoded instruction.
+type Instruction struct {
+	Opcode   Opcode
+	Operands []int
+	// Whether the instruction is prefixed by Wide.
+	Wide bool
+	// The length in bytes, including the Wide prefix.
+	Len int
+}
+
+// Decode reads the instruction at the start of ins, including its Wide prefix.
+func Decode(ins Instructions) (Instruction, error) {
+	wide := len(ins) > 0 && Opcode(ins[0]) == Wide
+	start := 0
+	if wide {
+		start = 1
+	}
+	if len(ins) <= start {
+		return Instruction{}, fmt.Errorf("missing instruction")
+	}
+	def, err := LookupDefinition(ins[start])
+	if err != nil {
+		return Instruction{}, err
+	}
+	decoded := Instruction{Opcode: Opcode(ins[start]), Wide: wide, Len: Len(Opcode(ins[start]), wide)}
+	if len(ins) < decoded.Len {
+		return Instruction{}, fmt.Errorf("truncated instruction %s", def.Name)
+	}
+	if wide {
+		decoded.Operands = ReadWideOperands(def, ins[start+1:])
+	} else {
+		decoded.Operands, _ = ReadOperands(def, ins[start+1:])
+	}
+	return decoded, nil
+}
+
 func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	operands := make([]int, len(def.OperandWidths))
 	offset := 0
@@ -65,6 +163,25 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+// ReadWideOperands reads the operands of an instruction prefixed by Wide.
+func ReadWideOperands(def *Definition, ins Instructions) []int {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, width := range def.OperandWidths {
+		operands[i] = ReadOperand(ins[offset:], 2*width)
+		offset += 2 * width
+	}
+	return operands
+}
+
+// ReadOperand reads a single operand of the given width.
+func ReadOperand(ins Instructions, width int) int {
+	if width == 4 {
+		return int(binary.BigEndian.Uint32(ins))
+	}
+	return int(ReadUint16(ins))
+}
+
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
@@ -73,16 +190,20 @@ func (ins Instructions) String() string {
 	var out bytes.Buffer
 
 	for i := 0; i < len(ins); i++ {
-		def, err := LookupDefinition(ins[i])
+		decoded, err := Decode(ins[i:])
 		if err != nil {
 			fmt.Fprintf(&out, "ERROR: %s\n", err)
 			continue
 		}
 
-		operands, read := ReadOperands(def, ins[i+1:])
-		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		def := definitions[decoded.Opcode]
+		if decoded.Wide {
+			fmt.Fprintf(&out, "%04d wide %s\n", i, ins.fmtInstruction(def, decoded.Operands))
+		} else {
+			fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, decoded.Operands))
+		}
 
-		i += read
+		i += decoded.Len - 1
 	}
 
 	return out.String()
@@ -96,12 +217,10 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 			len(operands), operandCount)
 	}
 
-	switch operandCount {
-	case 0:
-		return def.Name
-	case 1:
-		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	var out strings.Builder
+	out.WriteString(def.Name)
+	for _, o := range operands {
+		fmt.Fprintf(&out, " %d", o)
 	}
-
-	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+	return out.String()
 }
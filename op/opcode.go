@@ -7,15 +7,22 @@ const (
 	ConstTrue
 	ConstFalse
 	Pop
+	Dup
 
 	Array
 	Dict
 
 	GetIndex
 	GetField
+	CopyWith
+	Propagate
 
 	// does not consume, just assert top value's type
 	AssertType
+	// does not consume, asserts the top value satisfies a contract
+	AssertContract
+	// replaces the top value with whether it satisfies a contract
+	MatchContract
 
 	Jump
 	JumpTrue
@@ -38,7 +45,17 @@ const (
 	LessThanOrEqual
 
 	Call
+	CallNamed
+	CallSpread
+	// calls in tail position, reusing the frame of the caller
+	TailCall
+	TailCallNamed
+	TailCallSpread
 	Return
+	Defer
+	EndDefer
+	Panic
+	Recover
 	GetGlobal
 	SetGlobal
 	GetLocal
@@ -47,6 +64,9 @@ const (
 	// Serves as instruction to optionally pause on breakpoints.
 	// Will not be compiled for non debugging sessions.
 	Debug
+
+	// Prefixes an instruction, whose operands are twice as wide.
+	Wide
 )
 
 var definitions = map[Opcode]*Definition{
@@ -55,14 +75,19 @@ var definitions = map[Opcode]*Definition{
 	ConstTrue:  {"consttrue", []int{}},
 	ConstFalse: {"constfalse", []int{}},
 	Pop:        {"pop", []int{}},
+	Dup:        {"dup", []int{}},
 
-	Array: {"array", []int{}},
-	Dict:  {"dict", []int{}},
+	Array: {"array", []int{2}}, // element count
+	Dict:  {"dict", []int{2}},  // entry count
 
-	GetIndex: {"getindex", []int{}},
-	GetField: {"getfield", []int{2}}, // name id
+	GetIndex:  {"getindex", []int{}},
+	GetField:  {"getfield", []int{2}},     // name id
+	CopyWith:  {"copywith", []int{2}},     // field count
+	Propagate: {"propagate", []int{2, 2}}, // ok type id, err type id
 
-	AssertType: {"asserttype", []int{2}}, // type id
+	AssertType:     {"asserttype", []int{2}},     // type id
+	AssertContract: {"assertcontract", []int{2}}, // contract id
+	MatchContract:  {"matchcontract", []int{2}},  // contract id
 
 	Jump:      {"jump", []int{2}},      // address
 	JumpTrue:  {"jumptrue", []int{2}},  // address
@@ -75,6 +100,7 @@ var definitions = map[Opcode]*Definition{
 	Sub: {"sub", []int{}},
 	Mul: {"mul", []int{}},
 	Div: {"div", []int{}},
+	Mod: {"mod", []int{}},
 
 	Equal:              {"eq", []int{}},
 	NotEqual:           {"neq", []int{}},
@@ -83,12 +109,23 @@ var definitions = map[Opcode]*Definition{
 	LessThan:           {"lt", []int{}},
 	LessThanOrEqual:    {"lte", []int{}},
 
-	Call:      {"call", []int{2}}, // arg count
-	Return:    {"return", []int{}},
-	GetGlobal: {"getglobal", []int{2}},
-	SetGlobal: {"setglobal", []int{2}},
-	GetLocal:  {"getlocal", []int{2}},
-	SetLocal:  {"setlocal", []int{2}},
+	Call:           {"call", []int{2}},             // arg count
+	CallNamed:      {"callnamed", []int{2, 2}},     // arg count, names id
+	CallSpread:     {"callspread", []int{2}},       // arg count, last one is spread
+	TailCall:       {"tailcall", []int{2}},         // arg count
+	TailCallNamed:  {"tailcallnamed", []int{2, 2}}, // arg count, names id
+	TailCallSpread: {"tailcallspread", []int{2}},   // arg count, last one is spread
+	Return:         {"return", []int{}},
+	Defer:          {"defer", []int{2}}, // address after the deferred block
+	EndDefer:       {"enddefer", []int{}},
+	Panic:          {"panic", []int{}},
+	Recover:        {"recover", []int{}},
+	GetGlobal:      {"getglobal", []int{2}},
+	SetGlobal:      {"setglobal", []int{2}},
+	GetLocal:       {"getlocal", []int{2}},
+	SetLocal:       {"setlocal", []int{2}},
 
 	Debug: {"debug", []int{}},
+
+	Wide: {"wide", []int{}},
 }
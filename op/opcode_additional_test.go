@@ -45,6 +45,8 @@ func TestMakeOpcodes(t *testing.T) {
 		want     []byte
 	}{
 		{"const", Const, []int{65535}, []byte{byte(Const), 255, 255}},
+		{"wide const", Const, []int{65536}, []byte{byte(Wide), byte(Const), 0, 1, 0, 0}},
+		{"wide callnamed", CallNamed, []int{2, 70000}, []byte{byte(Wide), byte(CallNamed), 0, 0, 0, 2, 0, 1, 17, 112}},
 		{"add", Add, nil, []byte{byte(Add)}},
 		{"undefined", Opcode(255), nil, []byte{}},
 	}
@@ -84,6 +86,40 @@ func TestReadOperands(t *testing.T) {
 	}
 }
 
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		ins  Instructions
+		want Instruction
+		err  string
+	}{
+		{"narrow", Make(CallNamed, 2, 7), Instruction{Opcode: CallNamed, Operands: []int{2, 7}, Len: 5}, ""},
+		{"wide", Make(GetGlobal, 65536), Instruction{Opcode: GetGlobal, Operands: []int{65536}, Wide: true, Len: 6}, ""},
+		{"empty", nil, Instruction{}, "missing instruction"},
+		{"dangling wide", Make(Wide), Instruction{}, "missing instruction"},
+		{"truncated", Make(GetGlobal, 65536)[:4], Instruction{}, "truncated instruction getglobal"},
+		{"undefined", Instructions{255}, Instruction{}, "opcode 255 undefined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.ins)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("unexpected instruction.\nwant=%v\n got=%v", tt.want, got)
+			}
+		})
+	}
+}
+
 func TestInstructionsString(t *testing.T) {
 	tests := []struct {
 		name string
@@ -92,6 +128,9 @@ func TestInstructionsString(t *testing.T) {
 	}{
 		{"const+add", append(append(Instructions{}, Make(Const, 2)...), Make(Add)...), "0000 const 2\n0003 add\n"},
 		{"jump", Instructions(Make(Jump, 5)), "0000 jump 5\n"},
+		{"callnamed", Instructions(Make(CallNamed, 2, 7)), "0000 callnamed 2 7\n"},
+		{"callspread", Instructions(Make(CallSpread, 3)), "0000 callspread 3\n"},
+		{"wide", append(Instructions(Make(Jump, 1<<20)), Make(Pop)...), "0000 wide jump 1048576\n0006 pop\n"},
 		{"unknown", append(append(Instructions{}, Make(Const, 1)...), 255), "0000 const 1\nERROR: opcode 255 undefined\n"},
 	}
 
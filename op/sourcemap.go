@@ -0,0 +1,54 @@
+package op
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SourceMap maps instruction offsets to the source positions, they were compiled from.
+// Mappings are ordered by their offset and cover all instructions up to the next mapping.
+type SourceMap []SourceMapping
+
+type SourceMapping struct {
+	// Offset of the first instruction.
+	Offset int
+	// File and byte offset of the source.
+	File     string
+	Position int
+	// Line and column of the source, zero if unknown.
+	Line   int
+	Column int
+}
+
+// String formats the source position like `file:line:column` or like `file@position`, if the line is unknown.
+func (m SourceMapping) String() string {
+	if m.Line == 0 {
+		return fmt.Sprintf("%s@%d", m.File, m.Position)
+	}
+	return fmt.Sprintf("%s:%d:%d", m.File, m.Line, m.Column)
+}
+
+// Add maps all instructions from the offset of m onwards to its source position.
+// Consecutive mappings of the same position are merged.
+func (sm SourceMap) Add(m SourceMapping) SourceMap {
+	if n := len(sm); n > 0 {
+		last := sm[n-1]
+		if last.File == m.File && last.Position == m.Position {
+			return sm
+		}
+		if last.Offset == m.Offset {
+			sm[n-1] = m
+			return sm
+		}
+	}
+	return append(sm, m)
+}
+
+// Lookup returns the source position of the instruction at offset.
+func (sm SourceMap) Lookup(offset int) (SourceMapping, bool) {
+	i := sort.Search(len(sm), func(i int) bool { return sm[i].Offset > offset })
+	if i == 0 {
+		return SourceMapping{}, false
+	}
+	return sm[i-1], true
+}
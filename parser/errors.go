@@ -15,8 +15,13 @@ type ParseError struct {
 }
 
 // Error implements error.
+// It starts with the source position like `file:line:column`, if known.
 func (e ParseError) Error() string {
-	return fmt.Sprintf("syntax error: %s, %s", e.Summary, e.Details)
+	msg := fmt.Sprintf("syntax error: %s, %s", e.Summary, e.Details)
+	if e.Token.Source == nil {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", e.Token.Source, msg)
 }
 
 func (p *Parser) errUnexpectedToken(want ...token.TokenType) {
@@ -57,11 +62,53 @@ func (p *Parser) errUnderlyingErrorf(err error, format string, a ...any) {
 	})
 }
 
+func (p *Parser) errDuplicateField(tok token.Token) {
+	p.detectError(ParseError{
+		Token:   tok,
+		Summary: "duplicate field",
+		Details: fmt.Sprintf("field %q is updated more than once", tok.Literal),
+	})
+}
+
+func (p *Parser) errDuplicateArgument(tok token.Token) {
+	p.detectError(ParseError{
+		Token:   tok,
+		Summary: "duplicate argument",
+		Details: fmt.Sprintf("argument %q is passed more than once", tok.Literal),
+	})
+}
+
+func (p *Parser) errPositionalAfterNamedArgument() {
+	p.detectError(ParseError{
+		Token:   p.curToken,
+		Summary: "positional argument after named argument",
+		Details: "positional arguments must be passed before named arguments",
+	})
+}
+
+func (p *Parser) errVariadicNotLast(tok token.Token) {
+	p.detectError(ParseError{
+		Token:   tok,
+		Summary: "variadic parameter not last",
+		Details: fmt.Sprintf("only the last parameter can be variadic, but %q is followed by further parameters", tok.Literal),
+	})
+}
+
+func (p *Parser) errSpreadNotLast() {
+	p.detectError(ParseError{
+		Token:   p.curToken,
+		Summary: "spread argument not last",
+		Details: "only the last argument can be spread",
+	})
+}
+
 func (p *Parser) errStatementMisplaced(pos StatementPosition) {
 	summary := fmt.Sprintf("statement %s misplaced", strings.ToLower(string(p.curToken.Type)))
 	switch p.curToken.Type {
 	case token.RETURN:
 		summary = "return must be inside function"
+	case token.DEFER:
+		summary = "defer must be inside function"
 	case token.IMPORT:
 		summary = "imports must be global"
 	case token.EXTERN:
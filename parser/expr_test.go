@@ -5,6 +5,9 @@ import (
 	"testing"
 
 	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/lexer"
+	"github.com/vknabel/zirric/parser"
+	"github.com/vknabel/zirric/registry/staticmodule"
 )
 
 func TestExprIdentifier(t *testing.T) {
@@ -34,9 +37,36 @@ func TestExprIdentifier(t *testing.T) {
 		{"'\\''", "'\\''"},
 		{"'\\\\'", "'\\\\'"},
 		{"[1, 2]", "[1, 2]"},
-		{"some()", "some(some)"},
-		{"call(1, 2)", "call(1, 2call)"},
+		{"some()", "some()"},
+		{"call(1, 2)", "call(1, 2)"},
 		{"{}", "{->/* 0 stmts */}"},
+		{"a?.b", "a?.b"},
+		{"a?.b.c", "a?.b.c"},
+		{"a?[0]", "(a?[0])"},
+		{"a ?? b", "(a??b)"},
+		{"a ?? b ?? c", "(a??(b??c))"},
+		{"a?.b ?? 1 + 2", "(a?.b??(1+2))"},
+		{"a ?? b == c", "((a??b)==c)"},
+		{"p with { age: 31 }", "(p with { age: 31 })"},
+		{"p with { name: n, age: 1 + 2, }", "(p with { name: n, age: (1+2) })"},
+		{"p.q with { a: 1 }.a", "(p.q with { a: 1 }).a"},
+		{"a + p with { a: 1 }", "(a+(p with { a: 1 }))"},
+		{"with", "with"},
+		{"with(1)", "with(1)"},
+		{"f(a: 1)", "f(a: 1)"},
+		{"f(1, b: 2, c: x)", "f(1, b: 2, c: x)"},
+		{"f(a: b ?? 1)", "f(a: (b??1))"},
+		{"f(xs...)", "f(xs...)"},
+		{"f(x)?", "(f(x)?)"},
+		{"a.b?.c", "a.b?.c"},
+		{"(a.b?).c", "(a.b?).c"},
+		{"-a?", "(-(a?))"},
+		{"a? ?? b", "((a?)??b)"},
+		{"f(1, xs...)", "f(1, xs...)"},
+		{"panic(\"oops\")", "panic(\"oops\")"},
+		{"panic(a ?? b)", "panic((a??b))"},
+		{"recover() ?? 1", "(recover()??1)"},
+		{"{ xs... -> xs }", "{xs...->/* 1 stmts */}"},
 	}
 
 	for i, tt := range tests {
@@ -58,3 +88,34 @@ func TestExprIdentifier(t *testing.T) {
 		})
 	}
 }
+
+func TestInvalidNamedArguments(t *testing.T) {
+	tests := []struct {
+		input   string
+		summary string
+	}{
+		{"f(a: 1, 2)", "positional argument after named argument"},
+		{"f(a: 1, a: 2)", "duplicate argument"},
+		{"f(xs..., 1)", "spread argument not last"},
+		{"{ xs..., y -> xs }", "variadic parameter not last"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l, err := lexer.New(staticmodule.NewSourceString("testing:///test/test.zirr", tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := parser.NewSourceParser(l, nil, "test.zirr")
+			p.ParseSourceFile()
+
+			errs := p.Errors()
+			if len(errs) != 1 {
+				t.Fatalf("expected exactly one error, got %v", errs)
+			}
+			if errs[0].Summary != tt.summary {
+				t.Errorf("summary wrong. expected=%q, got=%q", tt.summary, errs[0].Summary)
+			}
+		})
+	}
+}
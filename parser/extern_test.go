@@ -40,6 +40,12 @@ func TestParseExternDeclarations(t *testing.T) {
 			expectedType: "*ast.DeclExternFunc",
 			expectedName: "add",
 		},
+		{
+			name:         "extern func with variadic parameter",
+			input:        "extern func print(values...)",
+			expectedType: "*ast.DeclExternFunc",
+			expectedName: "print",
+		},
 		{
 			name:         "extern let value",
 			input:        "extern let myvalue",
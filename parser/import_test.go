@@ -15,8 +15,8 @@ func TestImportDecl(t *testing.T) {
 	}{
 		{"import alias = foo.bar { one, two }", "alias", []string{"foo", "bar"}, []string{"one", "two"}},
 		{"import alias = foo.bar", "alias", []string{"foo", "bar"}, nil},
-		{"import foo.bar { one }", "bar", []string{"foo"}, []string{"one"}},
-		{"import foo.bar", "bar", []string{"foo"}, nil},
+		{"import foo.bar { one }", "bar", []string{"foo", "bar"}, []string{"one"}},
+		{"import foo.bar", "bar", []string{"foo", "bar"}, nil},
 	}
 
 	for _, tt := range tests {
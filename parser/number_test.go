@@ -4,6 +4,9 @@ import (
 	"testing"
 
 	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/lexer"
+	"github.com/vknabel/zirric/parser"
+	"github.com/vknabel/zirric/registry/staticmodule"
 )
 
 func TestNumberLiterals(t *testing.T) {
@@ -17,6 +20,10 @@ func TestNumberLiterals(t *testing.T) {
 		{"0777", 0777},         // 511 (octal)
 		{"0b101010", 0b101010}, // 42 (binary)
 		{"0B100011", 0b100011}, // 35 (binary uppercase)
+		{"1_000_000", 1_000_000},
+		{"0o755", 0o755},
+		{"0x_FF_FF", 0xFFFF},
+		{"9223372036854775807", 9223372036854775807},
 	}
 
 	for _, tt := range tests {
@@ -53,6 +60,9 @@ func TestFloatLiterals(t *testing.T) {
 		{"1.5e-3", 1.5e-3},
 		{"3.14E+2", 3.14e+2},
 		{"42.0", 42.0},
+		{"1_000.5", 1_000.5},
+		{"0x1.8p3", 0x1.8p3},
+		{"0x1p-2", 0x1p-2},
 	}
 
 	for _, tt := range tests {
@@ -78,3 +88,42 @@ func TestFloatLiterals(t *testing.T) {
 		})
 	}
 }
+
+func TestInvalidNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input   string
+		summary string
+		details string
+	}{
+		{"9223372036854775808", `invalid int literal "9223372036854775808"`, "integer literal 9223372036854775808 overflows Int"},
+		{"0x1_0000_0000_0000_0000", `invalid int literal "0x1_0000_0000_0000_0000"`, "integer literal 0x1_0000_0000_0000_0000 overflows Int"},
+		{"1e400", `invalid float literal "1e400"`, "float literal 1e400 overflows Float"},
+		{"0b102", `invalid digit '2' in binary literal`, `in "0b102"`},
+		{"1e", "exponent has no digits", `in "1e"`},
+		{"(if 0b102 { 1 } else { 2 })", `invalid digit '2' in binary literal`, `in "0b102"`},
+		{"[1, 0b102, 3]", `invalid digit '2' in binary literal`, `in "0b102"`},
+		{"let x = switch 1e { case 1: 2 }", "exponent has no digits", `in "1e"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l, err := lexer.New(staticmodule.NewSourceString("testing:///test/test.zirr", tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := parser.NewSourceParser(l, nil, "test.zirr")
+			p.ParseSourceFile()
+
+			errs := p.Errors()
+			if len(errs) != 1 {
+				t.Fatalf("expected exactly one error, got %v", errs)
+			}
+			if errs[0].Summary != tt.summary {
+				t.Errorf("summary wrong. expected=%q, got=%q", tt.summary, errs[0].Summary)
+			}
+			if errs[0].Details != tt.details {
+				t.Errorf("details wrong. expected=%q, got=%q", tt.details, errs[0].Details)
+			}
+		})
+	}
+}
@@ -43,10 +43,13 @@ func NewSourceParser(lex *lexer.Lexer, parent *ast.SymbolTable, path string) *Pa
 	p.registerPrefix(token.IF, p.parsePrattExprIfElse) // only exactly one expr per if / else if / else, else mandatory, later we eventually want to allow assignments and local vars
 	p.registerPrefix(token.LBRACE, p.parsePrattExprFunc)
 	// p.registerPrefix(token.TYPE, p.parseExprType) // only exactly one expr per case
-	// p.registerPrefix(token.SWITCH / MATCH, p.parseExprSwitch) // only exactly one expr per case
+	p.registerPrefix(token.SWITCH, p.parsePrattExprSwitch) // only exactly one expr per case
 	p.registerPrefix(token.LBRACKET, p.parseExprListOrDict)
+	p.registerPrefix(token.PANIC, p.parsePrattExprPanic)
+	p.registerPrefix(token.RECOVER, p.parsePrattExprRecover)
 	p.registerPrefix(token.STRING, p.parsePrattExprString)
 	p.registerPrefix(token.CHAR, p.parsePrattExprChar)
+	p.registerPrefix(token.ILLEGAL, p.parsePrattExprIllegal)
 
 	p.infixParsers = make(map[token.TokenType]infixParser)
 	p.registerInfix(token.OR, p.parsePrattExprInfix)
@@ -62,15 +65,36 @@ func NewSourceParser(lex *lexer.Lexer, parent *ast.SymbolTable, path string) *Pa
 	p.registerInfix(token.SLASH, p.parsePrattExprInfix)
 	p.registerInfix(token.ASTERISK, p.parsePrattExprInfix)
 	p.registerInfix(token.PERCENT, p.parsePrattExprInfix)
+	p.registerInfix(token.COALESCE, p.parsePrattExprInfix)
 	p.registerInfix(token.LPAREN, p.parsePrattExprCall)
 	p.registerInfix(token.DOT, p.parsePrattExprMember)
 	p.registerInfix(token.LBRACKET, p.parsePrattExprIndex)
+	p.registerInfix(token.QUESTION_DOT, p.parsePrattExprMember)
+	p.registerInfix(token.QUESTION_LBRACKET, p.parsePrattExprIndex)
+	p.registerInfix(token.QUESTION, p.parsePrattExprPropagate)
 
 	return p
 }
 
 func (p *Parser) Errors() []ParseError {
-	return p.errors
+	lexErrs := p.lex.Errors()
+	if len(lexErrs) == 0 {
+		return p.errors
+	}
+	errs := make([]ParseError, 0, len(lexErrs)+len(p.errors))
+	for _, err := range lexErrs {
+		errs = append(errs, ParseError{
+			Token: token.Token{
+				Type:    token.ILLEGAL,
+				Literal: err.Span(),
+				Source:  err.Source,
+				Leading: err.Token.Leading,
+			},
+			Summary: err.Summary,
+			Details: fmt.Sprintf("in %q", err.Token.Literal),
+		})
+	}
+	return append(errs, p.errors...)
 }
 
 func (p *Parser) SymbolErrors() []ParseError {
@@ -631,6 +655,10 @@ func (p *Parser) parseDeclParameterList() []ast.DeclParameter {
 		identTok, _ := p.expect(token.IDENT)
 		ident := ast.MakeIdentifier(identTok)
 		decl := ast.MakeDeclParameter(ident, annos)
+		if p.curIs(token.ELLIPSIS) {
+			p.nextToken()
+			decl.Variadic = true
+		}
 		p.curSymbolTable.Insert(decl)
 
 		params = append(params, *decl)
@@ -638,6 +666,9 @@ func (p *Parser) parseDeclParameterList() []ast.DeclParameter {
 		if !p.curIs(token.COMMA) {
 			return params
 		}
+		if decl.Variadic {
+			p.errVariadicNotLast(identTok)
+		}
 		p.expect(token.COMMA)
 	}
 }
@@ -661,6 +692,17 @@ func (p *Parser) parseStatementReturn(pos StatementPosition) *ast.StmtReturn {
 	return ast.MakeStmtReturn(retTok, expr)
 }
 
+func (p *Parser) parseStatementDefer(pos StatementPosition) *ast.StmtDefer {
+	if pos != IN_FUNC {
+		p.errStatementMisplaced(pos)
+	}
+	deferTok, _ := p.expect(token.DEFER)
+	p.expect(token.LBRACE)
+	block := p.parseStmtBlock(pos)
+	p.expect(token.RBRACE)
+	return ast.MakeStmtDefer(deferTok, block)
+}
+
 func (p *Parser) parseStatementIf(pos StatementPosition) ast.StmtIf {
 	ifTok, _ := p.expect(token.IF)
 	cond := p.parseExpr()
@@ -697,6 +739,55 @@ func (p *Parser) parseStatementElseIf(pos StatementPosition) ast.StmtElseIf {
 	return ast.MakeStmtIfElse(elseTok, cond, block)
 }
 
+// parseStatementSwitch parses a switch statement
+//
+//	switch <expr> {
+//	case <pattern>:
+//	  <statements>
+//	}
+func (p *Parser) parseStatementSwitch(pos StatementPosition) *ast.StmtSwitch {
+	switchTok, _ := p.expect(token.SWITCH)
+	value := p.parseExpr()
+	p.expect(token.LBRACE)
+
+	var cases []ast.SwitchCase
+	for p.curIs(token.CASE) {
+		switchCase := p.parseSwitchCasePattern()
+		for !p.curIs(token.CASE, token.RBRACE, token.EOF) {
+			stmt, decls := p.parseAnnotatedStatementDeclaration(IN_FUNC)
+			if len(decls) > 0 {
+				p.errStatementMisplaced(IN_SWITCH)
+			}
+			switchCase.Block = append(switchCase.Block, stmt)
+		}
+		cases = append(cases, switchCase)
+	}
+	p.expect(token.RBRACE)
+	return ast.MakeStmtSwitch(switchTok, value, cases)
+}
+
+// parseSwitchCasePattern parses the pattern of a switch case
+//
+//	case @<type>:
+//	case @Has(<annotation>):
+//	case <expr>:
+//	case _:
+func (p *Parser) parseSwitchCasePattern() ast.SwitchCase {
+	caseTok, _ := p.expect(token.CASE)
+	switchCase := ast.SwitchCase{Token: caseTok}
+	switch {
+	case p.curIs(token.BLANK):
+		p.nextToken()
+		switchCase.Default = true
+	case p.curIs(token.AT):
+		switchCase.Type = p.parseAnnotationInstance()
+	default:
+		switchCase.Value = p.parseExpr()
+	}
+	p.expect(token.COLON)
+	return switchCase
+}
+
 func (p *Parser) parseExprArgumentList() []ast.Expr {
 	var args []ast.Expr
 	for !p.curIs(token.RPAREN) {
@@ -111,6 +111,16 @@ func example() {
 //  ^ ast.StmtReturn
 }
 
+func guarded() {
+    defer {
+//  ^ ast.StmtDefer
+        return recover()
+//             ^ ast.ExprRecover
+    }
+    panic("failed")
+//  ^ ast.ExprPanic
+}
+
 `
 
 	sourceFile := prepareSourceFileParsing(t, contents)
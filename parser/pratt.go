@@ -41,6 +41,7 @@ var precedences = map[token.TokenType]Precedence{
 	token.GTE:      COMPARISON,
 	token.LT:       COMPARISON,
 	token.GT:       COMPARISON,
+	token.COALESCE: COALESCING,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
@@ -48,7 +49,11 @@ var precedences = map[token.TokenType]Precedence{
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: CALL,
+	token.QUESTION: CALL,
 	token.DOT:      MEMBER,
+
+	token.QUESTION_LBRACKET: CALL,
+	token.QUESTION_DOT:      MEMBER,
 }
 
 const (
@@ -77,6 +82,9 @@ func (p *Parser) peekPrecedence() Precedence {
 }
 
 func (p *Parser) curPrecendence() Precedence {
+	if p.curIsWith() {
+		return CALL
+	}
 	if prec, ok := precedences[p.curToken.Type]; ok {
 		return prec
 	}
@@ -111,6 +119,9 @@ func (p *Parser) parsePrattExpr(precedence Precedence) ast.Expr {
 
 	for precedence < p.curPrecendence() {
 		infix := p.infixParsers[p.curToken.Type]
+		if p.curIsWith() {
+			infix = p.parsePrattExprWith
+		}
 		if infix == nil {
 			return lhs
 		}
@@ -140,21 +151,30 @@ func (p *Parser) parsePrattExprNull() ast.Expr {
 }
 
 func (p *Parser) parsePrattExprInt() ast.Expr {
-	tok, _ := p.expect(token.INT)
-	int, err := strconv.ParseInt(tok.Literal, 0, 64)
+	tok := p.curToken
+	expr, err := ast.ParseExprInt(tok)
 	if err != nil {
 		p.errUnderlyingErrorf(err, "invalid int literal %q", tok.Literal)
 	}
-	return ast.MakeExprInt(int, tok)
+	p.nextToken()
+	return expr
 }
 
 func (p *Parser) parsePrattExprFloat() ast.Expr {
-	tok, _ := p.expect(token.FLOAT)
-	float, err := strconv.ParseFloat(tok.Literal, 64)
+	tok := p.curToken
+	expr, err := ast.ParseExprFloat(tok)
 	if err != nil {
 		p.errUnderlyingErrorf(err, "invalid float literal %q", tok.Literal)
 	}
-	return ast.MakeExprFloat(float, tok)
+	p.nextToken()
+	return expr
+}
+
+// parsePrattExprIllegal replaces malformed tokens by an invalid expression.
+// The lexer already reported them.
+func (p *Parser) parsePrattExprIllegal() ast.Expr {
+	tok := p.nextToken()
+	return ast.MakeExprInvalid(tok)
 }
 
 func (p *Parser) parsePrattExprChar() ast.Expr {
@@ -254,10 +274,45 @@ func (p *Parser) parsePrattExprIfElse() ast.Expr {
 	return ifExpr
 }
 
+// parsePrattExprSwitch parses a switch expression with exactly one expression per case.
+func (p *Parser) parsePrattExprSwitch() ast.Expr {
+	switchTok := p.nextToken()
+
+	value := p.parsePrattExpr(LOWEST)
+	if value == nil {
+		return nil
+	}
+	_, ok := p.expect(token.LBRACE)
+	if !ok {
+		return nil
+	}
+
+	var cases []ast.SwitchCase
+	for p.curIs(token.CASE) {
+		switchCase := p.parseSwitchCasePattern()
+		switchCase.Expr = p.parsePrattExpr(LOWEST)
+		if switchCase.Expr == nil {
+			return nil
+		}
+		cases = append(cases, switchCase)
+	}
+
+	_, ok = p.expect(token.RBRACE)
+	if !ok {
+		return nil
+	}
+	return ast.MakeExprSwitch(switchTok, value, cases)
+}
+
 func (p *Parser) parsePrattExprFunc() ast.Expr {
 	return p.parseExprFunction()
 }
 
+// parsePrattExprCall parses invocations with positional and named arguments.
+// The last argument may be spread instead.
+//
+//	<expr>(<expr>, ..., <identifier>: <expr>, ...)
+//	<expr>(<expr>, ..., <expr>...)
 func (p *Parser) parsePrattExprCall(fn ast.Expr) ast.Expr {
 	fnExpr := ast.MakeExprInvocation(fn)
 	p.nextToken()
@@ -266,11 +321,11 @@ func (p *Parser) parsePrattExprCall(fn ast.Expr) ast.Expr {
 		p.nextToken()
 		return fnExpr
 	}
-	fnExpr.AddArgument(p.parsePrattExpr(LOWEST))
+	p.parsePrattExprCallArgument(fnExpr)
 
 	for p.curIs(token.COMMA) {
 		p.nextToken()
-		fnExpr.AddArgument(p.parsePrattExpr(LOWEST))
+		p.parsePrattExprCallArgument(fnExpr)
 	}
 
 	_, ok := p.expect(token.RPAREN)
@@ -281,13 +336,41 @@ func (p *Parser) parsePrattExprCall(fn ast.Expr) ast.Expr {
 	return fnExpr
 }
 
+func (p *Parser) parsePrattExprCallArgument(fnExpr *ast.ExprInvocation) {
+	if fnExpr.Spread {
+		p.errSpreadNotLast()
+	}
+	if !p.curIs(token.IDENT) || !p.peekIs(token.COLON) {
+		if len(fnExpr.NamedArguments) > 0 {
+			p.errPositionalAfterNamedArgument()
+		}
+		fnExpr.AddArgument(p.parsePrattExpr(LOWEST))
+		if p.curIs(token.ELLIPSIS) {
+			p.nextToken()
+			fnExpr.Spread = true
+		}
+		return
+	}
+
+	nameTok := p.nextToken()
+	p.nextToken()
+	for _, arg := range fnExpr.NamedArguments {
+		if arg.Name.Value == nameTok.Literal {
+			p.errDuplicateArgument(nameTok)
+		}
+	}
+	fnExpr.AddNamedArgument(ast.MakeIdentifier(nameTok), p.parsePrattExpr(LOWEST))
+}
+
 func (p *Parser) parsePrattExprMember(owner ast.Expr) ast.Expr {
 	dotTok := p.nextToken()
 	identTok, ok := p.expect(token.IDENT)
 	if !ok {
 		return nil
 	}
-	return ast.MakeExprMemberAccess(dotTok, owner, ast.MakeIdentifier(identTok))
+	access := ast.MakeExprMemberAccess(dotTok, owner, ast.MakeIdentifier(identTok))
+	access.Optional = dotTok.Type == token.QUESTION_DOT
+	return access
 }
 
 func (p *Parser) parsePrattExprIndex(owner ast.Expr) ast.Expr {
@@ -297,7 +380,84 @@ func (p *Parser) parsePrattExprIndex(owner ast.Expr) ast.Expr {
 	if !ok {
 		return nil
 	}
-	return ast.MakeExprIndexAccess(indexTok, owner, indexExpr)
+	access := ast.MakeExprIndexAccess(indexTok, owner, indexExpr)
+	access.Optional = indexTok.Type == token.QUESTION_LBRACKET
+	return access
+}
+
+// parsePrattExprPropagate parses the postfix propagation operator.
+//
+//	<expr>?
+func (p *Parser) parsePrattExprPropagate(value ast.Expr) ast.Expr {
+	tok := p.nextToken()
+	return ast.MakeExprPropagate(tok, value)
+}
+
+// parsePrattExprPanic parses a panic with its value.
+//
+//	panic(<expr>)
+func (p *Parser) parsePrattExprPanic() ast.Expr {
+	tok, _ := p.expect(token.PANIC)
+	p.expect(token.LPAREN)
+	value := p.parsePrattExpr(LOWEST)
+	p.expect(token.RPAREN)
+	return ast.MakeExprPanic(tok, value)
+}
+
+// parsePrattExprRecover parses a recover.
+//
+//	recover()
+func (p *Parser) parsePrattExprRecover() ast.Expr {
+	tok, _ := p.expect(token.RECOVER)
+	p.expect(token.LPAREN)
+	p.expect(token.RPAREN)
+	return ast.MakeExprRecover(tok)
+}
+
+// curIsWith reports whether the current token starts a copy-with-update.
+// `with` is only a keyword in front of `{`, so it can still be used as an identifier.
+func (p *Parser) curIsWith() bool {
+	return p.curIs(token.IDENT) && p.curToken.Literal == "with" && p.peekIs(token.LBRACE)
+}
+
+// parsePrattExprWith parses copy-with-update expressions.
+//
+//	<expr> with { <identifier>: <expr>, ... }
+func (p *Parser) parsePrattExprWith(target ast.Expr) ast.Expr {
+	withTok := p.nextToken()
+	p.expect(token.LBRACE)
+
+	expr := ast.MakeExprWith(withTok, target)
+	seen := make(map[string]bool)
+	for !p.curIs(token.RBRACE) {
+		nameTok, ok := p.expect(token.IDENT)
+		if !ok {
+			return nil
+		}
+		_, ok = p.expect(token.COLON)
+		if !ok {
+			return nil
+		}
+		value := p.parsePrattExpr(LOWEST)
+		if value == nil {
+			return nil
+		}
+		if seen[nameTok.Literal] {
+			p.errDuplicateField(nameTok)
+		}
+		seen[nameTok.Literal] = true
+		expr.AddField(ast.MakeIdentifier(nameTok), value)
+
+		if !p.curIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	_, ok := p.expect(token.RBRACE)
+	if !ok {
+		return nil
+	}
+	return expr
 }
 
 func (p *Parser) parsePrattExprString() ast.Expr {
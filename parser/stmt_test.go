@@ -37,3 +37,57 @@ func TestParseStatementElseIf(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSwitch(t *testing.T) {
+	tests := []struct {
+		input    string
+		patterns []string
+		stmts    []int
+	}{
+		{"switch value {\ncase @String:\nprint(value)\nreturn 1\ncase @Has(Numeric):\ncase 1:\nreturn 2\ncase _:\n}", []string{"@String", "@Has(Numeric)", "1", "_"}, []int{2, 0, 1, 0}},
+		{"switch value {}", nil, nil},
+		{"let result = switch value {\ncase @Int:\n0\ncase _:\n1\n}", []string{"@Int", "_"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			srcFile := prepareSourceFileParsing(t, tt.input)
+
+			var cases []ast.SwitchCase
+			if len(srcFile.Statements) == 1 {
+				stmt, ok := srcFile.Statements[0].(*ast.StmtSwitch)
+				if !ok {
+					t.Fatalf("statement is %T, want *ast.StmtSwitch", srcFile.Statements[0])
+				}
+				cases = stmt.Cases
+			} else {
+				sym, ok := srcFile.Symbols.Symbols["result"]
+				if !ok {
+					t.Fatalf("expected a switch statement or a variable result")
+				}
+				expr, ok := sym.Decl.(*ast.DeclVariable).Value.(*ast.ExprSwitch)
+				if !ok {
+					t.Fatalf("value is %T, want *ast.ExprSwitch", sym.Decl.(*ast.DeclVariable).Value)
+				}
+				cases = expr.Cases
+				for _, c := range cases {
+					if c.Expr == nil {
+						t.Errorf("expected an expression for case %s", c.Pattern())
+					}
+				}
+			}
+
+			if len(cases) != len(tt.patterns) {
+				t.Fatalf("expected %d cases, got %d", len(tt.patterns), len(cases))
+			}
+			for i, c := range cases {
+				if c.Pattern() != tt.patterns[i] {
+					t.Errorf("expected pattern %s, got %s", tt.patterns[i], c.Pattern())
+				}
+				if tt.stmts != nil && len(c.Block) != tt.stmts[i] {
+					t.Errorf("expected %d statements for case %s, got %d", tt.stmts[i], c.Pattern(), len(c.Block))
+				}
+			}
+		})
+	}
+}
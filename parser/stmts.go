@@ -44,8 +44,12 @@ func (p *Parser) parseStatementInContext(pos StatementPosition, annos ast.Annota
 		return p.parseAnnotatedStatementDeclaration(pos)
 	case token.IF:
 		return p.parseStatementIf(pos), nil
+	case token.SWITCH:
+		return p.parseStatementSwitch(pos), nil
 	case token.RETURN:
 		return p.parseStatementReturn(pos), nil
+	case token.DEFER:
+		return p.parseStatementDefer(pos), nil
 	default:
 		if _, ok := p.prefixParsers[p.curToken.Type]; ok {
 			if annos != nil {
@@ -55,7 +59,7 @@ func (p *Parser) parseStatementInContext(pos StatementPosition, annos ast.Annota
 		}
 
 		prefixes := []token.TokenType{
-			token.ENUM, token.DATA, token.MODULE, token.EXTERN, token.FUNCTION, token.IMPORT, token.AT, token.LET, token.IF, token.FOR,
+			token.ENUM, token.DATA, token.MODULE, token.EXTERN, token.FUNCTION, token.IMPORT, token.AT, token.LET, token.IF, token.SWITCH, token.FOR,
 		}
 		for t := range p.prefixParsers {
 			prefixes = append(prefixes, t)
@@ -0,0 +1,105 @@
+package resolve
+
+import (
+	"github.com/vknabel/zirric/ast"
+)
+
+// defaultDeprecationReason is the default of `@Deprecated(reason)` in the prelude.
+const defaultDeprecationReason = "without alternative"
+
+// annotationsOf returns the annotations of a declaration.
+func annotationsOf(decl ast.Decl) ast.AnnotationChain {
+	switch decl := decl.(type) {
+	case *ast.DeclFunc:
+		return decl.Annotations
+	case *ast.DeclData:
+		return decl.Annotations
+	case *ast.DeclEnum:
+		return decl.Annotations
+	case *ast.DeclAnnotation:
+		return decl.Annotations
+	case *ast.DeclExternFunc:
+		return decl.Annotations
+	case *ast.DeclExternType:
+		return decl.Annotations
+	case *ast.DeclExternValue:
+		return decl.Annotations
+	case *ast.DeclVariable:
+		return decl.Annotations
+	case *ast.DeclField:
+		return decl.Annotations
+	case *ast.DeclParameter:
+		return decl.Annotations
+	case *ast.DeclModule:
+		return decl.Annotations
+	default:
+		return nil
+	}
+}
+
+// annotation finds the first instance of the named annotation.
+func annotation(annos ast.AnnotationChain, name string) (*ast.DeclAnnotationInstance, bool) {
+	for _, inst := range annos {
+		if len(inst.Reference) > 0 && inst.Reference.Name().Value == name {
+			return inst, true
+		}
+	}
+	return nil, false
+}
+
+// deprecation returns the reason of `@Deprecated(reason)`.
+func deprecation(annos ast.AnnotationChain) (string, bool) {
+	inst, ok := annotation(annos, "Deprecated")
+	if !ok {
+		return "", false
+	}
+	if len(inst.Arguments) > 0 {
+		if reason, ok := inst.Arguments[0].(*ast.ExprString); ok {
+			return reason.Literal, true
+		}
+	}
+	return defaultDeprecationReason, true
+}
+
+// moduleDeprecation returns the reason, if any `module` declaration of a module is deprecated.
+func moduleDeprecation(mod *ast.ContextModule) (string, bool) {
+	for _, src := range mod.Files {
+		for _, sym := range src.Symbols.Symbols {
+			decl, ok := sym.Decl.(*ast.DeclModule)
+			if !ok {
+				continue
+			}
+			if reason, ok := deprecation(decl.Annotations); ok {
+				return reason, true
+			}
+		}
+	}
+	return "", false
+}
+
+// checkDeprecated warns about references to declarations annotated with `@Deprecated`.
+func (r *resolver) checkDeprecated(use ast.Identifier, decl ast.Decl) {
+	reason, ok := deprecation(annotationsOf(decl))
+	if !ok {
+		return
+	}
+	diag := r.report(use.Token, SeverityWarning, "deprecated", "%s is deprecated: %s", use.Value, reason)
+	if diag != nil {
+		declared := decl.DeclName().Token
+		diag.Declaration = &declared
+	}
+}
+
+// checkDeprecatedFields warns about deprecated fields of a data type, that is known at compile time.
+func (r *resolver) checkDeprecatedFields(data *ast.DeclData, names ...ast.Identifier) {
+	if data == nil {
+		return
+	}
+	for _, name := range names {
+		for i := range data.Fields {
+			if data.Fields[i].Name.Value == name.Value {
+				r.checkDeprecated(name, &data.Fields[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package resolve
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/token"
+)
+
+// Severity distinguishes errors, that prevent compilation, from warnings.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic reports an undefined, unused, shadowed or inaccessible name.
+type Diagnostic struct {
+	Token    token.Token
+	Severity Severity
+	Summary  string
+	Details  string
+
+	// Declaration is the referenced declaration, nil if unknown.
+	Declaration *token.Token
+}
+
+// Error implements error.
+// It starts with the source position like `file:line:column`, if known.
+func (d Diagnostic) Error() string {
+	msg := fmt.Sprintf("resolve %s: %s, %s", d.Severity, d.Summary, d.Details)
+	if d.Token.Source == nil {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", d.Token.Source, msg)
+}
+
+// Errors returns all diagnostics with SeverityError.
+func Errors(diags []Diagnostic) []Diagnostic {
+	var errs []Diagnostic
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
+
+// Warnings returns all diagnostics with SeverityWarning.
+func Warnings(diags []Diagnostic) []Diagnostic {
+	var warnings []Diagnostic
+	for _, d := range diags {
+		if d.Severity == SeverityWarning {
+			warnings = append(warnings, d)
+		}
+	}
+	return warnings
+}
+
+// report adds a diagnostic and returns it.
+// Returns nil for warnings, that are suppressed at the current site.
+func (r *resolver) report(tok token.Token, severity Severity, summary string, format string, a ...any) *Diagnostic {
+	if severity == SeverityWarning && slices.Contains(r.suppressed, summary) {
+		return nil
+	}
+	r.diags = append(r.diags, Diagnostic{
+		Token:    tok,
+		Severity: severity,
+		Summary:  summary,
+		Details:  fmt.Sprintf(format, a...),
+	})
+	return &r.diags[len(r.diags)-1]
+}
+
+// suppress suppresses warnings like `@Suppress("deprecated")` until the returned function is called.
+// Warnings are suppressed by their summary.
+func (r *resolver) suppress(annos ast.AnnotationChain) func() {
+	count := len(r.suppressed)
+	for _, inst := range annos {
+		if len(inst.Reference) == 0 || inst.Reference.Name().Value != "Suppress" {
+			continue
+		}
+		for _, arg := range inst.Arguments {
+			if summary, ok := arg.(*ast.ExprString); ok {
+				r.suppressed = append(r.suppressed, summary.Literal)
+			}
+		}
+	}
+	return func() {
+		r.suppressed = r.suppressed[:count]
+	}
+}
+
+// sortDiagnostics orders diagnostics by their source location.
+func sortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		lhs, rhs := diags[i].Token.Source, diags[j].Token.Source
+		if lhs == nil || rhs == nil {
+			return rhs != nil
+		}
+		if lhs.File != rhs.File {
+			return lhs.File < rhs.File
+		}
+		return lhs.Offset < rhs.Offset
+	})
+}
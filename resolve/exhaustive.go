@@ -0,0 +1,152 @@
+package resolve
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/token"
+)
+
+// checkSwitch warns about cases, that are already matched by earlier cases or repeat their values,
+// and reports cases of the switched type, that no case matches.
+// Non-exhaustive switch expressions are errors, as they would not evaluate to a value.
+func (r *resolver) checkSwitch(table *ast.SymbolTable, tok token.Token, value ast.Expr, cases []ast.SwitchCase, isExpr bool) {
+	var (
+		scope      = r.typeScope(table)
+		matched    []*ast.Symbol
+		values     = make(map[any]bool)
+		hasDefault bool
+	)
+	isMatched := func(t *ast.Symbol) bool {
+		return slices.ContainsFunc(matched, func(m *ast.Symbol) bool { return sameType(m, t) })
+	}
+	for _, sc := range cases {
+		if hasDefault {
+			r.report(sc.Token, SeverityWarning, "unreachable case", "case %s is unreachable after the default case _", sc.Pattern())
+			continue
+		}
+		if sc.Default {
+			hasDefault = true
+			continue
+		}
+		if v, ok := literalValue(sc.Value); ok {
+			if values[v] {
+				r.report(sc.Token, SeverityWarning, "unreachable case", "case %s is unreachable, an earlier case already matches %s", sc.Pattern(), sc.Value.Expression())
+			}
+			values[v] = true
+			continue
+		}
+		if sc.Type == nil {
+			continue
+		}
+		types, ok := patternTypes(scope, sc.Type)
+		if !ok || len(types) == 0 {
+			continue
+		}
+		if !slices.ContainsFunc(types, func(t *ast.Symbol) bool { return !isMatched(t) }) {
+			r.report(sc.Token, SeverityWarning, "unreachable case", "case %s is unreachable, earlier cases already match %s", sc.Pattern(), patterns(types))
+		}
+		for _, t := range types {
+			if !isMatched(t) {
+				matched = append(matched, t)
+			}
+		}
+	}
+	if hasDefault {
+		return
+	}
+
+	severity := SeverityWarning
+	if isExpr {
+		severity = SeverityError
+	}
+	types, ok := staticTypes(scope, value)
+	if !ok {
+		if isExpr {
+			r.report(tok, severity, "non-exhaustive switch", "switch over %s requires a default case _", value.Expression())
+		}
+		return
+	}
+	var missing []*ast.Symbol
+	for _, t := range types {
+		if !isMatched(t) {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) > 0 {
+		r.report(tok, severity, "non-exhaustive switch", "switch over %s does not match %s", value.Expression(), patterns(missing))
+	}
+}
+
+// literalValue returns the value of a literal, that is comparable to the values of other literals.
+func literalValue(expr ast.Expr) (any, bool) {
+	switch lit := expr.(type) {
+	case *ast.ExprInt:
+		return lit.Literal, true
+	case *ast.ExprFloat:
+		return lit.Literal, true
+	case *ast.ExprString:
+		return lit.Literal, true
+	case *ast.ExprChar:
+		return lit.Literal, true
+	case *ast.ExprBool:
+		return lit.Literal, true
+	case *ast.ExprNull:
+		return nil, true
+	default:
+		return nil, false
+	}
+}
+
+// staticTypes returns the types a switched value may have,
+// if it is a parameter annotated with a type, an enum or `@Has(A)`.
+func staticTypes(scope TypeScope, value ast.Expr) ([]*ast.Symbol, bool) {
+	ident, ok := value.(*ast.ExprIdentifier)
+	if !ok {
+		return nil, false
+	}
+	sym, ok := scope.Table.Resolve(ident.Name.Value)
+	if !ok {
+		return nil, false
+	}
+	param, ok := sym.Decl.(*ast.DeclParameter)
+	if !ok {
+		return nil, false
+	}
+	for _, inst := range param.Annotations {
+		if types, ok := patternTypes(scope, inst); ok {
+			return types, true
+		}
+	}
+	return nil, false
+}
+
+// patternTypes returns all types matched by `@T`, `@Type(T)` or `@Has(A)`.
+// Enums match the types of all of their cases.
+func patternTypes(scope TypeScope, inst *ast.DeclAnnotationInstance) ([]*ast.Symbol, bool) {
+	if len(inst.Arguments) == 0 {
+		return scope.Types(inst.Reference)
+	}
+	arg, ok := inst.Arguments[0].(*ast.ExprIdentifier)
+	if len(inst.Reference) != 1 || len(inst.Arguments) != 1 || !ok {
+		return nil, false
+	}
+	switch inst.Reference.Name().Value {
+	case "Type":
+		return scope.Types(ast.StaticReference{arg.Name})
+	case "Has":
+		return scope.Annotated(ast.StaticReference{arg.Name})
+	default:
+		return nil, false
+	}
+}
+
+// patterns formats types like `@A, @B`.
+func patterns(types []*ast.Symbol) string {
+	formatted := make([]string, len(types))
+	for i, t := range types {
+		formatted[i] = "@" + t.Name
+	}
+	return strings.Join(formatted, ", ")
+}
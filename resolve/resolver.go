@@ -0,0 +1,273 @@
+// Package resolve implements the name resolution pass, that runs before code generation.
+//
+// It reports all undefined names at once, including suggestions for similar names,
+// and private names of other modules.
+// It warns about unused imports, locals, parameters and private declarations
+// as well as about declarations, that shadow outer ones.
+// Switches over enums are checked for exhaustiveness and unreachable cases.
+package resolve
+
+import (
+	"sort"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/token"
+)
+
+type resolver struct {
+	diags   []Diagnostic
+	modules Modules
+
+	// summaries of warnings, that are suppressed at the current site
+	suppressed []string
+
+	// functions and variables, that may be reached by declaration and statement
+	visited map[ast.Node]bool
+}
+
+// Resolve records the usages of all names within a module or a single source file
+// and reports undefined, unused and shadowed names.
+// Private names of imported modules are reported without their declaration.
+func Resolve(node ast.Node) []Diagnostic {
+	return ResolveWithModules(node, nil)
+}
+
+// ResolveWithModules resolves like Resolve and
+// looks up imported modules to point at the declarations of private names.
+func ResolveWithModules(node ast.Node, modules Modules) []Diagnostic {
+	r := &resolver{
+		modules: modules,
+		visited: make(map[ast.Node]bool),
+	}
+
+	var tables []*ast.SymbolTable
+	switch node := node.(type) {
+	case *ast.ContextModule:
+		tables = append(tables, node.Symbols)
+		for _, src := range node.Files {
+			tables = append(tables, src.Symbols)
+		}
+		r.resolveTables(tables)
+		for _, src := range node.Files {
+			r.resolveBlock(src.Symbols, src.Statements)
+		}
+
+	case *ast.SourceFile:
+		tables = append(tables, node.Symbols)
+		if node.Symbols.Parent != nil {
+			tables = append(tables, node.Symbols.Parent)
+		}
+		r.resolveTables(tables)
+		r.resolveBlock(node.Symbols, node.Statements)
+	}
+
+	usages := usageCounts(tables)
+	visited := make(map[*ast.SymbolTable]bool)
+	for _, table := range tables {
+		r.checkTable(table, usages, visited)
+	}
+
+	sortDiagnostics(r.diags)
+	return r.diags
+}
+
+// resolveTables resolves the declarations of the given tables.
+func (r *resolver) resolveTables(tables []*ast.SymbolTable) {
+	for _, table := range tables {
+		for _, sym := range sortedSymbols(table) {
+			r.resolveDecl(table, sym)
+		}
+	}
+}
+
+// sortedSymbols returns the declared symbols in declaration order.
+// Captured free symbols are skipped.
+func sortedSymbols(table *ast.SymbolTable) []*ast.Symbol {
+	syms := make([]*ast.Symbol, 0, len(table.Symbols))
+	for _, sym := range table.Symbols {
+		if sym.Decl != nil && sym.Original() == sym {
+			syms = append(syms, sym)
+		}
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		return syms[i].Index < syms[j].Index
+	})
+	return syms
+}
+
+func (r *resolver) resolveDecl(table *ast.SymbolTable, sym *ast.Symbol) {
+	switch decl := sym.Decl.(type) {
+	case *ast.DeclFunc:
+		defer r.suppress(decl.Annotations)()
+		r.resolveFunc(decl.Impl)
+	case *ast.DeclVariable:
+		if decl.ExportScope() == ast.ExportScopeLocal {
+			// resolved as statement
+			return
+		}
+		symbols := sym.ChildTable
+		if symbols == nil {
+			// initializers without own symbols resolve within the declaring scope
+			symbols = table
+		}
+		r.resolveVariable(symbols, decl)
+	case *ast.DeclEnum:
+		for _, cs := range decl.Cases {
+			// cases of other modules are not known
+			table.Use(cs.Case[0])
+		}
+	case *ast.DeclImport:
+		r.checkImport(decl)
+	}
+}
+
+func (r *resolver) resolveFunc(fn *ast.ExprFunc) {
+	if r.visited[fn] {
+		return
+	}
+	r.visited[fn] = true
+	r.resolveBlock(fn.Symbols, fn.Impl)
+}
+
+func (r *resolver) resolveVariable(table *ast.SymbolTable, decl *ast.DeclVariable) {
+	if r.visited[decl] {
+		return
+	}
+	r.visited[decl] = true
+	defer r.suppress(decl.Annotations)()
+	r.resolveExpr(table, decl.Value)
+}
+
+func (r *resolver) resolveBlock(table *ast.SymbolTable, block ast.Block) {
+	for _, stmt := range block {
+		r.resolveStmt(table, stmt)
+	}
+}
+
+func (r *resolver) resolveStmt(table *ast.SymbolTable, stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.StmtExpr:
+		r.resolveExpr(table, stmt.Expr)
+	case *ast.DeclVariable:
+		r.resolveVariable(table, stmt)
+	case *ast.DeclFunc:
+		defer r.suppress(stmt.Annotations)()
+		r.resolveFunc(stmt.Impl)
+	case ast.StmtIf:
+		r.resolveExpr(table, stmt.Condition)
+		r.resolveBlock(table, stmt.IfBlock)
+		for _, elseIf := range stmt.ElseIf {
+			r.resolveExpr(table, elseIf.Condition)
+			r.resolveBlock(table, elseIf.Block)
+		}
+		r.resolveBlock(table, stmt.ElseBlock)
+	case *ast.StmtSwitch:
+		r.resolveSwitch(table, stmt.Token, stmt.Value, stmt.Cases, false)
+	case *ast.StmtDefer:
+		r.resolveBlock(table, stmt.Block)
+	case *ast.StmtReturn:
+		if stmt.Expr != nil {
+			r.resolveExpr(table, stmt.Expr)
+		}
+	}
+}
+
+func (r *resolver) resolveExpr(table *ast.SymbolTable, expr ast.Expr) {
+	switch expr := expr.(type) {
+	case *ast.ExprIdentifier:
+		sym, ok := table.Use(expr.Name)
+		if !ok {
+			r.reportUndefined(table, expr.Name)
+			return
+		}
+		r.checkDeprecated(expr.Name, sym.Decl)
+	case *ast.ExprArray:
+		for _, el := range expr.Elements {
+			r.resolveExpr(table, el)
+		}
+	case *ast.ExprDict:
+		for _, entry := range expr.Entries {
+			r.resolveExpr(table, entry.Key)
+			r.resolveExpr(table, entry.Value)
+		}
+	case *ast.ExprFunc:
+		r.resolveFunc(expr)
+	case *ast.ExprMemberAccess:
+		r.resolveExpr(table, expr.Target)
+		r.checkModuleMember(table, expr)
+		r.checkDeprecatedFields(r.typeScope(table).StaticData(expr.Target), expr.Property)
+	case *ast.ExprIndexAccess:
+		r.resolveExpr(table, expr.Target)
+		r.resolveExpr(table, expr.IndexExpr)
+	case *ast.ExprInvocation:
+		r.resolveExpr(table, expr.Function)
+		for _, arg := range expr.Arguments {
+			r.resolveExpr(table, arg)
+		}
+		for _, arg := range expr.NamedArguments {
+			r.resolveExpr(table, arg.Value)
+		}
+		data := r.typeScope(table).StaticData(expr)
+		for _, arg := range expr.NamedArguments {
+			r.checkDeprecatedFields(data, arg.Name)
+		}
+	case *ast.ExprWith:
+		r.resolveExpr(table, expr.Target)
+		data := r.typeScope(table).StaticData(expr.Target)
+		for _, field := range expr.Fields {
+			r.resolveExpr(table, field.Value)
+			r.checkDeprecatedFields(data, field.Name)
+		}
+	case *ast.ExprOperatorUnary:
+		r.resolveExpr(table, expr.Expr)
+	case *ast.ExprOperatorBinary:
+		r.resolveExpr(table, expr.Left)
+		r.resolveExpr(table, expr.Right)
+	case ast.ExprIf:
+		r.resolveExpr(table, expr.Condition)
+		r.resolveExpr(table, expr.ThenExpr)
+		for _, elseIf := range expr.ElseIf {
+			r.resolveExpr(table, elseIf.Condition)
+			r.resolveExpr(table, elseIf.Then)
+		}
+		r.resolveExpr(table, expr.ElseExpr)
+	case *ast.ExprSwitch:
+		r.resolveSwitch(table, expr.Token, expr.Value, expr.Cases, true)
+	case *ast.ExprTypeSwitch:
+		r.resolveExpr(table, expr.Type)
+		for _, key := range expr.CaseOrder {
+			r.resolveExpr(table, expr.Cases[key.Value])
+		}
+	case *ast.ExprPropagate:
+		r.resolveExpr(table, expr.Value)
+	case *ast.ExprPanic:
+		r.resolveExpr(table, expr.Value)
+	}
+}
+
+func (r *resolver) resolveSwitch(table *ast.SymbolTable, tok token.Token, value ast.Expr, cases []ast.SwitchCase, isExpr bool) {
+	r.resolveExpr(table, value)
+	for _, sc := range cases {
+		if sc.Type != nil {
+			for _, arg := range sc.Type.Arguments {
+				r.resolveExpr(table, arg)
+			}
+		}
+		if sc.Value != nil {
+			r.resolveExpr(table, sc.Value)
+		}
+		r.resolveBlock(table, sc.Block)
+		if sc.Expr != nil {
+			r.resolveExpr(table, sc.Expr)
+		}
+	}
+	r.checkSwitch(table, tok, value, cases, isExpr)
+}
+
+func (r *resolver) reportUndefined(table *ast.SymbolTable, name ast.Identifier) {
+	if suggestion, ok := suggest(table, name.Value); ok {
+		r.report(name.Token, SeverityError, "undefined name", "%q is not declared, did you mean %q?", name.Value, suggestion)
+		return
+	}
+	r.report(name.Token, SeverityError, "undefined name", "%q is not declared", name.Value)
+}
@@ -0,0 +1,444 @@
+package resolve_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/lexer"
+	"github.com/vknabel/zirric/parser"
+	"github.com/vknabel/zirric/registry"
+	"github.com/vknabel/zirric/registry/staticmodule"
+	"github.com/vknabel/zirric/resolve"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		label string
+		input string
+		want  []string
+	}{
+		{
+			label: "all names used",
+			input: `
+			data Person { name }
+			func greet(person) {
+				let greeting = "Hello "
+				return greeting + person.name
+			}
+			greet(Person("Max"))
+			`,
+		},
+		{
+			label: "undefined names",
+			input: `
+			func greet(person) {
+				return persn.name + unknown
+			}
+			greet(1)
+			gret(2)
+			`,
+			want: []string{
+				`warning: unused parameter, person is never used`,
+				`error: undefined name, "persn" is not declared, did you mean "person"?`,
+				`error: undefined name, "unknown" is not declared`,
+				`error: undefined name, "gret" is not declared, did you mean "greet"?`,
+			},
+		},
+		{
+			label: "functions declared later",
+			input: `
+			func first() {
+				return second()
+			}
+			func second() {
+				return 2
+			}
+			first()
+			`,
+		},
+		{
+			label: "unused imports",
+			input: `
+			import strings
+			import lists
+			lists.map
+			`,
+			want: []string{`warning: unused import, strings is imported but never used`},
+		},
+		{
+			label: "unused locals and parameters",
+			input: `
+			func example(used, unused, _ignored) {
+				let value = used
+				let other = 1
+				return value
+			}
+			example(1, 2, 3)
+			`,
+			want: []string{
+				`warning: unused parameter, unused is never used`,
+				`warning: unused local, other is never used`,
+			},
+		},
+		{
+			label: "unused private declarations",
+			input: `
+			func _helper() {
+				return 1
+			}
+			func _used() {
+				return 2
+			}
+			let _unset = 3
+			data _Private { value }
+			_used()
+			`,
+			want: []string{
+				`warning: unused private declaration, _helper is never used`,
+				`warning: unused private declaration, _unset is never used`,
+				`warning: unused private declaration, _Private is never used`,
+			},
+		},
+		{
+			label: "shadowed names",
+			input: `
+			let count = 1
+			func increment(count) {
+				return count + 1
+			}
+			increment(count)
+			`,
+			want: []string{`warning: shadowed name, count shadows the declaration in an outer scope`},
+		},
+		{
+			label: "enum cases are used",
+			input: `
+			data _Circle { radius }
+			enum Shape {
+				_Circle
+			}
+			Shape
+			`,
+		},
+		{
+			label: "deprecated declarations",
+			input: `
+			@Deprecated("use greet")
+			func hello() {
+				return 1
+			}
+			@Deprecated
+			data Legacy { value }
+			data Person {
+				name
+				@Deprecated("use name") fullName
+			}
+			hello()
+			Legacy(1)
+			let person = Person(name: "Max", fullName: "Max")
+			person.fullName
+			person with { fullName: "Moritz" }
+			`,
+			want: []string{
+				`warning: deprecated, hello is deprecated: use greet`,
+				`warning: deprecated, Legacy is deprecated: without alternative`,
+				`warning: deprecated, fullName is deprecated: use name`,
+				`warning: deprecated, fullName is deprecated: use name`,
+				`warning: deprecated, fullName is deprecated: use name`,
+			},
+		},
+		{
+			label: "suppressed warnings",
+			input: `
+			@Deprecated("use greet")
+			func hello() {
+				return 1
+			}
+			@Suppress("deprecated")
+			func legacy() {
+				return hello()
+			}
+			@Suppress("deprecated")
+			let value = hello()
+			func example(@Suppress("unused parameter") unused) {
+				return value
+			}
+			legacy()
+			example(1)
+			`,
+		},
+		{
+			label: "exhaustive switches",
+			input: `
+			annotation Round {}
+			@Round
+			data Circle
+			data Square
+			data Triangle
+			enum Polygon {
+				Square
+				Triangle
+			}
+			enum Shape {
+				Circle
+				Polygon
+			}
+			func area(@Shape shape) {
+				switch shape {
+				case @Circle:
+					return 1
+				case @Polygon:
+					return 2
+				}
+			}
+			func name(@Shape shape) {
+				return switch shape {
+				case @Has(Round):
+					"round"
+				case @Square:
+					"square"
+				case _:
+					"other"
+				}
+			}
+			area(Circle())
+			name(Square())
+			`,
+		},
+		{
+			label: "non-exhaustive switches",
+			input: `
+			data Circle
+			data Square
+			data Triangle
+			enum Shape {
+				Circle
+				Square
+				Triangle
+			}
+			func area(@Shape shape) {
+				switch shape {
+				case @Circle:
+					return 1
+				}
+				return 0
+			}
+			func name(@Shape shape) {
+				return switch shape {
+				case @Circle:
+					"circle"
+				case @Square:
+					"square"
+				}
+			}
+			func describe(value) {
+				return switch value {
+				case 1:
+					"one"
+				}
+			}
+			area(Circle())
+			name(Square())
+			describe(1)
+			`,
+			want: []string{
+				`warning: non-exhaustive switch, switch over shape does not match @Square, @Triangle`,
+				`error: non-exhaustive switch, switch over shape does not match @Triangle`,
+				`error: non-exhaustive switch, switch over value requires a default case _`,
+			},
+		},
+		{
+			label: "unreachable cases",
+			input: `
+			annotation Round {}
+			@Round
+			data Circle
+			@Round
+			data Ellipse
+			data Square
+			enum Shape {
+				Circle
+				Ellipse
+				Square
+			}
+			func name(@Shape shape) {
+				return switch shape {
+				case @Has(Round):
+					"round"
+				case @Circle:
+					"circle"
+				case @Square:
+					"square"
+				case _:
+					"other"
+				case @Ellipse:
+					"ellipse"
+				}
+			}
+			name(Square())
+			`,
+			want: []string{
+				`warning: unreachable case, case @Circle is unreachable, earlier cases already match @Circle`,
+				`warning: unreachable case, case @Ellipse is unreachable after the default case _`,
+			},
+		},
+		{
+			label: "duplicate values",
+			input: `
+			func name(n) {
+				return switch n {
+				case 1:
+					"one"
+				case "1":
+					"string"
+				case 1:
+					"again"
+				case 1.0:
+					"float"
+				case null:
+					"null"
+				case null:
+					"null again"
+				case _:
+					"other"
+				}
+			}
+			name(1)
+			`,
+			want: []string{
+				`warning: unreachable case, case 1 is unreachable, an earlier case already matches 1`,
+				`warning: unreachable case, case null is unreachable, an earlier case already matches null`,
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.label), func(t *testing.T) {
+			src := prepareSourceFileParsing(t, tt.input)
+
+			diags := resolve.Resolve(src)
+			got := make([]string, len(diags))
+			for i, d := range diags {
+				got[i] = d.Severity.String() + ": " + d.Summary + ", " + d.Details
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("unexpected diagnostics\nwant:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestPrivateDeclarationsOfOtherModules(t *testing.T) {
+	prelude := staticmodule.NewModule("testing:///prelude", []registry.Source{
+		staticmodule.NewSourceString("testing:///prelude/array.zirr", `
+		func map(values) {
+			return _arrayIterate(values)
+		}
+		func _arrayIterate(values) {
+			return values
+		}
+		`),
+	})
+	mp := parser.NewModuleParse(prelude)
+	preludeModule, err := mp.Parse(prelude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules := func(name ast.ModuleName) (*ast.ContextModule, bool) {
+		return preludeModule, ast.StaticReference(name).String() == "prelude"
+	}
+
+	src := prepareSourceFileParsing(t, `
+	import prelude { map, _arrayIterate }
+	map(_arrayIterate)
+	prelude._arrayIterate
+	`)
+
+	var got []string
+	for _, d := range resolve.Errors(resolve.ResolveWithModules(src, modules)) {
+		declared := "unknown"
+		if d.Declaration != nil {
+			declared = fmt.Sprintf("%s %q", d.Declaration.Source.File, d.Declaration.Literal)
+		}
+		got = append(got, fmt.Sprintf("%s %q: %s, %s (declared in %s)", d.Token.Source.File, d.Token.Literal, d.Summary, d.Details, declared))
+	}
+	want := []string{
+		`testing:///test/test.zirr "_arrayIterate": private declaration, _arrayIterate is private to module prelude (declared in testing:///prelude/array.zirr "_arrayIterate")`,
+		`testing:///test/test.zirr "_arrayIterate": private declaration, _arrayIterate is private to module prelude (declared in testing:///prelude/array.zirr "_arrayIterate")`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected diagnostics\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestEnumCasesOfOtherModules(t *testing.T) {
+	shapes := staticmodule.NewModule("testing:///shapes", []registry.Source{
+		staticmodule.NewSourceString("testing:///shapes/shapes.zirr", `
+		data Circle
+		data Square
+		enum Polygon {
+			Square
+		}
+		`),
+	})
+	mp := parser.NewModuleParse(shapes)
+	shapesModule, err := mp.Parse(shapes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules := func(name ast.ModuleName) (*ast.ContextModule, bool) {
+		return shapesModule, ast.StaticReference(name).String() == "shapes"
+	}
+
+	src := prepareSourceFileParsing(t, `
+	import shapes
+	import shapes { Polygon }
+	data Triangle
+	enum Shape {
+		shapes.Circle
+		Polygon
+		Triangle
+	}
+	func area(@Shape shape) {
+		switch shape {
+		case @shapes.Circle:
+			return 1
+		case @shapes.Square:
+			return 2
+		}
+		return 0
+	}
+	area(Triangle())
+	`)
+
+	var got []string
+	for _, d := range resolve.ResolveWithModules(src, modules) {
+		got = append(got, d.Error())
+	}
+	want := []string{
+		`testing:///test/test.zirr:11:3: resolve warning: non-exhaustive switch, switch over shape does not match @Triangle`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected diagnostics\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func prepareSourceFileParsing(t *testing.T, input string) *ast.SourceFile {
+	t.Helper()
+
+	l, err := lexer.New(staticmodule.NewSourceString("testing:///test/test.zirr", input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parser.NewSourceParser(l, nil, "test.zirr")
+	srcFile := p.ParseSourceFile()
+	for _, err := range p.Errors() {
+		t.Error(err)
+	}
+	if t.Failed() {
+		t.FailNow()
+	}
+	return srcFile
+}
@@ -0,0 +1,78 @@
+package resolve
+
+import (
+	"github.com/vknabel/zirric/ast"
+)
+
+// maxStaticDataDepth limits how many variables are followed to find the data type of an expression.
+const maxStaticDataDepth = 16
+
+// StaticData returns the data type an expression evaluates to, if it is known at compile time.
+// Variables and data types of imported modules are followed like `people.Person(name: "A")`.
+func (s TypeScope) StaticData(expr ast.Expr) *ast.DeclData {
+	return s.staticData(expr, 0)
+}
+
+func (s TypeScope) staticData(expr ast.Expr, depth int) *ast.DeclData {
+	if depth > maxStaticDataDepth {
+		return nil
+	}
+	switch expr := expr.(type) {
+	case *ast.ExprWith:
+		return s.staticData(expr.Target, depth+1)
+	case *ast.ExprInvocation:
+		ref, ok := staticRef(expr.Function)
+		if !ok {
+			return nil
+		}
+		return s.declaredData(ref)
+	case *ast.ExprIdentifier, *ast.ExprMemberAccess:
+		ref, ok := staticRef(expr)
+		if !ok {
+			return nil
+		}
+		sym, scope, ok := s.Lookup(ref)
+		if !ok {
+			return nil
+		}
+		switch decl := sym.Decl.(type) {
+		case *ast.DeclVariable:
+			if sym.ChildTable != nil {
+				scope.Table = sym.ChildTable
+			}
+			return scope.staticData(decl.Value, depth+1)
+		case *ast.DeclParameter:
+			for _, anno := range decl.Annotations {
+				if data := s.declaredData(anno.Reference); data != nil {
+					return data
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s TypeScope) declaredData(ref ast.StaticReference) *ast.DeclData {
+	sym, _, ok := s.Lookup(ref)
+	if !ok {
+		return nil
+	}
+	data, _ := sym.Decl.(*ast.DeclData)
+	return data
+}
+
+// staticRef returns the reference of an identifier or a member of an imported module like `people.Person`.
+func staticRef(expr ast.Expr) (ast.StaticReference, bool) {
+	switch expr := expr.(type) {
+	case *ast.ExprIdentifier:
+		return ast.StaticReference{expr.Name}, true
+	case *ast.ExprMemberAccess:
+		target, ok := expr.Target.(*ast.ExprIdentifier)
+		if !ok {
+			return nil, false
+		}
+		return ast.StaticReference{target.Name, expr.Property}, true
+	default:
+		return nil, false
+	}
+}
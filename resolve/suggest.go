@@ -0,0 +1,48 @@
+package resolve
+
+import (
+	"github.com/vknabel/zirric/ast"
+)
+
+// maxSuggestionDistance limits how many edits a suggested name may differ.
+const maxSuggestionDistance = 2
+
+// suggest returns the most similar declared name visible from table.
+func suggest(table *ast.SymbolTable, name string) (string, bool) {
+	best, bestDist := "", maxSuggestionDistance+1
+	for st := table; st != nil; st = st.Parent {
+		for candidate, sym := range st.Symbols {
+			if sym.Original().Decl == nil {
+				continue
+			}
+			dist := editDistance(name, candidate)
+			if dist >= len(name) || dist > bestDist || (dist == bestDist && candidate >= best) {
+				continue
+			}
+			best, bestDist = candidate, dist
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance returns the Levenshtein distance between two names.
+func editDistance(a, b string) int {
+	lhs, rhs := []rune(a), []rune(b)
+	prev := make([]int, len(rhs)+1)
+	curr := make([]int, len(rhs)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(lhs); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rhs); j++ {
+			cost := 1
+			if lhs[i-1] == rhs[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rhs)]
+}
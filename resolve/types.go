@@ -0,0 +1,174 @@
+package resolve
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/vknabel/zirric/ast"
+)
+
+// maxEnumDepth limits how deeply nested enums are flattened into their cases.
+const maxEnumDepth = 16
+
+// TypeScope looks up types where they are declared, including the members of imported modules.
+type TypeScope struct {
+	Table *ast.SymbolTable
+	// Looks up imported modules, nil if they are not known.
+	Modules Modules
+}
+
+// typeScope looks up types within table and the imported modules.
+func (r *resolver) typeScope(table *ast.SymbolTable) TypeScope {
+	return TypeScope{Table: table, Modules: r.modules}
+}
+
+// Lookup finds the declaration of a type reference like `Person`, `people.Person` or an imported member.
+// Undeclared names like `Int` without a prelude resolve to a symbol without declaration.
+// The returned scope looks up the references of the declaration like enum cases.
+func (s TypeScope) Lookup(ref ast.StaticReference) (*ast.Symbol, TypeScope, bool) {
+	sym, ok := s.Table.Resolve(ref[0].Value)
+	if !ok || sym.Decl == nil {
+		if len(ref) != 1 {
+			return nil, s, false
+		}
+		return &ast.Symbol{Name: ref[0].Value}, s, true
+	}
+
+	var (
+		module ast.ModuleName
+		member string
+	)
+	switch decl := sym.Decl.(type) {
+	case *ast.DeclImportMember:
+		if len(ref) != 1 {
+			return nil, s, false
+		}
+		module, member = decl.ModuleName, decl.Name.Value
+	case *ast.DeclImport:
+		if len(ref) != 2 {
+			return nil, s, false
+		}
+		module, member = decl.ModuleName, ref[1].Value
+	default:
+		return sym, s, len(ref) == 1
+	}
+	if s.Modules == nil || ast.IsPrivate(member) {
+		return nil, s, false
+	}
+	mod, ok := s.Modules(module)
+	if !ok {
+		return nil, s, false
+	}
+	sym, ok = mod.Symbols.Symbols[member]
+	if !ok || sym.Decl == nil {
+		return nil, s, false
+	}
+	return sym, TypeScope{Table: mod.Symbols, Modules: s.Modules}, true
+}
+
+// Types flattens the type of ref into the data and extern types it matches.
+// Enums match the types of all of their cases, including nested enums and cases of other modules.
+// Reports false for declarations, that are no types, unknown references and too deeply nested enums.
+func (s TypeScope) Types(ref ast.StaticReference) ([]*ast.Symbol, bool) {
+	var types []*ast.Symbol
+	ok := s.appendTypes(&types, ref, 0)
+	return types, ok
+}
+
+func (s TypeScope) appendTypes(types *[]*ast.Symbol, ref ast.StaticReference, depth int) bool {
+	if depth > maxEnumDepth {
+		return false
+	}
+	sym, scope, ok := s.Lookup(ref)
+	if !ok {
+		return false
+	}
+	switch decl := sym.Decl.(type) {
+	case nil, *ast.DeclData, *ast.DeclExternType:
+		if !slices.ContainsFunc(*types, func(t *ast.Symbol) bool { return sameType(t, sym) }) {
+			*types = append(*types, sym)
+		}
+		return true
+	case *ast.DeclEnum:
+		return scope.appendCases(types, decl, depth)
+	default:
+		return false
+	}
+}
+
+// Cases flattens the cases of an enum declared within the scope like Types.
+func (s TypeScope) Cases(enum *ast.DeclEnum) ([]*ast.Symbol, bool) {
+	var types []*ast.Symbol
+	ok := s.appendCases(&types, enum, 0)
+	return types, ok
+}
+
+func (s TypeScope) appendCases(types *[]*ast.Symbol, enum *ast.DeclEnum, depth int) bool {
+	for _, cs := range enum.Cases {
+		if !s.appendTypes(types, cs.Case, depth+1) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameType reports whether both symbols refer to the same type.
+// Undeclared types are equal by name.
+func sameType(lhs, rhs *ast.Symbol) bool {
+	if lhs.Decl == nil || rhs.Decl == nil {
+		return lhs.Decl == nil && rhs.Decl == nil && lhs.Name == rhs.Name
+	}
+	return lhs.Original() == rhs.Original()
+}
+
+// Annotated returns all data and extern types annotated with the annotation ref refers to,
+// that are declared within the scope or by one of the given modules.
+// Reports false if ref is no annotation.
+func (s TypeScope) Annotated(ref ast.StaticReference, modules ...*ast.ContextModule) ([]*ast.Symbol, bool) {
+	anno, _, ok := s.Lookup(ref)
+	if !ok {
+		return nil, false
+	}
+	if _, ok := anno.Decl.(*ast.DeclAnnotation); !ok {
+		return nil, false
+	}
+
+	scopes := make([]TypeScope, 0, len(modules)+1)
+	for st := s.Table; st != nil; st = st.Parent {
+		scopes = append(scopes, TypeScope{Table: st, Modules: s.Modules})
+	}
+	for _, mod := range modules {
+		scopes = append(scopes, TypeScope{Table: mod.Symbols, Modules: s.Modules})
+	}
+
+	var types []*ast.Symbol
+	for _, scope := range scopes {
+		for _, sym := range scope.Table.Symbols {
+			if sym.Original() != sym {
+				// captured from a parent table
+				continue
+			}
+			switch sym.Decl.(type) {
+			case *ast.DeclData, *ast.DeclExternType:
+				if scope.annotatedWith(annotationsOf(sym.Decl), anno) && !slices.Contains(types, sym) {
+					types = append(types, sym)
+				}
+			}
+		}
+	}
+	slices.SortFunc(types, func(lhs, rhs *ast.Symbol) int {
+		return strings.Compare(lhs.Name, rhs.Name)
+	})
+	return types, true
+}
+
+// annotatedWith reports whether the annotations contain an instance of anno.
+func (s TypeScope) annotatedWith(annos ast.AnnotationChain, anno *ast.Symbol) bool {
+	for _, inst := range annos {
+		sym, _, ok := s.Lookup(inst.Reference)
+		if ok && sym.Decl != nil && sym.Original() == anno.Original() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package resolve
+
+import (
+	"strings"
+
+	"github.com/vknabel/zirric/ast"
+)
+
+// checkTable reports unused and shadowing declarations of a table and all of its child tables.
+// Warnings suppressed by a declaration also apply to its children.
+func (r *resolver) checkTable(table *ast.SymbolTable, usages map[*ast.Symbol]int, visited map[*ast.SymbolTable]bool) {
+	if table == nil || visited[table] {
+		return
+	}
+	visited[table] = true
+
+	for _, sym := range sortedSymbols(table) {
+		restore := r.suppress(annotationsOf(sym.Decl))
+		if usages[sym] == 0 {
+			r.checkUnused(table, sym)
+		}
+		r.checkShadowing(table, sym)
+		r.checkTable(sym.ChildTable, usages, visited)
+		restore()
+	}
+}
+
+// usageCounts counts the usages of each declaration, including those of captured free symbols.
+func usageCounts(tables []*ast.SymbolTable) map[*ast.Symbol]int {
+	counts := make(map[*ast.Symbol]int)
+	var count func(st *ast.SymbolTable, visited map[*ast.SymbolTable]bool)
+	count = func(st *ast.SymbolTable, visited map[*ast.SymbolTable]bool) {
+		if st == nil || visited[st] {
+			return
+		}
+		visited[st] = true
+		for _, sym := range st.Symbols {
+			counts[sym.Original()] += len(sym.Usages)
+			if sym.Original() == sym {
+				count(sym.ChildTable, visited)
+			}
+		}
+	}
+	visited := make(map[*ast.SymbolTable]bool)
+	for _, table := range tables {
+		count(table, visited)
+	}
+	return counts
+}
+
+func (r *resolver) checkUnused(table *ast.SymbolTable, sym *ast.Symbol) {
+	name := sym.Decl.DeclName()
+	switch decl := sym.Decl.(type) {
+	case *ast.DeclImport:
+		if len(decl.Members) > 0 {
+			// used by its members
+			return
+		}
+		r.report(name.Token, SeverityWarning, "unused import", "%s is imported but never used", name.Value)
+	case *ast.DeclImportMember:
+		r.report(name.Token, SeverityWarning, "unused import", "%s is imported but never used", name.Value)
+	case *ast.DeclParameter:
+		if _, ok := table.OpenedBy.(*ast.ExprFunc); !ok || strings.HasPrefix(name.Value, "_") {
+			// extern functions and fields have no body to use them
+			return
+		}
+		r.report(name.Token, SeverityWarning, "unused parameter", "%s is never used", name.Value)
+	case *ast.DeclVariable:
+		if decl.ExportScope() == ast.ExportScopeLocal {
+			r.report(name.Token, SeverityWarning, "unused local", "%s is never used", name.Value)
+			return
+		}
+		r.checkUnusedPrivate(table, name)
+	case *ast.DeclFunc, *ast.DeclData, *ast.DeclEnum, *ast.DeclAnnotation, *ast.DeclExternFunc:
+		r.checkUnusedPrivate(table, name)
+	}
+}
+
+// checkUnusedPrivate reports module level declarations, that are private by their `_` prefix.
+func (r *resolver) checkUnusedPrivate(table *ast.SymbolTable, name ast.Identifier) {
+	if _, ok := table.OpenedBy.(*ast.ExprFunc); ok || !ast.IsPrivate(name.Value) {
+		return
+	}
+	r.report(name.Token, SeverityWarning, "unused private declaration", "%s is never used", name.Value)
+}
+
+// checkShadowing reports parameters and locals of functions, that hide a declaration of an outer scope.
+func (r *resolver) checkShadowing(table *ast.SymbolTable, sym *ast.Symbol) {
+	if _, ok := table.OpenedBy.(*ast.ExprFunc); !ok {
+		return
+	}
+	switch sym.Decl.(type) {
+	case *ast.DeclParameter, *ast.DeclVariable, *ast.DeclFunc:
+	default:
+		return
+	}
+	outer, ok := table.Parent.Resolve(sym.Name)
+	if !ok || outer.Decl == nil {
+		return
+	}
+	name := sym.Decl.DeclName()
+	r.report(name.Token, SeverityWarning, "shadowed name", "%s shadows the declaration in an outer scope", name.Value)
+}
@@ -0,0 +1,90 @@
+package resolve
+
+import (
+	"github.com/vknabel/zirric/ast"
+)
+
+// Modules looks up an imported module by its name.
+type Modules func(name ast.ModuleName) (*ast.ContextModule, bool)
+
+// checkImport reports imported members, that are private to their module
+// or not declared by a known module.
+func (r *resolver) checkImport(decl *ast.DeclImport) {
+	if r.modules != nil {
+		mod, ok := r.modules(decl.ModuleName)
+		if !ok {
+			r.report(decl.Token, SeverityError, "unknown module", "module %s is not declared", ast.StaticReference(decl.ModuleName))
+			return
+		}
+		if reason, ok := moduleDeprecation(mod); ok {
+			r.report(decl.Token, SeverityWarning, "deprecated", "module %s is deprecated: %s", ast.StaticReference(decl.ModuleName), reason)
+		}
+	}
+	for _, member := range decl.Members {
+		if ast.IsPrivate(member.Name.Value) {
+			r.reportPrivate(member.Name, decl.ModuleName)
+			continue
+		}
+		r.checkDeclared(member.Name, decl.ModuleName)
+	}
+}
+
+// checkModuleMember reports accesses like `prelude._arrayIterate` on imported modules
+// and members, that are not declared by a known module.
+func (r *resolver) checkModuleMember(table *ast.SymbolTable, expr *ast.ExprMemberAccess) {
+	target, ok := expr.Target.(*ast.ExprIdentifier)
+	if !ok {
+		return
+	}
+	sym, ok := table.Resolve(target.Name.Value)
+	if !ok {
+		return
+	}
+	decl, ok := sym.Decl.(*ast.DeclImport)
+	if !ok {
+		return
+	}
+	if ast.IsPrivate(expr.Property.Value) {
+		r.reportPrivate(expr.Property, decl.ModuleName)
+		return
+	}
+	r.checkDeclared(expr.Property, decl.ModuleName)
+}
+
+// checkDeclared reports members of known modules, that are not declared,
+// and warns about deprecated ones.
+func (r *resolver) checkDeclared(use ast.Identifier, module ast.ModuleName) {
+	if r.modules == nil {
+		return
+	}
+	mod, ok := r.modules(module)
+	if !ok {
+		return
+	}
+	if sym, ok := mod.Symbols.Symbols[use.Value]; ok && sym.Decl != nil {
+		r.checkDeprecated(use, sym.Decl)
+		return
+	}
+	r.report(use.Token, SeverityError, "undefined name", "%q is not declared in module %s", use.Value, ast.StaticReference(module))
+}
+
+// reportPrivate reports the use of a private name of another module.
+// If the module is known, the diagnostic also points at the declaration.
+func (r *resolver) reportPrivate(use ast.Identifier, module ast.ModuleName) {
+	moduleName := ast.StaticReference(module).String()
+	diag := r.report(use.Token, SeverityError, "private declaration", "%s is private to module %s", use.Value, moduleName)
+
+	if r.modules == nil {
+		return
+	}
+	mod, ok := r.modules(module)
+	if !ok {
+		return
+	}
+	sym, ok := mod.Symbols.Resolve(use.Value)
+	if !ok || sym.Decl == nil {
+		return
+	}
+	declared := sym.Decl.DeclName().Token
+	diag.Declaration = &declared
+}
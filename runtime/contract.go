@@ -0,0 +1,89 @@
+package runtime
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Contract is a runtime check of an annotated parameter, field or return value.
+// A value satisfies a contract, if it passes all of its checks.
+type Contract struct {
+	// Subject names the checked value like `parameter n of twice`.
+	Subject string
+	Checks  []ContractCheck
+}
+
+// ContractCheck accepts values of a set of types.
+type ContractCheck struct {
+	// Want describes the requirement like `@Int` or `@Has(Countable)`.
+	Want string
+	// Builtins are the names of accepted prelude types like `Int` or `Func`.
+	Builtins []string
+	// Types are the constant ids of accepted data types.
+	Types []TypeId
+}
+
+// Check reports the first check, that is not satisfied by the value.
+// Data values are named by the data types within constants.
+func (ct *Contract) Check(constants []RuntimeValue, v RuntimeValue) error {
+	for _, check := range ct.Checks {
+		if check.accepts(v) {
+			continue
+		}
+		return fmt.Errorf("contract violation for %s: want %s, got %s", ct.Subject, check.Want, TypeName(constants, v))
+	}
+	return nil
+}
+
+// Accepts reports whether the value satisfies all checks.
+func (ct *Contract) Accepts(v RuntimeValue) bool {
+	for _, check := range ct.Checks {
+		if !check.accepts(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (check ContractCheck) accepts(v RuntimeValue) bool {
+	if dv, ok := v.(*DataValue); ok {
+		return slices.Contains(check.Types, dv.TypeId)
+	}
+	return slices.Contains(check.Builtins, TypeName(nil, v))
+}
+
+// TypeName returns the name of the type of a value.
+// Data values are only named, if their data type is part of constants.
+func TypeName(constants []RuntimeValue, v RuntimeValue) string {
+	switch v := v.(type) {
+	case Array:
+		return "Array"
+	case Bool:
+		return "Bool"
+	case Char:
+		return "Char"
+	case Dict:
+		return "Dict"
+	case Float:
+		return "Float"
+	case Int:
+		return "Int"
+	case Null:
+		return "Null"
+	case String:
+		return "String"
+	case *CompiledFunction, *Closure, ExternFunc, *DataType:
+		return "Func"
+	case *Module:
+		return "Module"
+	case *DataValue:
+		if int(v.TypeId) < len(constants) {
+			if dt, ok := constants[v.TypeId].(*DataType); ok {
+				return dt.Name
+			}
+		}
+		return fmt.Sprintf("data #%d", v.TypeId)
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,56 @@
+package runtime
+
+import "reflect"
+
+// Equal reports whether two values are equal.
+// Arrays, dicts and data values are equal, if they hold equal values.
+// Functions, types and modules are only equal to themselves.
+func Equal(lhs, rhs RuntimeValue) bool {
+	switch lhs := lhs.(type) {
+	case Array:
+		rhs, ok := rhs.(Array)
+		if !ok || len(lhs) != len(rhs) {
+			return false
+		}
+		for i := range lhs {
+			if !Equal(lhs[i], rhs[i]) {
+				return false
+			}
+		}
+		return true
+	case Dict:
+		rhs, ok := rhs.(Dict)
+		if !ok || len(lhs) != len(rhs) {
+			return false
+		}
+		for key, l := range lhs {
+			r, ok := rhs[key]
+			if !ok || !Equal(l, r) {
+				return false
+			}
+		}
+		return true
+	case *DataValue:
+		rhs, ok := rhs.(*DataValue)
+		if !ok || lhs.TypeId != rhs.TypeId || len(lhs.Values) != len(rhs.Values) {
+			return false
+		}
+		for i := range lhs.Values {
+			if !Equal(lhs.Values[i], rhs.Values[i]) {
+				return false
+			}
+		}
+		return true
+	case ExternFunc:
+		// implementations can't be compared
+		rhs, ok := rhs.(ExternFunc)
+		return ok && lhs.name == rhs.name
+	default:
+		// comparing values of uncomparable types like those of plugins would panic
+		t := reflect.TypeOf(lhs)
+		if t == nil || t != reflect.TypeOf(rhs) {
+			return lhs == rhs
+		}
+		return t.Comparable() && lhs == rhs
+	}
+}
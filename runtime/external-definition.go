@@ -10,6 +10,21 @@ type ExternPluginRegistry struct {
 	plugins []ExternPlugin
 }
 
+func MakeExternPluginRegistry(plugins ...ExternPlugin) *ExternPluginRegistry {
+	return &ExternPluginRegistry{plugins: plugins}
+}
+
+// Bind asks all plugins for an implementation of an extern declaration.
+// Returns nil if no plugin provides one.
+func (r *ExternPluginRegistry) Bind(module *ast.SymbolTable, decl *ast.Symbol) RuntimeValue {
+	for _, p := range r.plugins {
+		if val := p.Bind(module, decl); val != nil {
+			return val
+		}
+	}
+	return nil
+}
+
 func GetPlugin[P ExternPlugin](reg *ExternPluginRegistry, ref *P) {
 	for _, p := range reg.plugins {
 		plug, ok := p.(P)
@@ -0,0 +1,21 @@
+package runtime
+
+// Panic aborts a task and unwinds its frames until a deferred block recovers.
+type Panic struct {
+	Value RuntimeValue
+	// Cause is the runtime error, that caused the panic. Nil for explicit panics.
+	Cause error
+}
+
+// Error implements error.
+func (p *Panic) Error() string {
+	if p.Cause != nil {
+		return p.Cause.Error()
+	}
+	return "panic: " + p.Value.Inspect()
+}
+
+// Unwrap returns the runtime error, that caused the panic.
+func (p *Panic) Unwrap() error {
+	return p.Cause
+}
@@ -0,0 +1,76 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parameter describes a parameter of a callable value.
+type Parameter struct {
+	Name string
+	// Default is passed when the argument is omitted.
+	// Nil for required parameters.
+	Default RuntimeValue
+	// Variadic parameters collect all remaining positional arguments into an Array.
+	// Only the last parameter may be variadic.
+	Variadic bool
+}
+
+// BindArguments orders the given arguments by the parameters of a callable.
+// Positional arguments come first, named arguments are matched by name
+// and omitted arguments are filled in with their defaults.
+// Excess positional arguments are collected by a variadic parameter.
+func BindArguments(params []Parameter, positional []RuntimeValue, names []string, named []RuntimeValue) ([]RuntimeValue, error) {
+	fixed := len(params)
+	variadic := fixed > 0 && params[fixed-1].Variadic
+	if variadic {
+		fixed--
+	}
+	if len(positional) > fixed && !variadic {
+		return nil, fmt.Errorf("wrong number of arguments: want=%d, got=%d", len(params), len(positional)+len(named))
+	}
+
+	args := make([]RuntimeValue, len(params))
+	copy(args[:fixed], positional)
+	if variadic && len(positional) > fixed {
+		rest := make(Array, len(positional)-fixed)
+		copy(rest, positional[fixed:])
+		args[fixed] = rest
+	}
+
+	for i, name := range names {
+		idx := -1
+		for j, p := range params {
+			if p.Name == name {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown argument %q", name)
+		}
+		if args[idx] != nil {
+			return nil, fmt.Errorf("argument %q passed more than once", name)
+		}
+		args[idx] = named[i]
+	}
+
+	var missing []string
+	for i, p := range params {
+		if args[i] != nil {
+			continue
+		}
+		switch {
+		case p.Default != nil:
+			args[i] = p.Default
+		case p.Variadic:
+			args[i] = Array{}
+		default:
+			missing = append(missing, p.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing arguments %s", strings.Join(missing, ", "))
+	}
+	return args, nil
+}
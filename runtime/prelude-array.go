@@ -1,12 +1,18 @@
 package runtime
 
+import "strings"
+
 var _ RuntimeValue = Array{}
 
 type Array []RuntimeValue
 
 // Inspect implements RuntimeValue.
 func (a Array) Inspect() string {
-	panic("unimplemented")
+	elements := make([]string, len(a))
+	for i, el := range a {
+		elements[i] = el.Inspect()
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
 }
 
 // Lookup implements RuntimeValue.
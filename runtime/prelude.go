@@ -5,7 +5,8 @@ import (
 )
 
 // Declares some TypeId constants for the prelude data types.
-// These are not guaranteed to be constant over versions and are not safe to serialize.
+// These are not guaranteed to be constant over versions.
+// Serialized bytecode depends on them, so changing them requires a new compiler.FormatVersion.
 // They only offer fast creation for literals without excessive lookups.
 // May change in the future.
 // TODO: Either use an alternative or find out how to prefill these.
@@ -0,0 +1,57 @@
+package runtime
+
+import "fmt"
+
+// Failure is a recoverable error of an extern function.
+// Instead of aborting the vm, it is returned as `Err(Error(message))` of the prelude `Result`.
+type Failure struct {
+	Message string
+}
+
+// Error implements error.
+func (f Failure) Error() string {
+	return f.Message
+}
+
+// ResultTypes references the constants of the prelude `Result` types.
+type ResultTypes struct {
+	Ok  int
+	Err int
+	// Error is -1 if not declared. Then failures are wrapped as `Err(message)`.
+	Error int
+}
+
+// MakeErr wraps a failure into an `Err` value.
+func (rt ResultTypes) MakeErr(constants []RuntimeValue, failure Failure) (RuntimeValue, error) {
+	reason, err := rt.MakeError(constants, failure.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	dt, err := rt.dataType(constants, rt.Err)
+	if err != nil {
+		return nil, err
+	}
+	return MakeDataValue(dt, []RuntimeValue{reason}), nil
+}
+
+// MakeError wraps a message into an `Error` value.
+// Without a declared `Error`, the message is returned as String.
+func (rt ResultTypes) MakeError(constants []RuntimeValue, message string) (RuntimeValue, error) {
+	if rt.Error < 0 {
+		return String(message), nil
+	}
+	dt, err := rt.dataType(constants, rt.Error)
+	if err != nil {
+		return nil, err
+	}
+	return MakeDataValue(dt, []RuntimeValue{String(message)}), nil
+}
+
+func (ResultTypes) dataType(constants []RuntimeValue, id int) (*DataType, error) {
+	dt, ok := constants[id].(*DataType)
+	if !ok {
+		return nil, fmt.Errorf("result constant %d is not a data type (%T)", id, constants[id])
+	}
+	return dt, nil
+}
@@ -12,5 +12,8 @@ type RuntimeValue interface {
 
 type CallableRuntimeValue interface {
 	RuntimeValue
+	// The amount of parameters, excluding a variadic one.
 	Arity() int
+	IsVariadic() bool
+	Parameters() []Parameter
 }
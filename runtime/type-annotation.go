@@ -0,0 +1,37 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/vknabel/zirric/ast"
+)
+
+var _ RuntimeValue = &AnnotationType{}
+
+type AnnotationType struct {
+	Name string
+	// The constant id of the annotation.
+	Id TypeId
+}
+
+func MakeAnnotationType(symbol *ast.Symbol) (*AnnotationType, error) {
+	if _, ok := symbol.Decl.(*ast.DeclAnnotation); !ok {
+		return nil, fmt.Errorf("declaration is not a DeclAnnotation, got %T", symbol.Decl)
+	}
+	return &AnnotationType{Name: symbol.Name, Id: TypeId(*symbol.ConstantId)}, nil
+}
+
+// Inspect implements RuntimeValue.
+func (at *AnnotationType) Inspect() string {
+	return fmt.Sprintf("annotation %s", at.Name)
+}
+
+// Lookup implements RuntimeValue.
+func (*AnnotationType) Lookup(name string) RuntimeValue {
+	return nil
+}
+
+// TypeConstantId implements RuntimeValue.
+func (at *AnnotationType) TypeConstantId() TypeId {
+	return at.Id
+}
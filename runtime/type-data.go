@@ -9,8 +9,16 @@ import (
 var _ CallableRuntimeValue = &DataType{}
 
 type DataType struct {
-	Symbol       *ast.Symbol
-	FieldSymbols []*ast.Symbol
+	Name string
+	// The constant id of the data type, that identifies its values.
+	Id TypeId
+	// Names of the fields in declaration order.
+	Fields []string
+
+	// Defaults of the fields, nil for required ones.
+	Defaults []RuntimeValue
+	// Contracts of the fields, nil for unchecked ones.
+	Contracts []*Contract
 }
 
 func MakeDataType(symbol *ast.Symbol) (*DataType, error) {
@@ -18,32 +26,54 @@ func MakeDataType(symbol *ast.Symbol) (*DataType, error) {
 	if !ok {
 		return nil, fmt.Errorf("declaration is not a DeclData, got %T", symbol.Decl)
 	}
-	fieldSymbols := make([]*ast.Symbol, len(decl.Fields))
+	fields := make([]string, len(decl.Fields))
 	for i, f := range decl.Fields {
 		for _, fsym := range symbol.ChildTable.Symbols {
+			if fsym.Decl == nil {
+				// unresolved references like annotations
+				continue
+			}
 			if fsym.Decl.DeclName().String() == f.DeclName().String() {
-				fieldSymbols[i] = fsym
+				fields[i] = fsym.Name
 			}
 		}
-		if fieldSymbols[i] == nil {
+		if fields[i] == "" {
 			return nil, fmt.Errorf("no symbol for field: %q", f.DeclName().String())
 		}
 	}
 
 	return &DataType{
-		Symbol:       symbol,
-		FieldSymbols: fieldSymbols,
+		Name:   symbol.Name,
+		Id:     TypeId(*symbol.ConstantId),
+		Fields: fields,
 	}, nil
 }
 
 // Arity implements Callable.
 func (dt *DataType) Arity() int {
-	return len(dt.FieldSymbols)
+	return len(dt.Fields)
+}
+
+// IsVariadic implements Callable.
+func (dt *DataType) IsVariadic() bool {
+	return false
+}
+
+// Parameters implements Callable.
+func (dt *DataType) Parameters() []Parameter {
+	params := make([]Parameter, len(dt.Fields))
+	for i, f := range dt.Fields {
+		params[i].Name = f
+		if i < len(dt.Defaults) {
+			params[i].Default = dt.Defaults[i]
+		}
+	}
+	return params
 }
 
 // Inspect implements Callable.
 func (dt *DataType) Inspect() string {
-	return fmt.Sprintf("data %s", dt.Symbol.Decl.DeclName())
+	return fmt.Sprintf("data %s", dt.Name)
 }
 
 // Lookup implements Callable.
@@ -53,5 +83,5 @@ func (dt *DataType) Lookup(name string) RuntimeValue {
 
 // TypeConstantId implements Callable.
 func (dt *DataType) TypeConstantId() TypeId {
-	return TypeId(*dt.Symbol.TypeSymbol.ConstantId)
+	return typeIdFunc
 }
@@ -9,12 +9,23 @@ import (
 var _ RuntimeValue = &EnumType{}
 
 type EnumType struct {
-	symbol *ast.Symbol
+	Name string
+	// The constant id of the enum.
+	Id TypeId
+	// The constant ids of the cases, that may be enums themselves.
+	Cases []TypeId
+}
+
+func MakeEnumType(symbol *ast.Symbol) (*EnumType, error) {
+	if _, ok := symbol.Decl.(*ast.DeclEnum); !ok {
+		return nil, fmt.Errorf("declaration is not a DeclEnum, got %T", symbol.Decl)
+	}
+	return &EnumType{Name: symbol.Name, Id: TypeId(*symbol.ConstantId)}, nil
 }
 
 // Inspect implements RuntimeValue.
 func (et *EnumType) Inspect() string {
-	return fmt.Sprintf("data %s", et.symbol.Decl.DeclName())
+	return fmt.Sprintf("enum %s", et.Name)
 }
 
 // Lookup implements RuntimeValue.
@@ -24,5 +35,5 @@ func (*EnumType) Lookup(name string) RuntimeValue {
 
 // TypeConstantId implements RuntimeValue.
 func (et *EnumType) TypeConstantId() TypeId {
-	return TypeId(*et.symbol.TypeSymbol.ConstantId)
+	return et.Id
 }
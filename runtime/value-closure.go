@@ -20,23 +20,30 @@ func MakeClosure(fun *CompiledFunction, free []RuntimeValue) *Closure {
 
 // Arity implements CallableRuntimeValue.
 func (c *Closure) Arity() int {
-	return c.Fn.Params
+	return c.Fn.Arity()
+}
+
+// IsVariadic implements CallableRuntimeValue.
+func (c *Closure) IsVariadic() bool {
+	return c.Fn.IsVariadic()
+}
+
+// Parameters implements CallableRuntimeValue.
+func (c *Closure) Parameters() []Parameter {
+	return c.Fn.Parameters()
 }
 
 // Inspect implements CallableRuntimeValue.
 func (c *Closure) Inspect() string {
-	return fmt.Sprintf("func %s(#%d)", c.Fn.Symbol.Decl.DeclName(), c.Arity())
+	return fmt.Sprintf("func %s(#%d)", c.Fn.Name, c.Arity())
 }
 
 // Lookup implements CallableRuntimeValue.
 func (c *Closure) Lookup(name string) RuntimeValue {
-	if name == "arity" {
-		return Int(c.Arity())
-	}
-	return nil
+	return c.Fn.Lookup(name)
 }
 
 // TypeConstantId implements CallableRuntimeValue.
 func (c *Closure) TypeConstantId() TypeId {
-	return TypeId(*c.Fn.Symbol.TypeSymbol.ConstantId)
+	return typeIdFunc
 }
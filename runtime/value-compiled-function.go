@@ -12,7 +12,21 @@ var _ CallableRuntimeValue = CompiledFunction{}
 type CompiledFunction struct {
 	Instructions op.Instructions
 	Params       int
-	Symbol       *ast.Symbol
+	Name         string
+
+	// Names of the parameters in declaration order.
+	ParamNames []string
+	// The amount of locals besides the parameters.
+	Locals int
+	// Names of the locals besides the parameters, as far as they are known.
+	LocalNames []string
+	// Maps the instructions to the statements they were compiled from.
+	SourceMap op.SourceMap
+
+	// Defaults of the parameters, nil for required ones.
+	Defaults []RuntimeValue
+	// Whether the last parameter is variadic.
+	Variadic bool
 }
 
 func MakeCompiledFunction(
@@ -20,32 +34,67 @@ func MakeCompiledFunction(
 	params int,
 	symbol *ast.Symbol,
 ) *CompiledFunction {
-	return &CompiledFunction{
+	fn := &CompiledFunction{
 		Instructions: instructions,
 		Params:       params,
-		Symbol:       symbol,
+		Name:         symbol.Name,
+	}
+	if decl, ok := symbol.Decl.(*ast.DeclFunc); ok {
+		fn.ParamNames = make([]string, len(decl.Impl.Parameters))
+		for i, p := range decl.Impl.Parameters {
+			fn.ParamNames[i] = p.Name.Value
+		}
 	}
+	if symbol.ChildTable != nil {
+		// TODO: actually this might be wrong
+		fn.Locals = len(symbol.ChildTable.Symbols) - len(symbol.ChildTable.FreeSymbols)
+	}
+	return fn
 }
 
 // Arity implements CallableRuntimeValue.
 func (c CompiledFunction) Arity() int {
+	if c.Variadic {
+		return c.Params - 1
+	}
 	return c.Params
 }
 
+// IsVariadic implements CallableRuntimeValue.
+func (c CompiledFunction) IsVariadic() bool {
+	return c.Variadic
+}
+
+// Parameters implements CallableRuntimeValue.
+func (c CompiledFunction) Parameters() []Parameter {
+	params := make([]Parameter, len(c.ParamNames))
+	for i, name := range c.ParamNames {
+		params[i].Name = name
+		params[i].Variadic = c.Variadic && i == len(c.ParamNames)-1
+		if i < len(c.Defaults) {
+			params[i].Default = c.Defaults[i]
+		}
+	}
+	return params
+}
+
 // Inspect implements CallableRuntimeValue.
 func (c CompiledFunction) Inspect() string {
-	return fmt.Sprintf("func %s(#%d)", c.Symbol.Decl.DeclName(), c.Arity())
+	return fmt.Sprintf("func %s(#%d)", c.Name, c.Arity())
 }
 
 // Lookup implements CallableRuntimeValue.
 func (c CompiledFunction) Lookup(name string) RuntimeValue {
-	if name == "arity" {
+	switch name {
+	case "arity":
 		return Int(c.Arity())
+	case "isVariadic":
+		return Bool(c.IsVariadic())
 	}
 	return nil
 }
 
 // TypeConstantId implements CallableRuntimeValue.
 func (c CompiledFunction) TypeConstantId() TypeId {
-	return TypeId(*c.Symbol.TypeSymbol.ConstantId)
+	return typeIdFunc
 }
@@ -8,12 +8,20 @@ import (
 
 var _ CallableRuntimeValue = ExternFunc{}
 
+// ExternFuncImpl implements an extern func, that can't fail.
 type ExternFuncImpl func(args []RuntimeValue) RuntimeValue
 
+// FailableExternFuncImpl implements an extern func, that may fail.
+// Returning a Failure results in an Err value, all other errors abort the vm.
+type FailableExternFuncImpl func(args []RuntimeValue) (RuntimeValue, error)
+
 type ExternFunc struct {
-	symbol *ast.Symbol
-	arity  int
-	Impl   ExternFuncImpl
+	name       string
+	paramNames []string
+	arity      int
+	variadic   bool
+	Impl       ExternFuncImpl
+	failable   FailableExternFuncImpl
 }
 
 func MakeExternFunc(symbol *ast.Symbol, impl ExternFuncImpl) (ExternFunc, error) {
@@ -21,7 +29,39 @@ func MakeExternFunc(symbol *ast.Symbol, impl ExternFuncImpl) (ExternFunc, error)
 	if !ok {
 		return ExternFunc{}, fmt.Errorf("declaration is not a DeclExternFunc, got %T", symbol.Decl)
 	}
-	return ExternFunc{symbol, len(decl.Parameters), impl}, nil
+	paramNames := make([]string, len(decl.Parameters))
+	for i, p := range decl.Parameters {
+		paramNames[i] = p.Name.Value
+	}
+	arity := len(decl.Parameters)
+	variadic := arity > 0 && decl.Parameters[arity-1].Variadic
+	if variadic {
+		arity--
+	}
+	return ExternFunc{name: symbol.Name, paramNames: paramNames, arity: arity, variadic: variadic, Impl: impl}, nil
+}
+
+// MakeFailableExternFunc binds an extern func like MakeExternFunc to an implementation, that may fail.
+func MakeFailableExternFunc(symbol *ast.Symbol, impl FailableExternFuncImpl) (ExternFunc, error) {
+	ef, err := MakeExternFunc(symbol, nil)
+	if err != nil {
+		return ef, err
+	}
+	ef.failable = impl
+	return ef, nil
+}
+
+// Call invokes the implementation of the extern func.
+func (ef ExternFunc) Call(args []RuntimeValue) (RuntimeValue, error) {
+	if ef.failable != nil {
+		return ef.failable(args)
+	}
+	return ef.Impl(args), nil
+}
+
+// Name returns the name of the extern declaration, that plugins bind the implementation to.
+func (ef ExternFunc) Name() string {
+	return ef.name
 }
 
 // Arity implements CallableRuntimeValue.
@@ -29,21 +69,38 @@ func (ef ExternFunc) Arity() int {
 	return ef.arity
 }
 
+// IsVariadic implements CallableRuntimeValue.
+func (ef ExternFunc) IsVariadic() bool {
+	return ef.variadic
+}
+
+// Parameters implements CallableRuntimeValue.
+func (ef ExternFunc) Parameters() []Parameter {
+	params := make([]Parameter, len(ef.paramNames))
+	for i, name := range ef.paramNames {
+		params[i].Name = name
+		params[i].Variadic = ef.variadic && i == len(ef.paramNames)-1
+	}
+	return params
+}
+
 // Inspect implements CallableRuntimeValue.
 func (ef ExternFunc) Inspect() string {
-	return fmt.Sprintf("extern %s(#%d)", ef.symbol.Decl.DeclName(), ef.arity)
+	return fmt.Sprintf("extern %s(#%d)", ef.name, ef.arity)
 }
 
 // Lookup implements CallableRuntimeValue.
 func (ef ExternFunc) Lookup(name string) RuntimeValue {
-	if name == "arity" {
-		// return ef.arity
-		panic("unimplemented: how to create ints?")
+	switch name {
+	case "arity":
+		return Int(ef.arity)
+	case "isVariadic":
+		return Bool(ef.variadic)
 	}
 	return nil
 }
 
 // TypeConstantId implements CallableRuntimeValue.
 func (ef ExternFunc) TypeConstantId() TypeId {
-	return TypeId(*ef.symbol.TypeSymbol.ConstantId)
+	return typeIdFunc
 }
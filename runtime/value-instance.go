@@ -9,17 +9,37 @@ type DataValue struct {
 }
 
 func MakeDataValue(dt *DataType, values []RuntimeValue) *DataValue {
-	fields := make(map[string]int, len(dt.FieldSymbols))
-	for i, f := range dt.FieldSymbols {
-		fields[f.Name] = i
+	fields := make(map[string]int, len(dt.Fields))
+	for i, f := range dt.Fields {
+		fields[f] = i
 	}
 	return &DataValue{
-		TypeId: TypeId(*dt.Symbol.ConstantId),
+		TypeId: dt.Id,
 		Fields: fields,
 		Values: values,
 	}
 }
 
+// CopyWith returns a copy of the data value with the named fields replaced.
+// All other field values are shared with the original.
+func (dv *DataValue) CopyWith(names []string, values []RuntimeValue) (*DataValue, error) {
+	copied := make([]RuntimeValue, len(dv.Values))
+	copy(copied, dv.Values)
+
+	for i, name := range names {
+		idx, ok := dv.Fields[name]
+		if !ok {
+			return nil, fmt.Errorf("field %q not found in %s", name, dv.Inspect())
+		}
+		copied[idx] = values[i]
+	}
+	return &DataValue{
+		TypeId: dv.TypeId,
+		Fields: dv.Fields,
+		Values: copied,
+	}, nil
+}
+
 // Inspect implements RuntimeValue.
 func (dv *DataValue) Inspect() string {
 	return fmt.Sprintf("data #%d { %+v }", dv.TypeId, dv.Fields)
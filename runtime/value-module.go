@@ -0,0 +1,64 @@
+package runtime
+
+var _ RuntimeValue = &Module{}
+
+// Module is the value of a module, that is referenced by its `module` declaration or an import.
+// It exposes the public declarations of the module.
+type Module struct {
+	Name string
+	// Annotations of all `module` declarations of the module, like `@Deprecated`.
+	Annotations []Annotation
+
+	// Public functions, data types, enums, annotations and extern functions by name.
+	Members map[string]RuntimeValue
+	// The global ids of public variables by name.
+	// They are initialized lazily by the vm.
+	Globals map[string]int
+}
+
+func MakeModule(name string) *Module {
+	return &Module{
+		Name:    name,
+		Members: make(map[string]RuntimeValue),
+		Globals: make(map[string]int),
+	}
+}
+
+// Global returns the global id of a public variable.
+func (m *Module) Global(name string) (int, bool) {
+	id, ok := m.Globals[name]
+	return id, ok
+}
+
+// Annotation is an annotation instance like `@Deprecated("reason")`.
+type Annotation struct {
+	Name string
+	// The literal arguments, nil for other expressions.
+	Arguments []RuntimeValue
+}
+
+// Annotation returns the first annotation of the module with the given name.
+func (m *Module) Annotation(name string) (Annotation, bool) {
+	for _, anno := range m.Annotations {
+		if anno.Name == name {
+			return anno, true
+		}
+	}
+	return Annotation{}, false
+}
+
+// Inspect implements RuntimeValue.
+func (m *Module) Inspect() string {
+	return "module " + m.Name
+}
+
+// Lookup implements RuntimeValue.
+// Public variables are not included, as they are initialized by the vm.
+func (m *Module) Lookup(name string) RuntimeValue {
+	return m.Members[name]
+}
+
+// TypeConstantId implements RuntimeValue.
+func (m *Module) TypeConstantId() TypeId {
+	return typeIdModule
+}
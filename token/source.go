@@ -1,8 +1,14 @@
 package token
 
+import "fmt"
+
 type Source struct {
 	File   string
 	Offset int
+	// The line and the column of the offset, both starting at 1.
+	// Zero, if unknown.
+	Line   int
+	Column int
 }
 
 func MakeSource(
@@ -14,3 +20,11 @@ func MakeSource(
 		Offset: offset,
 	}
 }
+
+// String formats the source like `file:line:column` or like `file@offset`, if the line is unknown.
+func (s *Source) String() string {
+	if s.Line == 0 {
+		return fmt.Sprintf("%s@%d", s.File, s.Offset)
+	}
+	return fmt.Sprintf("%s:%d:%d", s.File, s.Line, s.Column)
+}
@@ -15,3 +15,14 @@ func TestMakeSource(t *testing.T) {
 		t.Errorf("expected %d, got %d", 42, src.Offset)
 	}
 }
+
+func TestSourceString(t *testing.T) {
+	src := token.MakeSource("foo", 42)
+	if src.String() != "foo@42" {
+		t.Errorf("expected %q, got %q", "foo@42", src.String())
+	}
+	src.Line, src.Column = 3, 7
+	if src.String() != "foo:3:7" {
+		t.Errorf("expected %q, got %q", "foo:3:7", src.String())
+	}
+}
@@ -43,20 +43,26 @@ const (
 	AND TokenType = "&&"
 	OR  TokenType = "||"
 
+	COALESCE TokenType = "??"
+	QUESTION TokenType = "?"
+
 	// Delimiters
-	ASSIGN      TokenType = "="
-	RIGHT_ARROW TokenType = "->"
-	LEFT_ARROW  TokenType = "<-"
-	COLON       TokenType = ":"
-	DOT         TokenType = "."
-	COMMA       TokenType = ","
-	LPAREN      TokenType = "("
-	RPAREN      TokenType = ")"
-	LBRACE      TokenType = "{"
-	RBRACE      TokenType = "}"
-	LBRACKET    TokenType = "["
-	RBRACKET    TokenType = "]"
-	AT          TokenType = "@"
+	ASSIGN            TokenType = "="
+	RIGHT_ARROW       TokenType = "->"
+	LEFT_ARROW        TokenType = "<-"
+	COLON             TokenType = ":"
+	DOT               TokenType = "."
+	ELLIPSIS          TokenType = "..."
+	QUESTION_DOT      TokenType = "?."
+	QUESTION_LBRACKET TokenType = "?["
+	COMMA             TokenType = ","
+	LPAREN            TokenType = "("
+	RPAREN            TokenType = ")"
+	LBRACE            TokenType = "{"
+	RBRACE            TokenType = "}"
+	LBRACKET          TokenType = "["
+	RBRACKET          TokenType = "]"
+	AT                TokenType = "@"
 
 	// KEYWORDS
 	MODULE     TokenType = "MODULE"
@@ -73,6 +79,9 @@ const (
 	BREAK      TokenType = "BREAK"
 	CONTINUE   TokenType = "CONTINUE"
 	RETURN     TokenType = "RETURN"
+	DEFER      TokenType = "DEFER"
+	PANIC      TokenType = "PANIC"
+	RECOVER    TokenType = "RECOVER"
 	IF         TokenType = "IF"
 	ELSE       TokenType = "ELSE"
 	FOR        TokenType = "FOR"
@@ -97,6 +106,9 @@ var keywords = map[string]TokenType{
 	"break":      BREAK,
 	"continue":   CONTINUE,
 	"return":     RETURN,
+	"defer":      DEFER,
+	"panic":      PANIC,
+	"recover":    RECOVER,
 	"if":         IF,
 	"else":       ELSE,
 	"for":        FOR,
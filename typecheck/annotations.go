@@ -0,0 +1,133 @@
+package typecheck
+
+import (
+	"github.com/vknabel/zirric/ast"
+)
+
+// builtinTypes are known by name, even if the prelude is not declared.
+var builtinTypes = map[string]bool{
+	"Any":    true,
+	"Array":  true,
+	"Bool":   true,
+	"Char":   true,
+	"Dict":   true,
+	"Float":  true,
+	"Func":   true,
+	"Int":    true,
+	"Module": true,
+	"Null":   true,
+	"String": true,
+}
+
+// IsBuiltinType reports whether name is a type known even without the prelude like `Int` or `Any`.
+func IsBuiltinType(name string) bool {
+	return builtinTypes[name]
+}
+
+// requirement collects the declared type of `@Type(T)`, `@T` and `@Has(A)` annotations.
+func (c *checker) requirement(annos ast.AnnotationChain) Requirement {
+	var req Requirement
+	for _, inst := range annos {
+		switch c.builtinAnnotation(inst) {
+		case "Type":
+			if len(inst.Arguments) == 1 {
+				req.Type = c.typeExpr(inst.Arguments[0])
+			}
+		case "Has":
+			if len(inst.Arguments) == 1 {
+				if has := c.typeExpr(inst.Arguments[0]); has != nil {
+					req.Has = append(req.Has, has)
+				}
+			}
+		case "":
+			t := c.resolveTypeRef(inst.Reference)
+			if t == nil {
+				continue
+			}
+			if t.Symbol != nil {
+				if _, ok := t.Symbol.Decl.(*ast.DeclAnnotation); ok {
+					// regular annotations do not declare types
+					continue
+				}
+			}
+			req.Type = t
+		}
+	}
+	return req
+}
+
+// returnRequirement collects the declared type of a `@Returns(T)` annotation.
+func (c *checker) returnRequirement(annos ast.AnnotationChain) Requirement {
+	for _, inst := range annos {
+		if c.builtinAnnotation(inst) == "Returns" && len(inst.Arguments) == 1 {
+			return Requirement{Type: c.typeExpr(inst.Arguments[0])}
+		}
+	}
+	return Requirement{}
+}
+
+// BuiltinAnnotation returns the name of `Type`, `Has` or `Returns` or an empty string for other annotations.
+// The names stay builtin, unless resolve finds a declaration other than an annotation.
+func BuiltinAnnotation(inst *ast.DeclAnnotationInstance, resolve func(name string) (*ast.Symbol, bool)) string {
+	if len(inst.Reference) != 1 {
+		return ""
+	}
+	name := inst.Reference.Name().Value
+	switch name {
+	case "Type", "Has", "Returns":
+	default:
+		return ""
+	}
+	sym, ok := resolve(name)
+	if !ok || sym.Decl == nil {
+		return name
+	}
+	if _, ok := sym.Decl.(*ast.DeclAnnotation); ok {
+		return name
+	}
+	return ""
+}
+
+func (c *checker) builtinAnnotation(inst *ast.DeclAnnotationInstance) string {
+	return BuiltinAnnotation(inst, c.scope.symbols.Resolve)
+}
+
+// typeExpr resolves the type argument of an annotation like `Int` or `"Int"`.
+func (c *checker) typeExpr(expr ast.Expr) *Type {
+	switch expr := expr.(type) {
+	case *ast.ExprIdentifier:
+		return c.resolveTypeName(expr.Name.Value)
+	case *ast.ExprString:
+		return c.resolveTypeName(expr.Literal)
+	default:
+		// types of other modules are not known yet
+		return nil
+	}
+}
+
+// resolveTypeRef resolves a type declared in this module.
+func (c *checker) resolveTypeRef(ref ast.StaticReference) *Type {
+	if len(ref) != 1 {
+		return nil
+	}
+	return c.resolveTypeName(ref.Name().Value)
+}
+
+// resolveTypeName resolves a declared type or a builtin type.
+// Returns nil for unknown names and declarations, that are not types.
+func (c *checker) resolveTypeName(name string) *Type {
+	sym, ok := c.scope.symbols.Resolve(name)
+	if !ok || sym.Decl == nil {
+		if builtinTypes[name] {
+			return &Type{Name: name}
+		}
+		return nil
+	}
+
+	switch sym.Decl.(type) {
+	case *ast.DeclData, *ast.DeclEnum, *ast.DeclExternType, *ast.DeclAnnotation:
+		return &Type{Name: name, Symbol: sym}
+	default:
+		return nil
+	}
+}
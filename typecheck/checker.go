@@ -0,0 +1,278 @@
+// Package typecheck implements an optional, gradual type checker.
+//
+// Types are declared by annotations like `@Int length`, `@Type(Person) owner`,
+// `@Has(Countable) value` and `@Returns(Int)`.
+// Unannotated declarations stay dynamically typed and are never reported.
+package typecheck
+
+import (
+	"sort"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/token"
+)
+
+type checker struct {
+	diags []Diagnostic
+	scope *scope
+
+	// the scopes of global variables, as they may be inferred on first use
+	globals   map[*ast.DeclVariable]*ast.SymbolTable
+	variables map[*ast.DeclVariable]*Type
+	funcs     map[*ast.ExprFunc]*Type
+	inferring map[ast.Node]bool
+}
+
+// scope is the function or file currently checked.
+type scope struct {
+	symbols *ast.SymbolTable
+	// nil outside of functions
+	returns *Requirement
+	// the types of all returns, nil for dynamic ones
+	results []*Type
+}
+
+// Check reports type mismatches within a module or a single source file.
+func Check(node ast.Node) []Diagnostic {
+	c := &checker{
+		globals:   make(map[*ast.DeclVariable]*ast.SymbolTable),
+		variables: make(map[*ast.DeclVariable]*Type),
+		funcs:     make(map[*ast.ExprFunc]*Type),
+		inferring: make(map[ast.Node]bool),
+	}
+
+	switch node := node.(type) {
+	case *ast.ContextModule:
+		tables := []*ast.SymbolTable{node.Symbols}
+		for _, src := range node.Files {
+			tables = append(tables, src.Symbols)
+		}
+		c.checkTables(tables)
+		for _, src := range node.Files {
+			c.checkStatements(src)
+		}
+
+	case *ast.SourceFile:
+		tables := []*ast.SymbolTable{node.Symbols}
+		if node.Symbols.Parent != nil {
+			tables = append(tables, node.Symbols.Parent)
+		}
+		c.checkTables(tables)
+		c.checkStatements(node)
+	}
+
+	sortDiagnostics(c.diags)
+	return c.diags
+}
+
+// checkTables checks all declarations of the given tables.
+func (c *checker) checkTables(tables []*ast.SymbolTable) {
+	for _, table := range tables {
+		for _, sym := range table.Symbols {
+			if decl, ok := sym.Decl.(*ast.DeclVariable); ok {
+				c.globals[decl] = table
+			}
+		}
+	}
+	for _, table := range tables {
+		c.scope = &scope{symbols: table}
+		for _, sym := range sortedSymbols(table) {
+			c.checkDecl(sym.Decl)
+		}
+	}
+}
+
+func (c *checker) checkStatements(src *ast.SourceFile) {
+	c.scope = &scope{symbols: src.Symbols}
+	c.checkBlock(src.Statements)
+}
+
+// sortedSymbols returns the symbols in declaration order.
+func sortedSymbols(table *ast.SymbolTable) []*ast.Symbol {
+	syms := make([]*ast.Symbol, 0, len(table.Symbols))
+	for _, sym := range table.Symbols {
+		if sym.Decl != nil {
+			syms = append(syms, sym)
+		}
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		return syms[i].Index < syms[j].Index
+	})
+	return syms
+}
+
+func (c *checker) checkDecl(decl ast.Decl) {
+	switch decl := decl.(type) {
+	case *ast.DeclFunc:
+		c.checkFunc(decl.Impl, c.returnRequirement(decl.Annotations))
+	case *ast.DeclVariable:
+		c.variableType(decl)
+	case *ast.DeclData:
+		for _, field := range decl.Fields {
+			c.checkDefault(field.Name.Token, "field "+field.Name.Value, field.Annotations)
+		}
+	case *ast.DeclExternFunc:
+		c.checkParameterDefaults(decl.Parameters)
+	}
+}
+
+func (c *checker) checkBlock(block ast.Block) {
+	for _, stmt := range block {
+		c.checkStmt(stmt)
+	}
+}
+
+func (c *checker) checkStmt(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.StmtExpr:
+		c.typeOf(stmt.Expr)
+	case *ast.DeclVariable:
+		c.variableType(stmt)
+	case *ast.DeclFunc:
+		c.checkFunc(stmt.Impl, c.returnRequirement(stmt.Annotations))
+	case ast.StmtIf:
+		c.checkCondition(stmt.Condition)
+		c.checkBlock(stmt.IfBlock)
+		for _, elseIf := range stmt.ElseIf {
+			c.checkCondition(elseIf.Condition)
+			c.checkBlock(elseIf.Block)
+		}
+		c.checkBlock(stmt.ElseBlock)
+	case *ast.StmtSwitch:
+		c.typeOf(stmt.Value)
+		for _, sc := range stmt.Cases {
+			if sc.Value != nil {
+				c.typeOf(sc.Value)
+			}
+			c.checkBlock(sc.Block)
+		}
+	case *ast.StmtDefer:
+		c.checkBlock(stmt.Block)
+	case *ast.StmtReturn:
+		c.checkReturn(stmt)
+	}
+}
+
+func (c *checker) checkReturn(stmt *ast.StmtReturn) {
+	result := c.resolveTypeName("Null")
+	if stmt.Expr != nil {
+		result = c.typeOf(stmt.Expr)
+	}
+	c.scope.results = append(c.scope.results, result)
+
+	if c.scope.returns == nil {
+		return
+	}
+	c.expect(stmt.Token, "return value", result, *c.scope.returns)
+}
+
+func (c *checker) checkCondition(cond ast.Expr) {
+	t := c.typeOf(cond)
+	if !c.assignable(t, c.resolveTypeName("Bool")) {
+		c.report(cond.TokenLiteral(), "condition must be Bool", "got %s", t)
+	}
+}
+
+// checkFunc checks the body of a function and returns its result type.
+// Without `@Returns`, the result type is inferred from the returned values.
+func (c *checker) checkFunc(fn *ast.ExprFunc, returns Requirement) *Type {
+	if t, ok := c.funcs[fn]; ok {
+		return t
+	}
+	if c.inferring[fn] {
+		// recursive calls
+		return returns.Type
+	}
+	c.inferring[fn] = true
+	defer delete(c.inferring, fn)
+
+	outer := c.scope
+	c.scope = &scope{symbols: fn.Symbols, returns: &returns}
+	defer func() { c.scope = outer }()
+
+	c.checkParameterDefaults(fn.Parameters)
+	c.checkBlock(fn.Impl)
+
+	result := returns.Type
+	if result == nil && endsWithReturn(fn.Impl) {
+		result = commonType(c.scope.results)
+	}
+	c.funcs[fn] = result
+	return result
+}
+
+func (c *checker) checkParameterDefaults(params []ast.DeclParameter) {
+	for _, param := range params {
+		c.checkDefault(param.Name.Token, "parameter "+param.Name.Value, param.Annotations)
+	}
+}
+
+// checkDefault checks a `@Default(value)` against the declared type.
+func (c *checker) checkDefault(tok token.Token, subject string, annos ast.AnnotationChain) {
+	for _, inst := range annos {
+		if inst.Reference.Name().Value != "Default" || len(inst.Arguments) != 1 {
+			continue
+		}
+		c.expect(tok, "default of "+subject, c.typeOf(inst.Arguments[0]), c.requirement(annos))
+	}
+}
+
+// variableType checks a variable once and returns its declared or inferred type.
+func (c *checker) variableType(decl *ast.DeclVariable) *Type {
+	if t, ok := c.variables[decl]; ok {
+		return t
+	}
+	if c.inferring[decl] {
+		// recursive initialization
+		return nil
+	}
+	c.inferring[decl] = true
+	defer delete(c.inferring, decl)
+
+	if table, ok := c.globals[decl]; ok {
+		outer := c.scope
+		c.scope = &scope{symbols: table}
+		defer func() { c.scope = outer }()
+	}
+
+	req := c.requirement(decl.Annotations)
+	t := c.typeOf(decl.Value)
+	c.expect(decl.Name.Token, "variable "+decl.Name.Value, t, req)
+	if req.Type != nil {
+		t = req.Type
+	}
+	c.variables[decl] = t
+	return t
+}
+
+// expect reports if a value does not satisfy a requirement.
+func (c *checker) expect(tok token.Token, subject string, value *Type, req Requirement) {
+	if req.isDynamic() {
+		return
+	}
+	if violated, ok := c.satisfies(value, req); !ok {
+		c.report(tok, "type mismatch for "+subject, "want %s, got %s", violated, value)
+	}
+}
+
+// endsWithReturn reports whether the last statement of a block is a return.
+func endsWithReturn(block ast.Block) bool {
+	if len(block) == 0 {
+		return false
+	}
+	_, ok := block[len(block)-1].(*ast.StmtReturn)
+	return ok
+}
+
+// commonType returns the type shared by all types or nil.
+func commonType(types []*Type) *Type {
+	if len(types) == 0 {
+		return nil
+	}
+	for _, t := range types[1:] {
+		if !t.same(types[0]) {
+			return nil
+		}
+	}
+	return types[0]
+}
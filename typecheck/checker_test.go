@@ -0,0 +1,235 @@
+package typecheck_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/lexer"
+	"github.com/vknabel/zirric/parser"
+	"github.com/vknabel/zirric/registry/staticmodule"
+	"github.com/vknabel/zirric/typecheck"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		label string
+		input string
+		want  []string
+	}{
+		{
+			label: "unannotated code is dynamic",
+			input: `
+			data Person { name }
+			func greet(person) {
+				return person.name + 1
+			}
+			greet(Person(42))
+			`,
+		},
+		{
+			label: "literal arguments",
+			input: `
+			func twice(@Int n) {
+				return n + n
+			}
+			twice(1)
+			twice("a")
+			`,
+			want: []string{`type mismatch for argument n of twice, want @Int, got String`},
+		},
+		{
+			label: "named arguments",
+			input: `
+			func twice(@Type(Int) n) {
+				return n + n
+			}
+			twice(n: 1.5)
+			`,
+			want: []string{`type mismatch for argument n of twice, want @Int, got Float`},
+		},
+		{
+			label: "constructor types through let",
+			input: `
+			data Person {
+				@String name
+			}
+			data Company {
+				@Person owner
+			}
+			let max = Person("Max")
+			Company(max)
+			Company(Company(max))
+			Person(42)
+			`,
+			want: []string{
+				`type mismatch for argument owner of Company, want @Person, got Company`,
+				`type mismatch for argument name of Person, want @String, got Int`,
+			},
+		},
+		{
+			label: "field access",
+			input: `
+			data Person {
+				@String name
+				age
+			}
+			func shout(@String text) {
+				return text
+			}
+			let max = Person("Max", 42)
+			shout(max.name)
+			shout(max.age)
+			max.email
+			`,
+			want: []string{`unknown field, data Person has no field "email"`},
+		},
+		{
+			label: "annotated variables",
+			input: `
+			@Int
+			let count = "many"
+			`,
+			want: []string{`type mismatch for variable count, want @Int, got String`},
+		},
+		{
+			label: "return types",
+			input: `
+			@Returns(Int)
+			func count(values) {
+				if values == [] {
+					return "none"
+				}
+				return 1
+			}
+			`,
+			want: []string{`type mismatch for return value, want @Int, got String`},
+		},
+		{
+			label: "inferred return types",
+			input: `
+			func name() {
+				return "Max"
+			}
+			func twice(@Int n) {
+				return n + n
+			}
+			twice(name())
+			twice(twice(1))
+			`,
+			want: []string{`type mismatch for argument n of twice, want @Int, got String`},
+		},
+		{
+			label: "enum cases",
+			input: `
+			enum Shape {
+				data Circle { radius }
+				data Square { length }
+			}
+			data Line { length }
+			func area(@Shape shape) {
+				return shape
+			}
+			area(Circle(1))
+			area(Square(2))
+			area(Line(3))
+			`,
+			want: []string{`type mismatch for argument shape of area, want @Shape, got Line`},
+		},
+		{
+			label: "has annotation",
+			input: `
+			annotation Countable {}
+
+			@Countable
+			data Bag { items }
+			data Box { item }
+
+			func count(@Has(Countable) value) {
+				return value
+			}
+			count(Bag([]))
+			count(Box(1))
+			`,
+			want: []string{`type mismatch for argument value of count, want @Has(Countable), got Box`},
+		},
+		{
+			label: "operators",
+			input: `
+			let a = 1 + 2.5
+			let b = "a" * 2
+			let c = !1
+			let d = if 1 { 2 } else { 3 }
+			`,
+			want: []string{
+				`invalid operand for *, want Int or Float, got String`,
+				`invalid operand for !, want Bool, got Int`,
+				`condition must be Bool, got Int`,
+			},
+		},
+		{
+			label: "copy with update",
+			input: `
+			data Person {
+				@String name
+			}
+			Person("Max") with { name: 42 }
+			`,
+			want: []string{`type mismatch for field name of Person, want @String, got Int`},
+		},
+		{
+			label: "defaults",
+			input: `
+			func greet(@String @Default(42) name) {
+				return name
+			}
+			`,
+			want: []string{`type mismatch for default of parameter name, want @String, got Int`},
+		},
+		{
+			label: "recursive functions",
+			input: `
+			@Returns(Int)
+			func fib(@Int n) {
+				return if n < 2 { n } else { fib(n - 1) + fib(n - 2) }
+			}
+			fib("10")
+			`,
+			want: []string{`type mismatch for argument n of fib, want @Int, got String`},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.label), func(t *testing.T) {
+			src := prepareSourceFileParsing(t, tt.input)
+
+			diags := typecheck.Check(src)
+			got := make([]string, len(diags))
+			for i, d := range diags {
+				got[i] = d.Summary + ", " + d.Details
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("unexpected diagnostics\nwant:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func prepareSourceFileParsing(t *testing.T, input string) *ast.SourceFile {
+	t.Helper()
+
+	l, err := lexer.New(staticmodule.NewSourceString("testing:///test/test.zirr", input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parser.NewSourceParser(l, nil, "test.zirr")
+	srcFile := p.ParseSourceFile()
+	for _, err := range p.Errors() {
+		t.Error(err)
+	}
+	if t.Failed() {
+		t.FailNow()
+	}
+	return srcFile
+}
@@ -0,0 +1,47 @@
+package typecheck
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vknabel/zirric/token"
+)
+
+// Diagnostic reports a mismatch between a value and its declared type.
+type Diagnostic struct {
+	Token   token.Token
+	Summary string
+	Details string
+}
+
+// Error implements error.
+// It starts with the source position like `file:line:column`, if known.
+func (d Diagnostic) Error() string {
+	msg := fmt.Sprintf("type error: %s, %s", d.Summary, d.Details)
+	if d.Token.Source == nil {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", d.Token.Source, msg)
+}
+
+func (c *checker) report(tok token.Token, summary string, format string, a ...any) {
+	c.diags = append(c.diags, Diagnostic{
+		Token:   tok,
+		Summary: summary,
+		Details: fmt.Sprintf(format, a...),
+	})
+}
+
+// sortDiagnostics orders diagnostics by their source location.
+func sortDiagnostics(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		lhs, rhs := diags[i].Token.Source, diags[j].Token.Source
+		if lhs == nil || rhs == nil {
+			return rhs != nil
+		}
+		if lhs.File != rhs.File {
+			return lhs.File < rhs.File
+		}
+		return lhs.Offset < rhs.Offset
+	})
+}
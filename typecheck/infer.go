@@ -0,0 +1,309 @@
+package typecheck
+
+import (
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/token"
+)
+
+// typeOf checks an expression and infers its type.
+// Returns nil if the type is only known at runtime.
+func (c *checker) typeOf(expr ast.Expr) *Type {
+	switch expr := expr.(type) {
+	case *ast.ExprInt:
+		return c.resolveTypeName("Int")
+	case *ast.ExprFloat:
+		return c.resolveTypeName("Float")
+	case *ast.ExprString:
+		return c.resolveTypeName("String")
+	case *ast.ExprChar:
+		return c.resolveTypeName("Char")
+	case *ast.ExprBool:
+		return c.resolveTypeName("Bool")
+	case *ast.ExprNull:
+		return c.resolveTypeName("Null")
+
+	case *ast.ExprArray:
+		for _, el := range expr.Elements {
+			c.typeOf(el)
+		}
+		return c.resolveTypeName("Array")
+	case *ast.ExprDict:
+		for _, entry := range expr.Entries {
+			c.typeOf(entry.Key)
+			c.typeOf(entry.Value)
+		}
+		return c.resolveTypeName("Dict")
+	case *ast.ExprFunc:
+		c.checkFunc(expr, Requirement{})
+		return c.resolveTypeName("Func")
+
+	case *ast.ExprIdentifier:
+		return c.identifierType(expr.Name.Value)
+	case *ast.ExprMemberAccess:
+		target := c.typeOf(expr.Target)
+		field := c.fieldType(expr.Property, target)
+		if expr.Optional {
+			// may short-circuit to null
+			return nil
+		}
+		return field
+	case *ast.ExprIndexAccess:
+		c.typeOf(expr.Target)
+		c.typeOf(expr.IndexExpr)
+		return nil
+	case *ast.ExprInvocation:
+		return c.invocationType(expr)
+	case *ast.ExprWith:
+		return c.withType(expr)
+
+	case *ast.ExprOperatorUnary:
+		return c.unaryType(expr)
+	case *ast.ExprOperatorBinary:
+		return c.binaryType(expr)
+	case ast.ExprIf:
+		c.checkCondition(expr.Condition)
+		branches := []*Type{c.typeOf(expr.ThenExpr)}
+		for _, elseIf := range expr.ElseIf {
+			c.checkCondition(elseIf.Condition)
+			branches = append(branches, c.typeOf(elseIf.Then))
+		}
+		branches = append(branches, c.typeOf(expr.ElseExpr))
+		return commonType(branches)
+	case *ast.ExprSwitch:
+		c.typeOf(expr.Value)
+		var branches []*Type
+		for _, sc := range expr.Cases {
+			if sc.Value != nil {
+				c.typeOf(sc.Value)
+			}
+			branches = append(branches, c.typeOf(sc.Expr))
+		}
+		return commonType(branches)
+
+	case *ast.ExprPropagate:
+		c.typeOf(expr.Value)
+		return nil
+	case *ast.ExprPanic:
+		c.typeOf(expr.Value)
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (c *checker) identifierType(name string) *Type {
+	sym, ok := c.scope.symbols.Resolve(name)
+	if !ok {
+		return nil
+	}
+	switch decl := sym.Decl.(type) {
+	case *ast.DeclVariable:
+		return c.variableType(decl)
+	case *ast.DeclParameter:
+		if decl.Variadic {
+			return c.resolveTypeName("Array")
+		}
+		return c.requirement(decl.Annotations).Type
+	case *ast.DeclFunc, *ast.DeclExternFunc:
+		return c.resolveTypeName("Func")
+	default:
+		return nil
+	}
+}
+
+// param is a parameter or data field, that receives an argument.
+type param struct {
+	name     string
+	req      Requirement
+	variadic bool
+}
+
+func (c *checker) parameters(decls []ast.DeclParameter) []param {
+	params := make([]param, len(decls))
+	for i, p := range decls {
+		params[i] = param{name: p.Name.Value, req: c.requirement(p.Annotations), variadic: p.Variadic}
+	}
+	return params
+}
+
+func (c *checker) fields(decls []ast.DeclField) []param {
+	params := make([]param, len(decls))
+	for i, f := range decls {
+		params[i] = param{name: f.Name.Value, req: c.requirement(f.Annotations)}
+	}
+	return params
+}
+
+// invocationType checks the arguments of statically known callees.
+// Calling a data type creates a value of it, functions return their result type.
+func (c *checker) invocationType(expr *ast.ExprInvocation) *Type {
+	ident, ok := expr.Function.(*ast.ExprIdentifier)
+	if !ok {
+		c.typeOf(expr.Function)
+		c.checkArguments("", nil, expr)
+		return nil
+	}
+	callee := ident.Name.Value
+	sym, ok := c.scope.symbols.Resolve(callee)
+	if !ok {
+		c.checkArguments(callee, nil, expr)
+		return nil
+	}
+
+	switch decl := sym.Decl.(type) {
+	case *ast.DeclData:
+		c.checkArguments(callee, c.fields(decl.Fields), expr)
+		return &Type{Name: callee, Symbol: sym}
+	case *ast.DeclFunc:
+		c.checkArguments(callee, c.parameters(decl.Impl.Parameters), expr)
+		return c.checkFunc(decl.Impl, c.returnRequirement(decl.Annotations))
+	case *ast.DeclExternFunc:
+		c.checkArguments(callee, c.parameters(decl.Parameters), expr)
+		return c.returnRequirement(decl.Annotations).Type
+	default:
+		c.checkArguments(callee, nil, expr)
+		return nil
+	}
+}
+
+// checkArguments checks all arguments and reports those, that do not match their parameter.
+// Arguments of variadic parameters and spread arguments are not checked.
+func (c *checker) checkArguments(callee string, params []param, expr *ast.ExprInvocation) {
+	for i, arg := range expr.Arguments {
+		t := c.typeOf(arg)
+		if i >= len(params) || params[i].variadic || (expr.Spread && i == len(expr.Arguments)-1) {
+			continue
+		}
+		c.expect(arg.TokenLiteral(), "argument "+params[i].name+" of "+callee, t, params[i].req)
+	}
+	for _, arg := range expr.NamedArguments {
+		t := c.typeOf(arg.Value)
+		for _, p := range params {
+			if p.name == arg.Name.Value && !p.variadic {
+				c.expect(arg.Name.Token, "argument "+p.name+" of "+callee, t, p.req)
+			}
+		}
+	}
+}
+
+// fieldType returns the declared type of a field.
+// Reports fields, that are missing on data types.
+func (c *checker) fieldType(name ast.Identifier, owner *Type) *Type {
+	if owner == nil || owner.Symbol == nil {
+		return nil
+	}
+	switch decl := owner.Symbol.Decl.(type) {
+	case *ast.DeclData:
+		for _, field := range decl.Fields {
+			if field.Name.Value != name.Value {
+				continue
+			}
+			if len(field.Parameters) > 0 {
+				return c.resolveTypeName("Func")
+			}
+			return c.requirement(field.Annotations).Type
+		}
+		c.report(name.Token, "unknown field", "data %s has no field %q", owner.Name, name.Value)
+		return nil
+	case *ast.DeclExternType:
+		field, ok := decl.Fields[name.Value]
+		if !ok || len(field.Parameters) > 0 {
+			return nil
+		}
+		return c.requirement(field.Annotations).Type
+	default:
+		return nil
+	}
+}
+
+// withType checks the updated fields of a copy-with-update.
+func (c *checker) withType(expr *ast.ExprWith) *Type {
+	target := c.typeOf(expr.Target)
+	var fields []param
+	if target != nil && target.Symbol != nil {
+		if decl, ok := target.Symbol.Decl.(*ast.DeclData); ok {
+			fields = c.fields(decl.Fields)
+		}
+	}
+	for _, update := range expr.Fields {
+		t := c.typeOf(update.Value)
+		for _, f := range fields {
+			if f.name == update.Name.Value {
+				c.expect(update.Name.Token, "field "+f.name+" of "+target.Name, t, f.req)
+			}
+		}
+	}
+	return target
+}
+
+func (c *checker) unaryType(expr *ast.ExprOperatorUnary) *Type {
+	t := c.typeOf(expr.Expr)
+	tok := expr.Operator.TokenLiteral()
+	switch tok.Type {
+	case token.BANG:
+		c.expectOperand(tok, "Bool", t, "Bool")
+		return c.resolveTypeName("Bool")
+	case token.MINUS, token.PLUS:
+		c.expectOperand(tok, "Int or Float", t, "Int", "Float")
+		return t
+	default:
+		return nil
+	}
+}
+
+func (c *checker) binaryType(expr *ast.ExprOperatorBinary) *Type {
+	lhs := c.typeOf(expr.Left)
+	rhs := c.typeOf(expr.Right)
+	tok := expr.Operator.TokenLiteral()
+
+	switch tok.Type {
+	case token.AND, token.OR:
+		c.expectOperand(tok, "Bool", lhs, "Bool")
+		c.expectOperand(tok, "Bool", rhs, "Bool")
+		return c.resolveTypeName("Bool")
+	case token.EQ, token.NEQ:
+		return c.resolveTypeName("Bool")
+	case token.LT, token.LTE, token.GT, token.GTE:
+		c.expectOperand(tok, "Int or Float", lhs, "Int", "Float")
+		c.expectOperand(tok, "Int or Float", rhs, "Int", "Float")
+		return c.resolveTypeName("Bool")
+	case token.PLUS, token.MINUS, token.ASTERISK, token.SLASH:
+		lhsOk := c.expectOperand(tok, "Int or Float", lhs, "Int", "Float")
+		rhsOk := c.expectOperand(tok, "Int or Float", rhs, "Int", "Float")
+		if lhs == nil || rhs == nil || !lhsOk || !rhsOk {
+			return nil
+		}
+		if lhs.Name == "Float" || rhs.Name == "Float" {
+			return c.resolveTypeName("Float")
+		}
+		return lhs
+	case token.PERCENT:
+		c.expectOperand(tok, "Int", lhs, "Int")
+		c.expectOperand(tok, "Int", rhs, "Int")
+		return c.resolveTypeName("Int")
+	case token.COALESCE:
+		if lhs == nil {
+			return nil
+		}
+		if lhs.Name == "Null" {
+			return rhs
+		}
+		return lhs
+	default:
+		return nil
+	}
+}
+
+// expectOperand reports operands, that are not of one of the given builtin types.
+func (c *checker) expectOperand(tok token.Token, want string, t *Type, names ...string) bool {
+	if t == nil {
+		return true
+	}
+	for _, name := range names {
+		if t.same(c.resolveTypeName(name)) {
+			return true
+		}
+	}
+	c.report(tok, "invalid operand for "+tok.Literal, "want %s, got %s", want, t)
+	return false
+}
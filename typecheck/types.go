@@ -0,0 +1,155 @@
+package typecheck
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/vknabel/zirric/ast"
+	"github.com/vknabel/zirric/resolve"
+)
+
+// Type is a statically known type of a data, enum, extern or annotation declaration.
+// A nil *Type is dynamic and matches all types.
+type Type struct {
+	Name string
+	// The declaring symbol, nil if the type is not declared.
+	Symbol *ast.Symbol
+}
+
+func (t *Type) String() string {
+	if t == nil {
+		return "Any"
+	}
+	return t.Name
+}
+
+// same reports whether both types are statically known to be equal.
+func (t *Type) same(other *Type) bool {
+	if t == nil || other == nil || t.Name != other.Name {
+		return false
+	}
+	return t.Symbol == nil || other.Symbol == nil || t.Symbol == other.Symbol
+}
+
+// enum returns the declaration of an enum type.
+func (t *Type) enum() (*ast.DeclEnum, bool) {
+	if t == nil || t.Symbol == nil {
+		return nil, false
+	}
+	enum, ok := t.Symbol.Decl.(*ast.DeclEnum)
+	return enum, ok
+}
+
+// annotations returns the annotations of the type declaration.
+func (t *Type) annotations() ast.AnnotationChain {
+	if t == nil || t.Symbol == nil {
+		return nil
+	}
+	switch decl := t.Symbol.Decl.(type) {
+	case *ast.DeclData:
+		return decl.Annotations
+	case *ast.DeclEnum:
+		return decl.Annotations
+	case *ast.DeclExternType:
+		return decl.Annotations
+	case *ast.DeclAnnotation:
+		return decl.Annotations
+	default:
+		return nil
+	}
+}
+
+// Requirement is the declared type of a parameter, field, variable or return value.
+type Requirement struct {
+	// The type from `@Type(T)` or the shorthand `@T`, nil if dynamic.
+	Type *Type
+	// The annotations required by `@Has(A)`.
+	Has []*Type
+}
+
+func (r Requirement) isDynamic() bool {
+	return r.Type == nil && len(r.Has) == 0
+}
+
+func (r Requirement) String() string {
+	parts := make([]string, 0, 1+len(r.Has))
+	if r.Type != nil {
+		parts = append(parts, "@"+r.Type.Name)
+	}
+	for _, has := range r.Has {
+		parts = append(parts, "@Has("+has.Name+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// assignable reports whether values of type value may be used where want is required.
+// Values of an enum case can be used where the enum is required, also through nested enums.
+func (c *checker) assignable(value, want *Type) bool {
+	if value == nil || want == nil || value.same(want) || want.Name == "Any" {
+		return true
+	}
+	enum, ok := want.enum()
+	if !ok {
+		return false
+	}
+	wanted, ok := c.enumCases(enum)
+	if !ok || slices.ContainsFunc(wanted, func(t *Type) bool { return t.Symbol == nil && t.Name == "Any" }) {
+		// cases of other modules are not known, everything can be used as Any
+		return true
+	}
+	given := []*Type{value}
+	if enum, ok := value.enum(); ok {
+		if cases, ok := c.enumCases(enum); ok {
+			given = cases
+		}
+	}
+	for _, t := range given {
+		if !slices.ContainsFunc(wanted, t.same) {
+			return false
+		}
+	}
+	return true
+}
+
+// enumCases returns the data and extern types matched by an enum.
+// Reports false if they are not known.
+func (c *checker) enumCases(enum *ast.DeclEnum) ([]*Type, bool) {
+	syms, ok := resolve.TypeScope{Table: c.scope.symbols}.Cases(enum)
+	if !ok {
+		return nil, false
+	}
+	cases := make([]*Type, len(syms))
+	for i, sym := range syms {
+		cases[i] = &Type{Name: sym.Name}
+		if sym.Decl != nil {
+			cases[i].Symbol = sym
+		}
+	}
+	return cases, true
+}
+
+// hasAnnotation reports whether the declaration of a type is annotated with the given annotation.
+func (c *checker) hasAnnotation(value, anno *Type) bool {
+	if value == nil || value.Symbol == nil {
+		return true
+	}
+	for _, inst := range value.annotations() {
+		if c.resolveTypeRef(inst.Reference).same(anno) {
+			return true
+		}
+	}
+	return false
+}
+
+// satisfies reports the first violated part of a requirement.
+func (c *checker) satisfies(value *Type, req Requirement) (string, bool) {
+	if !c.assignable(value, req.Type) {
+		return "@" + req.Type.Name, false
+	}
+	for _, has := range req.Has {
+		if !c.hasAnnotation(value, has) {
+			return "@Has(" + has.Name + ")", false
+		}
+	}
+	return "", true
+}
@@ -0,0 +1,116 @@
+package vm
+
+import (
+	"github.com/vknabel/zirric/op"
+	"github.com/vknabel/zirric/runtime"
+)
+
+// instruction is an instruction with its operands decoded.
+// Jumps and deferred blocks address instructions by their index.
+type instruction struct {
+	opcode op.Opcode
+	a, b   int
+}
+
+// code holds the instructions of a function or of top level code.
+// They are decoded once when the vm is created, so dispatching them doesn't read operands again.
+type code struct {
+	raw op.Instructions
+	ins []instruction
+	// the byte offset of each instruction and of the end
+	offsets []int
+	// the index of each instruction by its byte offset, -1 within instructions
+	indices []int
+}
+
+// decode decodes raw instructions and resolves their jump targets.
+// Malformed instructions are replaced by an invalid opcode, that fails once it is dispatched.
+func decode(raw op.Instructions) *code {
+	c := &code{
+		raw:     raw,
+		indices: make([]int, len(raw)+1),
+	}
+	for i := range c.indices {
+		c.indices[i] = -1
+	}
+	for offset := 0; offset < len(raw); {
+		in, err := op.Decode(raw[offset:])
+		if err != nil {
+			c.indices[offset] = len(c.offsets)
+			c.offsets = append(c.offsets, offset)
+			break
+		}
+		c.indices[offset] = len(c.offsets)
+		c.offsets = append(c.offsets, offset)
+		offset += in.Len
+	}
+	c.indices[len(raw)] = len(c.offsets)
+	c.offsets = append(c.offsets, len(raw))
+
+	c.ins = make([]instruction, len(c.offsets)-1)
+	for i := range c.ins {
+		c.ins[i] = c.decodeAt(i)
+	}
+	return c
+}
+
+// decodeAt decodes the instruction at an index from the raw instructions.
+func (c *code) decodeAt(i int) instruction {
+	offset := c.offsets[i]
+	opcode := op.Opcode(c.raw[offset])
+	width := 2
+	if opcode == op.Wide && offset+1 < len(c.raw) {
+		// the operands of the prefixed instruction are twice as wide
+		opcode = op.Opcode(c.raw[offset+1])
+		offset++
+		width = 4
+	}
+	count := operandCounts[opcode]
+	if count < 0 {
+		// reported when dispatched
+		return instruction{opcode: opcode}
+	}
+	if offset+1+width*count > len(c.raw) {
+		return instruction{}
+	}
+
+	in := instruction{opcode: opcode}
+	operands := c.raw[offset+1:]
+	if count > 0 {
+		in.a = op.ReadOperand(operands, width)
+	}
+	if count > 1 {
+		in.b = op.ReadOperand(operands[width:], width)
+	}
+	switch opcode {
+	case op.Jump, op.JumpTrue, op.JumpFalse, op.Defer:
+		if in.a >= len(c.indices) || c.indices[in.a] < 0 {
+			return instruction{}
+		}
+		in.a = c.indices[in.a]
+	}
+	return in
+}
+
+// operandCounts holds the amount of operands of each opcode, -1 if undefined.
+var operandCounts = func() (counts [256]int) {
+	for i := range counts {
+		def, err := op.LookupDefinition(byte(i))
+		if err != nil {
+			counts[i] = -1
+			continue
+		}
+		counts[i] = len(def.OperandWidths)
+	}
+	return counts
+}()
+
+// codeOf returns the decoded instructions of a function.
+func (vm *VM) codeOf(fn *runtime.CompiledFunction) *code {
+	c, ok := vm.codes[fn]
+	if !ok {
+		c = decode(fn.Instructions)
+		vm.codes[fn] = c
+	}
+	return c
+}
@@ -0,0 +1,9 @@
+package vm
+
+// WithDecodeOnDispatch decodes each instruction when it is dispatched,
+// so benchmarks can compare it to the instructions decoded when the vm is created.
+func WithDecodeOnDispatch() Option {
+	return func(vm *VM) {
+		vm.decodeOnDispatch = true
+	}
+}
@@ -46,6 +46,11 @@ func (s *Global) Get(owner TaskId) (runtime.RuntimeValue, error) {
 			if atomic.CompareAndSwapUint32(&s.state, globalSlotStateUninitialized, globalSlotStateInitializing) {
 				atomic.StoreUint64(&s.owner, uint64(owner))
 				v, err := s.init(owner)
+				if err != nil {
+					// a recovered panic may access the global again
+					atomic.StoreUint32(&s.state, globalSlotStateUninitialized)
+					return nil, err
+				}
 				s.value = v
 				s.init = nil
 				atomic.StoreUint32(&s.state, globalSlotStateInitialized)
@@ -0,0 +1,31 @@
+package vm
+
+const (
+	// DefaultStackLimit is the maximum of values on the stack, unless configured by WithStackLimit.
+	DefaultStackLimit = 2048
+	// DefaultFrameLimit is the maximum of nested calls, unless configured by WithFrameLimit.
+	DefaultFrameLimit = 1024
+
+	// The stack and the frames start small and grow on demand up to their limits.
+	initialStackSize = 64
+	initialFrames    = 16
+)
+
+// Option configures a VM.
+type Option func(*VM)
+
+// WithStackLimit limits the values on the stack.
+// Exceeding the limit fails with a StackOverflow.
+func WithStackLimit(limit int) Option {
+	return func(vm *VM) {
+		vm.stackLimit = max(limit, 1)
+	}
+}
+
+// WithFrameLimit limits the nested calls including the top level.
+// Exceeding the limit fails with a StackOverflow.
+func WithFrameLimit(limit int) Option {
+	return func(vm *VM) {
+		vm.frameLimit = max(limit, 1)
+	}
+}
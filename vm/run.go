@@ -1,8 +1,10 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
+	"slices"
 
 	"github.com/vknabel/zirric/op"
 	"github.com/vknabel/zirric/runtime"
@@ -13,307 +15,716 @@ func (vm *VM) Run() error {
 	return vm.runTask(taskId)
 }
 
+// runTask runs the current frame and all frames it calls.
+// Errors panic and unwind those frames until a deferred block recovers.
 func (vm *VM) runTask(taskId TaskId) error {
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions()) {
-		vm.currentFrame().ip++
+	floor := vm.framesIdx - 1
+	for {
+		err := vm.execute(taskId)
+		if err == nil {
+			return nil
+		}
+		p := vm.makePanic(err)
+		if !vm.unwind(p, floor) {
+			return p
+		}
+	}
+}
 
-		var (
-			fr   = vm.currentFrame()
-			ip   = fr.ip
-			ins  = fr.Instructions()
-			code = op.Opcode(ins[ip-1])
-		)
+// execute dispatches the instructions of the current frame and of the frames it calls.
+// The frame, its instructions and the instruction pointer are kept in locals
+// and are only reloaded, when calls and returns switch frames.
+// The instruction pointer is only stored in the frame before calls and on errors.
+func (vm *VM) execute(taskId TaskId) error {
+	fr := vm.currentFrame()
+	ins, ip := fr.code.ins, fr.ip
+	for ip < len(ins) {
+		in := ins[ip]
+		if vm.decodeOnDispatch {
+			in = fr.code.decodeAt(ip)
+		}
+		ip++
 
-		switch code {
+		switch in.opcode {
 		case op.Pop:
 			vm.pop()
+		case op.Dup:
+			if err := vm.push(vm.stack[vm.sp-1]); err != nil {
+				return vm.fail(fr, ip, err)
+			}
 
 		case op.Const:
-			idx := op.ReadUint16(ins[ip:])
-			fr.ip += 2
-
-			err := vm.push(vm.constants[idx])
+			idx := in.a
+			err := vm.push(vm.literals[idx])
 			if err != nil {
-				return err
+				return vm.fail(fr, ip, err)
 			}
 		case op.ConstTrue:
-			err := vm.push(runtime.Bool(true))
+			err := vm.push(valueTrue)
 			if err != nil {
-				return err
+				return vm.fail(fr, ip, err)
 			}
 		case op.ConstFalse:
-			err := vm.push(runtime.Bool(false))
+			err := vm.push(valueFalse)
 			if err != nil {
-				return err
+				return vm.fail(fr, ip, err)
 			}
 		case op.ConstNull:
-			err := vm.push(runtime.Null{})
+			err := vm.push(null)
 			if err != nil {
-				return err
+				return vm.fail(fr, ip, err)
 			}
 
 		case op.Jump:
-			pos := int(op.ReadUint16(ins[ip:]))
-			fr.ip = pos
+			ip = in.a
 		case op.JumpFalse:
-			pos := int(op.ReadUint16(ins[ip:]))
-			fr.ip += 2
 			cond := vm.pop()
 
-			if cond == runtime.Bool(false) {
-				fr.ip = pos
+			if cond.isFalse() {
+				ip = in.a
 			}
 		case op.JumpTrue:
-			pos := int(op.ReadUint16(ins[ip:]))
-			fr.ip += 2
 			cond := vm.pop()
 
-			if cond != runtime.Bool(false) {
-				fr.ip = pos
+			if !cond.isFalse() {
+				ip = in.a
 			}
 
 		case op.AssertType:
-			typeId := runtime.TypeId(op.ReadUint16(ins[ip:]))
-			fr.ip += 2
+			typeId := runtime.TypeId(in.a)
 			v := vm.stack[vm.sp-1]
-			if v.TypeConstantId() != typeId {
-				return fmt.Errorf("unexpected type (%T %q)", v, v.Inspect())
+			if v.typeId() != typeId {
+				return vm.fail(fr, ip, fmt.Errorf("unexpected type (%s)", v.describe()))
+			}
+
+		case op.AssertContract:
+			id := in.a
+			if err := vm.contracts[id].Check(vm.constants, vm.stack[vm.sp-1].boxed()); err != nil {
+				// parameters and return values are checked within the callee
+				site := vm.callSite(vm.framesIdx - 2)
+				if fr.tailCaller != nil {
+					site = "called from " + fr.tailCaller.Name
+				}
+				return vm.fail(fr, ip, fmt.Errorf("%w, %s", err, site))
+			}
+		case op.MatchContract:
+			id := in.a
+			matches := vm.contracts[id].Accepts(vm.pop().boxed())
+			if err := vm.push(makeBool(runtime.Bool(matches))); err != nil {
+				return vm.fail(fr, ip, err)
 			}
 
 		case op.Invert:
-			v, ok := vm.pop().(runtime.Bool)
-			if !ok {
-				return fmt.Errorf("prefix operator ! is only defined on Bool (%T %q)", v, v.Inspect())
+			v := vm.pop()
+			if v.kind != kindBool {
+				return vm.fail(fr, ip, fmt.Errorf("prefix operator ! is only defined on Bool (%s)", v.describe()))
 			}
-			if err := vm.push(!v); err != nil {
-				return err
+			if err := vm.push(makeBool(!v.bool())); err != nil {
+				return vm.fail(fr, ip, err)
 			}
 		case op.Negate:
 			v := vm.pop()
-			switch v := v.(type) {
-			case runtime.Int:
-				if err := vm.push(-v); err != nil {
-					return err
+			switch v.kind {
+			case kindInt:
+				if err := vm.push(makeInt(-v.int())); err != nil {
+					return vm.fail(fr, ip, err)
 				}
-			case runtime.Float:
-				if err := vm.push(-v); err != nil {
-					return err
+			case kindFloat:
+				if err := vm.push(makeFloat(-v.float())); err != nil {
+					return vm.fail(fr, ip, err)
 				}
 			default:
-				return fmt.Errorf("prefix operator - is only defined on Int or Float (%T %q)", v, v.Inspect())
+				return vm.fail(fr, ip, fmt.Errorf("prefix operator - is only defined on Int or Float (%s)", v.describe()))
 			}
 		case op.Add, op.Sub, op.Mul, op.Div,
 			op.GreaterThan, op.GreaterThanOrEqual,
 			op.LessThan, op.LessThanOrEqual:
-			err := vm.numericBinaryOperation(code)
+			err := vm.numericBinaryOperation(in.opcode)
 			if err != nil {
-				return err
+				return vm.fail(fr, ip, err)
 			}
 		case op.Mod:
-			rhs, ok := vm.pop().(runtime.Int)
-			if !ok {
-				return fmt.Errorf("operator %% is only defined on Int (%T %q)", rhs, rhs.Inspect())
+			rhs := vm.pop()
+			if rhs.kind != kindInt {
+				return vm.fail(fr, ip, fmt.Errorf("operator %% is only defined on Int (%s)", rhs.describe()))
 			}
-			lhs, ok := vm.pop().(runtime.Int)
-			if !ok {
-				return fmt.Errorf("operator %% is only defined on Int (%T %q)", lhs, lhs.Inspect())
+			lhs := vm.pop()
+			if lhs.kind != kindInt {
+				return vm.fail(fr, ip, fmt.Errorf("operator %% is only defined on Int (%s)", lhs.describe()))
+			}
+			if rhs.int() == 0 {
+				return vm.fail(fr, ip, errors.New("integer modulo by zero"))
 			}
-			err := vm.push(lhs % rhs)
+			err := vm.push(makeInt(lhs.int() % rhs.int()))
 			if err != nil {
-				return err
+				return vm.fail(fr, ip, err)
 			}
 		case op.Equal:
 			equal := vm.isEqual()
-			if err := vm.push(equal); err != nil {
-				return err
+			if err := vm.push(makeBool(equal)); err != nil {
+				return vm.fail(fr, ip, err)
 			}
 		case op.NotEqual:
 			equal := vm.isEqual()
-			if err := vm.push(!equal); err != nil {
-				return err
+			if err := vm.push(makeBool(!equal)); err != nil {
+				return vm.fail(fr, ip, err)
 			}
 
 		case op.Array:
-			length, ok := vm.pop().(runtime.Int)
-			if !ok {
-				return fmt.Errorf("lenght of an array must be an Int (%T %q)", length, length.Inspect())
-			}
+			length := in.a
 			array := make(runtime.Array, length)
 
-			for i := 1; i <= int(length); i++ {
-				array[int(length)-i] = vm.pop()
+			for i := 1; i <= length; i++ {
+				array[length-i] = vm.pop().boxed()
 			}
 
-			if err := vm.push(array); err != nil {
-				return err
+			if err := vm.push(value{kind: kindRef, ref: array}); err != nil {
+				return vm.fail(fr, ip, err)
 			}
 		case op.Dict:
-			length, ok := vm.pop().(runtime.Int)
-			if !ok {
-				return fmt.Errorf("lenght of an array must be an Int (%T %q)", length, length.Inspect())
-			}
-			dict := make(runtime.Dict)
+			length := in.a
+			dict := make(runtime.Dict, length)
 
-			for i := 0; i < int(length); i++ {
+			for i := 0; i < length; i++ {
 				value := vm.pop()
 				key := vm.pop()
-				dict[key] = value
+				dict[key.boxed()] = value.boxed()
 			}
 
-			if err := vm.push(dict); err != nil {
-				return err
+			if err := vm.push(value{kind: kindRef, ref: dict}); err != nil {
+				return vm.fail(fr, ip, err)
 			}
 
 		case op.GetIndex:
 			index := vm.pop()
-			target := vm.pop()
+			target := vm.pop().boxed()
 
 			switch target := target.(type) {
 			case runtime.Array:
-				idx, ok := index.(runtime.Int)
-				if !ok {
-					return fmt.Errorf("array index must be Int (%T %q)", index, index.Inspect())
+				if index.kind != kindInt {
+					return vm.fail(fr, ip, fmt.Errorf("array index must be Int (%s)", index.describe()))
 				}
-				pos := int(idx)
+				pos := int(index.int())
 				if pos < 0 || pos >= len(target) {
-					return fmt.Errorf("array index %d out of bounds", pos)
+					return vm.fail(fr, ip, fmt.Errorf("array index %d out of bounds", pos))
 				}
-				if err := vm.push(target[pos]); err != nil {
-					return err
+				if err := vm.push(valueOf(target[pos])); err != nil {
+					return vm.fail(fr, ip, err)
 				}
 			case runtime.Dict:
-				val, ok := target[index]
-				if !ok {
-					if err := vm.push(runtime.Null{}); err != nil {
-						return err
-					}
-					break
-				}
-				if err := vm.push(val); err != nil {
-					return err
+				if err := vm.push(valueOf(target[index.boxed()])); err != nil {
+					return vm.fail(fr, ip, err)
 				}
 			default:
-				return fmt.Errorf("index operator not supported on %T", target)
+				return vm.fail(fr, ip, fmt.Errorf("index operator not supported on %T", target))
 			}
 
 		case op.SetLocal:
-			idx := op.ReadUint16(ins[ip:])
-			fr.ip += 2
+			idx := in.a
 			val := vm.pop()
 			fr.locals[idx] = val
 
 		case op.GetLocal:
-			idx := op.ReadUint16(ins[ip:])
-			fr.ip += 2
-
+			idx := in.a
 			if err := vm.push(fr.locals[idx]); err != nil {
-				return err
+				return vm.fail(fr, ip, err)
 			}
 
 		case op.GetGlobal:
-			idx := op.ReadUint16(ins[ip:])
-			fr.ip += 2
-
+			idx := in.a
 			global := vm.globals[idx]
 
+			// initializers run like calls
+			fr.ip = ip
 			val, err := global.Get(taskId)
 			if err != nil {
-				return err
+				return vm.fail(fr, ip, err)
 			}
 
-			if err := vm.push(val); err != nil {
-				return err
+			if err := vm.push(valueOf(val)); err != nil {
+				return vm.fail(fr, ip, err)
 			}
 
 		case op.SetGlobal:
-			idx := op.ReadUint16(ins[ip:])
-			fr.ip += 2
+			idx := in.a
 			val := vm.pop()
 
-			if err := vm.globals[idx].Set(taskId, val); err != nil {
-				return err
+			if err := vm.globals[idx].Set(taskId, val.boxed()); err != nil {
+				return vm.fail(fr, ip, err)
 			}
 
 		case op.GetField:
-			nameIdx := op.ReadUint16(ins[ip:])
-			fr.ip += 2
+			nameIdx := in.a
 			nameConst, ok := vm.constants[nameIdx].(runtime.String)
 			if !ok {
-				return fmt.Errorf("name lookup requires a String constant (%T %q)", vm.constants[nameIdx], vm.constants[nameIdx].Inspect())
+				return vm.fail(fr, ip, fmt.Errorf("name lookup requires a String constant (%T %q)", vm.constants[nameIdx], vm.constants[nameIdx].Inspect()))
 			}
 			name := string(nameConst)
-			obj := vm.pop()
+			obj := vm.pop().boxed()
 			val := obj.Lookup(name)
+			if mod, ok := obj.(*runtime.Module); ok && val == nil {
+				if id, ok := mod.Global(name); ok {
+					global, err := vm.globals[id].Get(taskId)
+					if err != nil {
+						return vm.fail(fr, ip, err)
+					}
+					val = global
+				}
+			}
 			if val == nil {
-				return fmt.Errorf("name %q not found in %T %q", name, obj, obj.Inspect())
+				return vm.fail(fr, ip, fmt.Errorf("name %q not found in %T %q", name, obj, obj.Inspect()))
 			}
 
-			if err := vm.push(val); err != nil {
-				return err
+			if err := vm.push(valueOf(val)); err != nil {
+				return vm.fail(fr, ip, err)
+			}
+
+		case op.Propagate:
+			okId := runtime.TypeId(in.a)
+			errId := runtime.TypeId(in.b)
+
+			val := vm.pop()
+			dv, ok := val.ref.(*runtime.DataValue)
+			switch {
+			case ok && dv.TypeId == okId:
+				if err := vm.push(valueOf(dv.Values[0])); err != nil {
+					return vm.fail(fr, ip, err)
+				}
+			case ok && dv.TypeId == errId:
+				if err := vm.returnValue(val); err != nil {
+					return vm.fail(fr, ip, err)
+				}
+				fr = vm.currentFrame()
+				ins, ip = fr.code.ins, fr.ip
+			default:
+				// other values are treated as Ok
+				if err := vm.push(val); err != nil {
+					return vm.fail(fr, ip, err)
+				}
+			}
+
+		case op.CopyWith:
+			count := in.a
+
+			names := make([]string, count)
+			values := make([]runtime.RuntimeValue, count)
+			for i := count - 1; i >= 0; i-- {
+				values[i] = vm.pop().boxed()
+				v := vm.pop()
+				name, ok := v.ref.(runtime.String)
+				if !ok {
+					return vm.fail(fr, ip, fmt.Errorf("field names must be Strings (%s)", v.describe()))
+				}
+				names[i] = string(name)
+			}
+			target := vm.pop()
+			dv, ok := target.ref.(*runtime.DataValue)
+			if !ok {
+				return vm.fail(fr, ip, fmt.Errorf("with is only defined on data values (%s)", target.describe()))
+			}
+			copied, err := dv.CopyWith(names, values)
+			if err != nil {
+				return vm.fail(fr, ip, err)
+			}
+			if err := vm.checkFields(copied, names); err != nil {
+				return vm.fail(fr, ip, err)
+			}
+			if err := vm.push(value{kind: kindRef, ref: copied}); err != nil {
+				return vm.fail(fr, ip, err)
 			}
 
 		case op.Call:
-			argCount := int(op.ReadUint16(ins[ip:]))
-			fr.ip += 2
+			argCount := in.a
 			callee := vm.pop()
 
-			switch callee := callee.(type) {
-			case *runtime.CompiledFunction:
-				if argCount != callee.Arity() {
-					return fmt.Errorf("wrong number of arguments: want=%d, got=%d", callee.Arity(), argCount)
-				}
+			fr.ip = ip
+			if err := vm.call(callee, argCount, nil); err != nil {
+				return vm.fail(fr, ip, err)
+			}
+			fr = vm.currentFrame()
+			ins, ip = fr.code.ins, fr.ip
 
-				closure := runtime.MakeClosure(callee, nil)
-				frame := newClosureFrame(closure, vm.sp-argCount)
+		case op.CallSpread:
+			callee := vm.pop()
+			argCount, err := vm.spread(in.a)
+			if err != nil {
+				return vm.fail(fr, ip, err)
+			}
 
-				vm.pushFrame(frame)
-				vm.sp = frame.basep
+			fr.ip = ip
+			if err := vm.call(callee, argCount, nil); err != nil {
+				return vm.fail(fr, ip, err)
+			}
+			fr = vm.currentFrame()
+			ins, ip = fr.code.ins, fr.ip
 
-				for i := 0; i < argCount; i++ {
-					frame.locals[argCount-1-i] = vm.stack[vm.sp+i]
-				}
+		case op.CallNamed:
+			argCount := in.a
+			names, err := vm.argumentNames(in.b)
+			if err != nil {
+				return vm.fail(fr, ip, err)
+			}
+			callee := vm.pop()
 
-			case *runtime.DataType:
-				if argCount != callee.Arity() {
-					return fmt.Errorf("wrong number of arguments: want=%d, got=%d", callee.Arity(), argCount)
-				}
+			fr.ip = ip
+			if err := vm.call(callee, argCount, names); err != nil {
+				return vm.fail(fr, ip, err)
+			}
+			fr = vm.currentFrame()
+			ins, ip = fr.code.ins, fr.ip
 
-				vals := make([]runtime.RuntimeValue, argCount)
-				for i := 0; i < argCount; i++ {
-					vals[argCount-1-i] = vm.pop()
-				}
+		case op.TailCall:
+			argCount := in.a
+			callee := vm.pop()
 
-				dv := runtime.MakeDataValue(callee, vals)
-				err := vm.push(dv)
-				if err != nil {
-					return err
-				}
+			fr.ip = ip
+			if err := vm.tailCall(callee, argCount, nil); err != nil {
+				return vm.fail(fr, ip, err)
+			}
+			fr = vm.currentFrame()
+			ins, ip = fr.code.ins, fr.ip
+
+		case op.TailCallSpread:
+			callee := vm.pop()
+			argCount, err := vm.spread(in.a)
+			if err != nil {
+				return vm.fail(fr, ip, err)
+			}
+
+			fr.ip = ip
+			if err := vm.tailCall(callee, argCount, nil); err != nil {
+				return vm.fail(fr, ip, err)
 			}
+			fr = vm.currentFrame()
+			ins, ip = fr.code.ins, fr.ip
+
+		case op.TailCallNamed:
+			argCount := in.a
+			names, err := vm.argumentNames(in.b)
+			if err != nil {
+				return vm.fail(fr, ip, err)
+			}
+			callee := vm.pop()
+
+			fr.ip = ip
+			if err := vm.tailCall(callee, argCount, names); err != nil {
+				return vm.fail(fr, ip, err)
+			}
+			fr = vm.currentFrame()
+			ins, ip = fr.code.ins, fr.ip
 
 		case op.Return:
-			ret := vm.pop()
-			frame := vm.popFrame()
-			vm.sp = frame.basep
+			if err := vm.returnValue(vm.pop()); err != nil {
+				return vm.fail(fr, ip, err)
+			}
+			fr = vm.currentFrame()
+			ins, ip = fr.code.ins, fr.ip
 
-			if err := vm.push(ret); err != nil {
-				return err
+		case op.Defer:
+			fr.defers = append(fr.defers, ip)
+			ip = in.a
+
+		case op.EndDefer:
+			if err := vm.leaveFrame(); err != nil {
+				return vm.fail(fr, ip, err)
+			}
+			fr = vm.currentFrame()
+			ins, ip = fr.code.ins, fr.ip
+
+		case op.Panic:
+			return vm.fail(fr, ip, &runtime.Panic{Value: vm.pop().boxed()})
+
+		case op.Recover:
+			val := null
+			if fr.panic != nil {
+				val = valueOf(fr.panic.Value)
+				fr.panic = nil
+			}
+			if err := vm.push(val); err != nil {
+				return vm.fail(fr, ip, err)
 			}
 
 		default:
-			def, err := op.LookupDefinition(byte(code))
+			def, err := op.LookupDefinition(byte(in.opcode))
 			if err != nil {
-				return fmt.Errorf("unhandled opcode: %w", err)
+				return vm.fail(fr, ip, fmt.Errorf("unhandled opcode: %w", err))
 			}
-			return fmt.Errorf("unknown opcode %q", def.Name)
+			return vm.fail(fr, ip, fmt.Errorf("unknown opcode %q", def.Name))
 		}
 	}
 
 	return nil
 }
 
-func (vm *VM) push(val runtime.RuntimeValue) error {
-	if vm.sp >= stackSize {
-		return fmt.Errorf("stack overflow")
+// fail stores the position of the failed instruction in its frame
+// and traces the active frames of stack overflows.
+func (vm *VM) fail(fr *Frame, ip int, err error) error {
+	fr.ip = ip
+	var overflow *StackOverflow
+	if errors.As(err, &overflow) && overflow.Trace == nil {
+		overflow.Trace = vm.trace()
+	}
+	return err
+}
+
+// returnValue leaves the current frame and passes ret to the caller.
+// Inside deferred blocks, ret replaces the previous return value.
+func (vm *VM) returnValue(ret value) error {
+	vm.currentFrame().result = ret
+	return vm.leaveFrame()
+}
+
+// leaveFrame runs the next deferred block of the current frame.
+// Once all ran, the frame returns its result or continues to unwind its panic.
+func (vm *VM) leaveFrame() error {
+	fr := vm.currentFrame()
+	if n := len(fr.defers); n > 0 {
+		fr.ip = fr.defers[n-1]
+		fr.defers = fr.defers[:n-1]
+		vm.sp = fr.basep
+		return nil
+	}
+	if fr.panic != nil {
+		return fr.panic
+	}
+
+	frame := vm.popFrame()
+	vm.sp = frame.basep
+	ret := frame.result
+	vm.releaseFrame(frame)
+	return vm.push(ret)
+}
+
+// makePanic wraps runtime errors into a panic with an `Error` value.
+func (vm *VM) makePanic(err error) *runtime.Panic {
+	var p *runtime.Panic
+	if errors.As(err, &p) {
+		return p
+	}
+
+	var val runtime.RuntimeValue = runtime.String(err.Error())
+	if vm.result != nil {
+		if errVal, mkErr := vm.result.MakeError(vm.constants, err.Error()); mkErr == nil {
+			val = errVal
+		}
+	}
+	return &runtime.Panic{Value: val, Cause: err}
+}
+
+// unwind drops all frames above the topmost one with deferred blocks and runs them.
+// Frames below floor are not unwound.
+// Reports false if no frame can handle the panic.
+func (vm *VM) unwind(p *runtime.Panic, floor int) bool {
+	for i := vm.framesIdx - 1; i >= floor; i-- {
+		fr := vm.frames[i]
+		if len(fr.defers) == 0 {
+			continue
+		}
+		vm.framesIdx = i + 1
+		fr.panic = p
+		fr.result = null
+		// a frame with deferred blocks only jumps to the next one
+		_ = vm.leaveFrame()
+		return true
+	}
+	vm.framesIdx = floor + 1
+	vm.sp = vm.frames[floor].basep
+	return false
+}
+
+// call invokes the callee with the topmost argCount values on the stack.
+// The last len(names) arguments are passed by name.
+func (vm *VM) call(callee value, argCount int, names runtime.Array) error {
+	callable, ok := callee.ref.(runtime.CallableRuntimeValue)
+	if !ok {
+		return fmt.Errorf("cannot call %s", callee.describe())
+	}
+	if len(names) > 0 || argCount != callable.Arity() || callable.IsVariadic() {
+		var err error
+		argCount, err = vm.bindArguments(callable, argCount, names)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch callee := callable.(type) {
+	case *runtime.CompiledFunction:
+		if argCount != callee.Params {
+			return fmt.Errorf("wrong number of arguments: want=%d, got=%d", callee.Params, argCount)
+		}
+
+		frame := vm.newFrame(vm.codeOf(callee), callee, vm.sp-argCount)
+		if err := vm.pushFrame(frame); err != nil {
+			vm.releaseFrame(frame)
+			return err
+		}
+		vm.sp = frame.basep
+
+		for i := 0; i < argCount; i++ {
+			frame.locals[i] = vm.stack[vm.sp+i]
+		}
+		return nil
+
+	case *runtime.DataType:
+		if argCount != callee.Arity() {
+			return fmt.Errorf("wrong number of arguments: want=%d, got=%d", callee.Arity(), argCount)
+		}
+
+		vals := make([]runtime.RuntimeValue, argCount)
+		for i := 0; i < argCount; i++ {
+			vals[argCount-1-i] = vm.pop().boxed()
+		}
+
+		dv := runtime.MakeDataValue(callee, vals)
+		if callee.Contracts != nil {
+			if err := vm.checkFields(dv, nil); err != nil {
+				return err
+			}
+		}
+		return vm.push(value{kind: kindRef, ref: dv})
+
+	case runtime.ExternFunc:
+		args := make([]runtime.RuntimeValue, argCount)
+		for i := 0; i < argCount; i++ {
+			args[argCount-1-i] = vm.pop().boxed()
+		}
+
+		ret, err := callee.Call(args)
+		var failure runtime.Failure
+		if errors.As(err, &failure) && vm.result != nil {
+			ret, err = vm.result.MakeErr(vm.constants, failure)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", callee.Inspect(), err)
+		}
+		return vm.push(valueOf(ret))
+
+	default:
+		return fmt.Errorf("cannot call %T %q", callee, callee.Inspect())
+	}
+}
+
+// spread replaces the array on top of the stack by its elements.
+// Returns the new amount of arguments.
+func (vm *VM) spread(argCount int) (int, error) {
+	v := vm.pop()
+	spread, ok := v.ref.(runtime.Array)
+	if !ok {
+		return 0, fmt.Errorf("spread argument must be an Array (%s)", v.describe())
+	}
+	for _, arg := range spread {
+		if err := vm.push(valueOf(arg)); err != nil {
+			return 0, err
+		}
+	}
+	return argCount - 1 + len(spread), nil
+}
+
+// argumentNames returns the names of the named arguments of a call.
+func (vm *VM) argumentNames(namesIdx int) (runtime.Array, error) {
+	names, ok := vm.constants[namesIdx].(runtime.Array)
+	if !ok {
+		return nil, fmt.Errorf("argument names require an Array constant (%T %q)", vm.constants[namesIdx], vm.constants[namesIdx].Inspect())
+	}
+	return names, nil
+}
+
+// tailCall replaces the current frame by a call of the callee, so tail recursion runs in constant space.
+// The last len(names) arguments are passed by name.
+// Other callees and frames with deferred blocks are called regularly
+// and the return following the tail call passes the result on.
+func (vm *VM) tailCall(callee value, argCount int, names runtime.Array) error {
+	fr := vm.currentFrame()
+	fn, ok := callee.ref.(*runtime.CompiledFunction)
+	if !ok || fr.fn == nil || len(fr.defers) > 0 || fr.panic != nil {
+		return vm.call(callee, argCount, names)
+	}
+	if len(names) > 0 || argCount != fn.Arity() || fn.IsVariadic() {
+		var err error
+		argCount, err = vm.bindArguments(fn, argCount, names)
+		if err != nil {
+			return err
+		}
+	}
+	if argCount != fn.Params {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", fn.Params, argCount)
+	}
+
+	fr.locals = resize(fr.locals, fn.Params+fn.Locals)
+	copy(fr.locals, vm.stack[vm.sp-argCount:vm.sp])
+
+	fr.code = vm.codeOf(fn)
+	fr.ip = 0
+	fr.tailCaller = fr.fn
+	fr.fn = fn
+	fr.result = null
+	vm.sp = fr.basep
+	return nil
+}
+
+// checkFields checks the named fields of a data value against the contracts of its data type.
+// Without names, all fields are checked.
+func (vm *VM) checkFields(dv *runtime.DataValue, names []string) error {
+	dt, ok := vm.constants[dv.TypeId].(*runtime.DataType)
+	if !ok || dt.Contracts == nil {
+		return nil
+	}
+	for i, ct := range dt.Contracts {
+		if ct == nil || (names != nil && !slices.Contains(names, dt.Fields[i])) {
+			continue
+		}
+		if err := ct.Check(vm.constants, dv.Values[i]); err != nil {
+			return fmt.Errorf("%w, %s", err, vm.callSite(vm.framesIdx-1))
+		}
+	}
+	return nil
+}
+
+// callSite describes the caller of a contract violation by the function of the given frame.
+func (vm *VM) callSite(frameIdx int) string {
+	if frameIdx < 0 || vm.frames[frameIdx].fn == nil {
+		return "called at top level"
+	}
+	return "called from " + vm.frames[frameIdx].fn.Name
+}
+
+// bindArguments replaces the topmost argCount values on the stack
+// by the arguments in parameter order, including omitted defaults.
+// Returns the new amount of arguments.
+func (vm *VM) bindArguments(callable runtime.CallableRuntimeValue, argCount int, names runtime.Array) (int, error) {
+	args := make([]runtime.RuntimeValue, argCount)
+	for i, arg := range vm.stack[vm.sp-argCount : vm.sp] {
+		args[i] = arg.boxed()
+	}
+	positional := argCount - len(names)
+	nameStrs := make([]string, len(names))
+	for i, name := range names {
+		nameStrs[i] = string(name.(runtime.String))
+	}
+
+	bound, err := runtime.BindArguments(callable.Parameters(), args[:positional], nameStrs, args[positional:])
+	if err != nil {
+		return 0, err
+	}
+
+	vm.sp -= argCount
+	for _, arg := range bound {
+		if err := vm.push(valueOf(arg)); err != nil {
+			return 0, err
+		}
+	}
+	return len(bound), nil
+}
+
+func (vm *VM) push(val value) error {
+	if vm.sp >= len(vm.stack) {
+		if vm.sp >= vm.stackLimit {
+			return vm.stackOverflow()
+		}
+		// grows like append, but keeps all slots addressable
+		stack := make([]value, min(2*len(vm.stack), vm.stackLimit))
+		copy(stack, vm.stack)
+		vm.stack = stack
 	}
 
 	vm.stack[vm.sp] = val
@@ -321,57 +732,59 @@ func (vm *VM) push(val runtime.RuntimeValue) error {
 	return nil
 }
 
-func (vm *VM) pop() runtime.RuntimeValue {
+func (vm *VM) pop() value {
 	v := vm.stack[vm.sp-1]
 	vm.sp--
 	return v
 }
 
+// numericBinaryOperation operates on the immediate payloads of both operands.
+// Ints are converted to Floats, if the other operand is a Float.
 func (vm *VM) numericBinaryOperation(operator op.Opcode) error {
-	switch rhs := vm.pop().(type) {
-	case runtime.Int:
-		switch lhs := vm.pop().(type) {
-		case runtime.Int:
-			return vm.numericBinaryOperationInt(operator, lhs, rhs)
-		case runtime.Float:
-			return vm.numericBinaryOperationFloat(operator, lhs, runtime.Float(rhs))
-		default:
-			return fmt.Errorf("unsupported %T", lhs)
-		}
-	case runtime.Float:
-		switch lhs := vm.pop().(type) {
-		case runtime.Int:
-			return vm.numericBinaryOperationFloat(operator, runtime.Float(lhs), rhs)
-		case runtime.Float:
-			return vm.numericBinaryOperationFloat(operator, lhs, rhs)
-		default:
-			return fmt.Errorf("unsupported %T", lhs)
-		}
+	rhs := vm.pop()
+	lhs := vm.pop()
+	switch {
+	case lhs.kind == kindInt && rhs.kind == kindInt:
+		return vm.numericBinaryOperationInt(operator, lhs.int(), rhs.int())
+	case lhs.kind == kindFloat && rhs.kind == kindFloat:
+		return vm.numericBinaryOperationFloat(operator, lhs.float(), rhs.float())
+	case lhs.kind == kindInt && rhs.kind == kindFloat:
+		return vm.numericBinaryOperationFloat(operator, runtime.Float(lhs.int()), rhs.float())
+	case lhs.kind == kindFloat && rhs.kind == kindInt:
+		return vm.numericBinaryOperationFloat(operator, lhs.float(), runtime.Float(rhs.int()))
+	case rhs.kind != kindInt && rhs.kind != kindFloat:
+		return fmt.Errorf("unsupported %T", rhs.boxed())
 	default:
-		return fmt.Errorf("unsupported %T", rhs)
+		return fmt.Errorf("unsupported %T", lhs.boxed())
 	}
 }
 
 func (vm *VM) numericBinaryOperationInt(operator op.Opcode, lhs, rhs runtime.Int) error {
 	switch operator {
 	case op.Add:
-		return vm.push(lhs + rhs)
+		return vm.push(makeInt(lhs + rhs))
 	case op.Sub:
-		return vm.push(lhs - rhs)
+		return vm.push(makeInt(lhs - rhs))
 	case op.Mul:
-		return vm.push(lhs * rhs)
+		return vm.push(makeInt(lhs * rhs))
 	case op.Div:
-		return vm.push(lhs / rhs)
+		if rhs == 0 {
+			return errors.New("integer division by zero")
+		}
+		return vm.push(makeInt(lhs / rhs))
 	case op.Mod:
-		return vm.push(lhs % rhs)
+		if rhs == 0 {
+			return errors.New("integer modulo by zero")
+		}
+		return vm.push(makeInt(lhs % rhs))
 	case op.LessThan:
-		return vm.push(runtime.Bool(lhs < rhs))
+		return vm.push(makeBool(lhs < rhs))
 	case op.LessThanOrEqual:
-		return vm.push(runtime.Bool(lhs <= rhs))
+		return vm.push(makeBool(lhs <= rhs))
 	case op.GreaterThan:
-		return vm.push(runtime.Bool(lhs > rhs))
+		return vm.push(makeBool(lhs > rhs))
 	case op.GreaterThanOrEqual:
-		return vm.push(runtime.Bool(lhs >= rhs))
+		return vm.push(makeBool(lhs >= rhs))
 	default:
 		return fmt.Errorf("unknown binary operator %x", operator)
 	}
@@ -379,21 +792,21 @@ func (vm *VM) numericBinaryOperationInt(operator op.Opcode, lhs, rhs runtime.Int
 func (vm *VM) numericBinaryOperationFloat(operator op.Opcode, lhs, rhs runtime.Float) error {
 	switch operator {
 	case op.Add:
-		return vm.push(lhs + rhs)
+		return vm.push(makeFloat(lhs + rhs))
 	case op.Sub:
-		return vm.push(lhs - rhs)
+		return vm.push(makeFloat(lhs - rhs))
 	case op.Mul:
-		return vm.push(lhs * rhs)
+		return vm.push(makeFloat(lhs * rhs))
 	case op.Div:
-		return vm.push(lhs / rhs)
+		return vm.push(makeFloat(lhs / rhs))
 	case op.LessThan:
-		return vm.push(runtime.Bool(lhs < rhs))
+		return vm.push(makeBool(lhs < rhs))
 	case op.LessThanOrEqual:
-		return vm.push(runtime.Bool(lhs <= rhs))
+		return vm.push(makeBool(lhs <= rhs))
 	case op.GreaterThan:
-		return vm.push(runtime.Bool(lhs > rhs))
+		return vm.push(makeBool(lhs > rhs))
 	case op.GreaterThanOrEqual:
-		return vm.push(runtime.Bool(lhs >= rhs))
+		return vm.push(makeBool(lhs >= rhs))
 	default:
 		return fmt.Errorf("unknown binary operator %x", operator)
 	}
@@ -402,51 +815,27 @@ func (vm *VM) isEqual() runtime.Bool {
 	rhs := vm.pop()
 	lhs := vm.pop()
 
-	if lhs.TypeConstantId() != rhs.TypeConstantId() {
+	if lhs.kind != rhs.kind {
 		return false
 	}
-	switch lhs := lhs.(type) {
-	case runtime.Int:
-		rhs, ok := rhs.(runtime.Int)
-		if !ok {
-			return false
-		}
-		return lhs == rhs
-	case runtime.Float:
-		rhs, ok := rhs.(runtime.Float)
-		if !ok {
-			return false
-		}
-		return lhs == rhs
-	case runtime.Bool:
-		rhs, ok := rhs.(runtime.Bool)
-		if !ok {
-			return false
-		}
-		return lhs == rhs
-	case runtime.Char:
-		rhs, ok := rhs.(runtime.Char)
-		if !ok {
-			return false
-		}
-		return lhs == rhs
-	case runtime.String:
-		rhs, ok := rhs.(runtime.String)
-		if !ok {
-			return false
-		}
-		return lhs == rhs
-	case runtime.Null:
-		_, ok := rhs.(runtime.Null)
-		return runtime.Bool(ok)
+	switch lhs.kind {
+	case kindNull:
+		return true
+	case kindFloat:
+		return lhs.float() == rhs.float()
+	case kindBool, kindInt, kindChar:
+		return lhs.bits == rhs.bits
 	}
-	panic(fmt.Sprintf("unknown type for equality check %T of %q", lhs, lhs.Inspect()))
+	return runtime.Bool(runtime.Equal(lhs.ref, rhs.ref))
 }
 
-func (vm *VM) initGlobal(owner TaskId, ins op.Instructions) (runtime.RuntimeValue, error) {
-	frame := newGeneralFrame(ins, vm.sp)
-	frame.ip = 0
-	vm.pushFrame(frame)
+func (vm *VM) initGlobal(owner TaskId, initializer *code, locals int) (runtime.RuntimeValue, error) {
+	frame := vm.newFrame(initializer, nil, vm.sp)
+	frame.locals = resize(frame.locals, locals)
+	if err := vm.pushFrame(frame); err != nil {
+		vm.releaseFrame(frame)
+		return nil, err
+	}
 	vm.sp = frame.basep
 
 	err := vm.runTask(owner)
@@ -454,8 +843,10 @@ func (vm *VM) initGlobal(owner TaskId, ins op.Instructions) (runtime.RuntimeValu
 		return nil, err
 	}
 
-	val := vm.stack[vm.sp-1]
+	val := vm.stack[vm.sp-1].boxed()
 	vm.popFrame()
+	vm.sp = frame.basep
+	vm.releaseFrame(frame)
 
 	return val, nil
 }
@@ -0,0 +1,148 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/vknabel/zirric/runtime"
+)
+
+// kind tells how the payload of a value is stored.
+type kind uint8
+
+const (
+	// the zero value is null, so cleared slots hold null
+	kindNull kind = iota
+	kindBool
+	kindInt
+	kindFloat
+	kindChar
+	// all other runtime values
+	kindRef
+)
+
+// value is a slot of the stack and of the locals.
+// Ints, floats, bools, chars and null are stored immediately within the slot,
+// so pushing and operating on them doesn't allocate.
+// All other values are referenced as runtime values.
+type value struct {
+	kind kind
+	// the payload of immediate values
+	bits uint64
+	// the payload of referenced values
+	ref runtime.RuntimeValue
+}
+
+var (
+	null       = value{}
+	valueTrue  = value{kind: kindBool, bits: 1}
+	valueFalse = value{kind: kindBool}
+)
+
+func makeInt(i runtime.Int) value {
+	return value{kind: kindInt, bits: uint64(i)}
+}
+
+func makeFloat(f runtime.Float) value {
+	return value{kind: kindFloat, bits: math.Float64bits(float64(f))}
+}
+
+func makeBool(b runtime.Bool) value {
+	if b {
+		return valueTrue
+	}
+	return valueFalse
+}
+
+func makeChar(c runtime.Char) value {
+	return value{kind: kindChar, bits: uint64(c)}
+}
+
+func (v value) int() runtime.Int {
+	return runtime.Int(v.bits)
+}
+
+func (v value) float() runtime.Float {
+	return runtime.Float(math.Float64frombits(v.bits))
+}
+
+func (v value) bool() runtime.Bool {
+	return v.bits != 0
+}
+
+func (v value) char() runtime.Char {
+	return runtime.Char(v.bits)
+}
+
+// isFalse reports whether the value is false, the only falsy value.
+func (v value) isFalse() bool {
+	return v.kind == kindBool && v.bits == 0
+}
+
+// valueOf stores a runtime value within a slot.
+// Immediate kinds are unboxed, nil becomes null.
+func valueOf(v runtime.RuntimeValue) value {
+	switch v := v.(type) {
+	case nil, runtime.Null:
+		return null
+	case runtime.Bool:
+		return makeBool(v)
+	case runtime.Int:
+		return makeInt(v)
+	case runtime.Float:
+		return makeFloat(v)
+	case runtime.Char:
+		return makeChar(v)
+	default:
+		return value{kind: kindRef, ref: v}
+	}
+}
+
+// boxed returns the value as a runtime value for arrays, dicts, data values, globals and extern functions.
+func (v value) boxed() runtime.RuntimeValue {
+	switch v.kind {
+	case kindBool:
+		return v.bool()
+	case kindInt:
+		return v.int()
+	case kindFloat:
+		return v.float()
+	case kindChar:
+		return v.char()
+	case kindRef:
+		return v.ref
+	default:
+		return runtime.Null{}
+	}
+}
+
+// immediateTypeIds are the type ids of the immediate kinds.
+var immediateTypeIds = [...]runtime.TypeId{
+	kindNull:  runtime.Null{}.TypeConstantId(),
+	kindBool:  runtime.Bool(false).TypeConstantId(),
+	kindInt:   runtime.Int(0).TypeConstantId(),
+	kindFloat: runtime.Float(0).TypeConstantId(),
+	kindChar:  runtime.Char(0).TypeConstantId(),
+}
+
+func (v value) typeId() runtime.TypeId {
+	if v.kind == kindRef {
+		return v.ref.TypeConstantId()
+	}
+	return immediateTypeIds[v.kind]
+}
+
+// describe formats the value for error messages.
+func (v value) describe() string {
+	boxed := v.boxed()
+	return fmt.Sprintf("%T %q", boxed, boxed.Inspect())
+}
+
+// values stores runtime values within slots.
+func values(vs []runtime.RuntimeValue) []value {
+	slots := make([]value, len(vs))
+	for i, v := range vs {
+		slots[i] = valueOf(v)
+	}
+	return slots
+}
@@ -1,90 +1,240 @@
 package vm
 
 import (
+	"fmt"
+	"io"
+	"strings"
+
 	"github.com/vknabel/zirric/compiler"
 	"github.com/vknabel/zirric/op"
 	"github.com/vknabel/zirric/runtime"
 )
 
 const (
-	stackSize  = 2048
 	globalSize = 65536
-	maxFrames  = 1024
 )
 
 type Frame struct {
-	ins   op.Instructions
+	code *code
+	// The index of the next instruction.
 	ip    int
 	basep int
+	// The called function, nil for top level code.
+	fn *runtime.CompiledFunction
+	// The function, that called fn in tail position and whose frame has been reused.
+	tailCaller *runtime.CompiledFunction
+
+	locals []value
+
+	// Addresses of the registered deferred blocks, the last one runs first.
+	defers []int
+	// The value to return once all deferred blocks ran.
+	result value
+	// The panic, that currently unwinds this frame. Nil after recovering.
+	panic *runtime.Panic
+}
 
-	locals []runtime.RuntimeValue
+// newFrame prepares a frame to run the instructions of fn or of top level code, if fn is nil.
+// Frames and their locals are reused from returned calls.
+func (vm *VM) newFrame(code *code, fn *runtime.CompiledFunction, basep int) *Frame {
+	var frame *Frame
+	if n := len(vm.freeFrames); n > 0 {
+		frame = vm.freeFrames[n-1]
+		vm.freeFrames = vm.freeFrames[:n-1]
+	} else {
+		frame = &Frame{}
+	}
+	frame.code = code
+	frame.basep = basep
+	frame.fn = fn
+	if fn != nil {
+		frame.locals = resize(frame.locals, fn.Params+fn.Locals)
+	}
+	return frame
 }
 
-func newClosureFrame(closure *runtime.Closure, basep int) *Frame {
-	// TODO: actually this might be wrong
-	numLocals := len(closure.Fn.Symbol.ChildTable.Symbols) - len(closure.Fn.Symbol.ChildTable.FreeSymbols)
-	return &Frame{
-		ins:    closure.Fn.Instructions,
-		ip:     0,
-		basep:  basep,
-		locals: make([]runtime.RuntimeValue, closure.Fn.Params+numLocals),
+// releaseFrame keeps a returned frame for the next call.
+// The frame must not be referenced anymore.
+func (vm *VM) releaseFrame(frame *Frame) {
+	clear(frame.locals)
+	*frame = Frame{
+		locals: frame.locals[:0],
+		defers: frame.defers[:0],
 	}
+	vm.freeFrames = append(vm.freeFrames, frame)
 }
-func newGeneralFrame(ins op.Instructions, basep int) *Frame {
-	return &Frame{
-		ins:   ins,
-		ip:    0,
-		basep: basep,
+
+// resize returns a cleared slice of the given length, reusing its storage if possible.
+func resize(values []value, length int) []value {
+	if cap(values) < length {
+		return make([]value, length)
 	}
+	values = values[:length]
+	clear(values)
+	return values
 }
 
 func (f *Frame) Instructions() op.Instructions {
-	return f.ins
+	return f.code.raw
 }
 
 type VM struct {
 	constants []runtime.RuntimeValue
+	// The constants stored as slots, so pushing them doesn't convert them.
+	literals  []value
+	result    *runtime.ResultTypes
+	contracts []*runtime.Contract
 	globals   []*Global
-	stack     []runtime.RuntimeValue
+	stack     []value
 	sp        int
 	frames    []*Frame
 	framesIdx int
-}
+	// Returned frames, that are reused by the next calls.
+	freeFrames []*Frame
+	// The decoded instructions of all functions.
+	codes map[*runtime.CompiledFunction]*code
+	// Decodes each instruction again when it is dispatched, only used to benchmark the decoding.
+	decodeOnDispatch bool
 
-func New(bytecode *compiler.Bytecode) *VM {
-	frames := make([]*Frame, maxFrames)
-	frames[0] = newGeneralFrame(bytecode.Instructions, 0)
+	stackLimit int
+	frameLimit int
+}
 
+// New creates a vm to run the bytecode.
+// The stack and the frames grow on demand up to their limits.
+func New(bytecode *compiler.Bytecode, opts ...Option) *VM {
 	vm := &VM{
-		stack:     make([]runtime.RuntimeValue, stackSize),
-		sp:        0,
-		constants: bytecode.Constants,
-		globals:   make([]*Global, len(bytecode.Globals)),
-		frames:    frames,
-		framesIdx: 1,
+		sp:         0,
+		constants:  bytecode.Constants,
+		literals:   values(bytecode.Constants),
+		result:     bytecode.Result,
+		contracts:  bytecode.Contracts,
+		globals:    make([]*Global, len(bytecode.Globals)),
+		codes:      make(map[*runtime.CompiledFunction]*code),
+		stackLimit: DefaultStackLimit,
+		frameLimit: DefaultFrameLimit,
+	}
+	for _, opt := range opts {
+		opt(vm)
 	}
+	vm.stack = make([]value, min(initialStackSize, vm.stackLimit))
+	vm.frames = make([]*Frame, 1, min(initialFrames, vm.frameLimit))
+	vm.frames[0] = vm.newFrame(decode(bytecode.Instructions), nil, 0)
+	vm.frames[0].locals = make([]value, len(bytecode.LocalNames))
+	vm.framesIdx = 1
 
 	for i := range bytecode.Globals {
-		ins := bytecode.Globals[i].Instructions
+		initializer := decode(bytecode.Globals[i].Instructions)
+		locals := bytecode.Globals[i].Locals()
 		vm.globals[i] = MakeGlobal(func(ti TaskId) (runtime.RuntimeValue, error) {
-			return vm.initGlobal(ti, ins)
+			return vm.initGlobal(ti, initializer, locals)
 		})
 	}
+	for _, c := range bytecode.Constants {
+		if fn, ok := c.(*runtime.CompiledFunction); ok {
+			vm.codes[fn] = decode(fn.Instructions)
+		}
+	}
 
 	return vm
 }
 
+// Load reads bytecode in the `.zirrc` format and creates a vm to run it.
+// Extern functions are bound by the given plugins.
+func Load(r io.Reader, plugins *runtime.ExternPluginRegistry, opts ...Option) (*VM, error) {
+	bytecode, err := compiler.DecodeBytecode(r, plugins)
+	if err != nil {
+		return nil, err
+	}
+	return New(bytecode, opts...), nil
+}
+
 func (vm *VM) LastPoppedStackElem() runtime.RuntimeValue {
-	return vm.stack[vm.sp]
+	if vm.sp >= len(vm.stack) {
+		return nil
+	}
+	return vm.stack[vm.sp].boxed()
 }
 
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIdx-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
-	vm.frames[vm.framesIdx] = f
+// pushFrame fails with a StackOverflow, when the frames would exceed their limit.
+func (vm *VM) pushFrame(f *Frame) error {
+	switch {
+	case vm.framesIdx < len(vm.frames):
+		vm.frames[vm.framesIdx] = f
+	case vm.framesIdx >= vm.frameLimit:
+		return vm.stackOverflow()
+	default:
+		vm.frames = append(vm.frames, f)
+	}
 	vm.framesIdx++
+	return nil
+}
+
+// StackOverflow is the runtime error of calls nested deeper than the frames or the stack allow.
+type StackOverflow struct {
+	// The active calls from the innermost frame outwards.
+	// Consecutive calls from the same position are collapsed into one entry.
+	Trace []string
+}
+
+// Error implements error.
+func (e *StackOverflow) Error() string {
+	var out strings.Builder
+	out.WriteString("stack overflow")
+	for _, call := range e.Trace {
+		out.WriteString("\n\tat ")
+		out.WriteString(call)
+	}
+	return out.String()
+}
+
+// stackOverflow fails without a trace.
+// The dispatch loop adds it, once it stored the position of the current frame.
+func (vm *VM) stackOverflow() *StackOverflow {
+	return &StackOverflow{}
+}
+
+// trace describes the active frames from the innermost outwards.
+func (vm *VM) trace() []string {
+	var (
+		trace    []string
+		previous string
+		repeated int
+	)
+	collapse := func() {
+		if repeated > 1 {
+			trace[len(trace)-1] += fmt.Sprintf(" (%d times)", repeated)
+		}
+	}
+	for i := vm.framesIdx - 1; i >= 0; i-- {
+		call := vm.frames[i].position()
+		if call == previous {
+			repeated++
+			continue
+		}
+		collapse()
+		trace = append(trace, call)
+		previous = call
+		repeated = 1
+	}
+	collapse()
+	return trace
+}
+
+// position describes the function of the frame and the statement it currently runs.
+func (f *Frame) position() string {
+	if f.fn == nil {
+		return "top level"
+	}
+	m, ok := f.fn.SourceMap.Lookup(f.code.offsets[max(f.ip-1, 0)])
+	if !ok {
+		return f.fn.Name
+	}
+	return fmt.Sprintf("%s (%s)", f.fn.Name, m)
 }
 
 func (vm *VM) popFrame() *Frame {
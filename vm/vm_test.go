@@ -1,6 +1,7 @@
 package vm_test
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 	"testing"
@@ -19,12 +20,19 @@ type vmTestCase struct {
 	input    string
 	expected any
 	err      string
+	// compiles with runtime contract checks
+	contracts bool
+	// compiles with the given optimizations
+	optimization compiler.OptimizationLevel
 }
 
 func TestBasicOperations(t *testing.T) {
 	tests := []vmTestCase{
 		{input: "1", expected: 1},
 		{input: "1+2", expected: 3},
+		{input: "7 % 3", expected: 1},
+		{input: "7 / 0", err: "integer division by zero"},
+		{input: "7 % 0", err: "integer modulo by zero"},
 		{input: "true", expected: true},
 		{input: "false", expected: false},
 		{input: "!true", expected: false},
@@ -57,75 +65,1745 @@ func TestBasicOperations(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "1 == 1", expected: true},
+		{input: "1 == 1.0", expected: false},
+		{input: "null == null", expected: true},
+		{input: "null == false", expected: false},
+		{input: `"a" == "a"`, expected: true},
+		{input: `[1, "a", [null]] == [1, "a", [null]]`, expected: true},
+		{input: "[1, 2] == [2, 1]", expected: false},
+		{input: "[1] == [1, 1]", expected: false},
+		{input: "[1] != [1]", expected: false},
+		{input: "[1] == 1", expected: false},
+		{input: `["a": [1]] == ["a": [1]]`, expected: true},
+		{input: `["a": 1] == ["b": 1]`, expected: false},
+		{
+			label: "data values by type and fields",
+			input: `
+			data Point {
+				x
+				y
+			}
+			data Size {
+				x
+				y
+			}
+			[Point(1, [2]) == Point(1, [2]), Point(1, 2) == Point(2, 1), Point(1, 2) == Size(1, 2)]
+			`,
+			expected: []any{true, false, false},
+		},
+		{
+			label: "functions by identity",
+			input: `
+			func f() { return 1 }
+			func g() { return 1 }
+			[f == f, f == g, f != g]
+			`,
+			expected: []any{true, false, true},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestBasicFunctions(t *testing.T) {
 	tests := []vmTestCase{
-		{input: "func example() { return 42 }\nexample()", expected: 42},
-		{input: "func example() { return }\nexample()", expected: nil},
-		{input: `
-		func example() {
-			let x = 1
-			return x + x
-		}
-		example()
-		`, expected: 2},
+		{input: "func example() { return 42 }\nexample()", expected: 42},
+		{input: "func example() { return }\nexample()", expected: nil},
+		{input: `
+		func example() {
+			let x = 1
+			return x + x
+		}
+		example()
+		`, expected: 2},
+		{
+			label: "function with parameter",
+			input: `
+		func twice(n) {
+			return n+n
+		}
+		twice(2)
+		`, expected: 4},
+		{
+			label: "function with parameters in order",
+			input: `
+		func sub(lhs, rhs) {
+			return lhs - rhs
+		}
+		sub(3, 1)
+		`, expected: 2},
+		{
+			label: "if statement without else falls through",
+			input: `
+		func one() { return 1 }
+		func example(flag) {
+			if flag {
+				one()
+			}
+			return 3
+		}
+		example(true)
+		`, expected: 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestData(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			label: "empty data",
+			input: `
+			data Example
+			Example()
+			`,
+			expected: data{typeId: 0, values: []any{}},
+		},
+		{
+			label: "data with values",
+			input: `
+			data Person {
+				name
+				age
+			}
+			Person("Max", 42)
+			`,
+			expected: data{typeId: 0, values: []any{
+				"Max", 42,
+			}},
+		},
+		{
+			label: "data with values and member access",
+			input: `
+			data Person {
+				name
+				age
+			}
+			Person("Max", 42).name
+			`,
+			expected: "Max",
+		},
+		{
+			label: "data with values and member access",
+			input: `
+			data Person {
+				name
+				age
+			}
+			Person("Max", 42).age
+			`,
+			expected: 42,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCopyWith(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			label: "replace single field",
+			input: `
+			data Person {
+				name
+				age
+			}
+			Person("Max", 42) with { age: 43 }
+			`,
+			expected: data{typeId: 0, values: []any{
+				"Max", 43,
+			}},
+		},
+		{
+			label: "original stays unchanged",
+			input: `
+			data Person {
+				name
+				age
+			}
+			let max = Person("Max", 42)
+			let older = max with { age: 43 }
+			max.age + older.age
+			`,
+			expected: 85,
+		},
+		{
+			label: "replace multiple fields",
+			input: `
+			data Person {
+				name
+				age
+			}
+			(Person("Max", 42) with { name: "Moritz", age: 1 }).name
+			`,
+			expected: "Moritz",
+		},
+		{
+			label: "data declared in enum",
+			input: `
+			enum Shape {
+				data Circle { radius }
+				data Square { length }
+			}
+			(Circle(1) with { radius: 2 }).radius
+			`,
+			expected: 2,
+		},
+		{
+			label: "non-data target at runtime",
+			input: `
+			data Pet { age }
+			func grow(any) {
+				return any with { age: 2 }
+			}
+			grow(42)
+			`,
+			err: `with is only defined on data values (runtime.Int "42")`,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestNamedAndDefaultArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			label: "named data arguments",
+			input: `
+			data Person {
+				name
+				age
+			}
+			Person(age: 42, name: "Max")
+			`,
+			expected: data{typeId: 0, values: []any{
+				"Max", 42,
+			}},
+		},
+		{
+			label: "default data field",
+			input: `
+			data Person {
+				name
+				@Default(0) age
+			}
+			Person("Max").age
+			`,
+			expected: 0,
+		},
+		{
+			label: "named and default function arguments",
+			input: `
+			func greet(@Default("Hello") greeting, name) {
+				return greeting
+			}
+			greet(name: "Max")
+			`,
+			expected: "Hello",
+		},
+		{
+			label: "dynamic callee with named arguments",
+			input: `
+			func sub(lhs, rhs) {
+				return lhs - rhs
+			}
+			let f = sub
+			f(rhs: 1, lhs: 3)
+			`,
+			expected: 2,
+		},
+		{
+			label: "dynamic callee with omitted default",
+			input: `
+			func sub(lhs, @Default(1) rhs) {
+				return lhs - rhs
+			}
+			let f = sub
+			f(3)
+			`,
+			expected: 2,
+		},
+		{
+			label: "dynamic callee with unknown argument",
+			input: `
+			func sub(lhs, rhs) {
+				return lhs - rhs
+			}
+			let f = sub
+			f(1, other: 3)
+			`,
+			err: `unknown argument "other"`,
+		},
+		{
+			label: "dynamic callee with missing argument",
+			input: `
+			func sub(lhs, rhs) {
+				return lhs - rhs
+			}
+			let f = sub
+			f(rhs: 3)
+			`,
+			err: `missing arguments lhs`,
+		},
+		{
+			label: "named arguments in source order",
+			input: `
+			func f(a, b) {
+				return a
+			}
+			f(b: panic("b"), a: panic("a"))
+			`,
+			err: `panic: "b"`,
+		},
+		{
+			label: "reordered named arguments within functions",
+			input: `
+			func sub(lhs, @Default(0) offset, rhs) {
+				return lhs - rhs - offset
+			}
+			func trace() {
+				let result = sub(rhs: 1, lhs: 3)
+				return [result, sub(10, rhs: sub(rhs: 2, lhs: 5), offset: 1)]
+			}
+			trace()
+			`,
+			expected: []any{2, 6},
+		},
+		{
+			label: "reordered named arguments of globals",
+			input: `
+			func sub(lhs, rhs) {
+				return lhs - rhs
+			}
+			let difference = sub(rhs: 1, lhs: 3)
+			difference
+			`,
+			expected: 2,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestVariadicArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			label: "collects excess arguments",
+			input: `
+			func list(first, rest...) {
+				return rest
+			}
+			list(1, 2, 3)
+			`,
+			expected: []any{2, 3},
+		},
+		{
+			label: "empty variadic parameter",
+			input: `
+			func list(first, rest...) {
+				return rest
+			}
+			list(1)
+			`,
+			expected: []any{},
+		},
+		{
+			label: "named variadic argument",
+			input: `
+			func list(first, rest...) {
+				return rest
+			}
+			list(rest: [2, 3], first: 1)
+			`,
+			expected: []any{2, 3},
+		},
+		{
+			label: "spread arguments",
+			input: `
+			func sub(lhs, rhs) {
+				return lhs - rhs
+			}
+			let args = [3, 1]
+			sub(args...)
+			`,
+			expected: 2,
+		},
+		{
+			label: "spread into variadic parameter",
+			input: `
+			func list(first, rest...) {
+				return rest
+			}
+			list(1, [2, 3]...)
+			`,
+			expected: []any{2, 3},
+		},
+		{
+			label: "dynamic variadic callee",
+			input: `
+			func list(first, rest...) {
+				return rest
+			}
+			let f = list
+			f(1, 2, 3)
+			`,
+			expected: []any{2, 3},
+		},
+		{
+			label: "spread of non array",
+			input: `
+			func id(value) {
+				return value
+			}
+			id(1...)
+			`,
+			err: `spread argument must be an Array (runtime.Int "1")`,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+type parsePlugin struct{}
+
+func (parsePlugin) Bind(module *ast.SymbolTable, decl *ast.Symbol) runtime.RuntimeValue {
+	if decl.Name != "parse" {
+		return nil
+	}
+	fn, err := runtime.MakeFailableExternFunc(decl, func(args []runtime.RuntimeValue) (runtime.RuntimeValue, error) {
+		str, ok := args[0].(runtime.String)
+		if !ok {
+			return nil, fmt.Errorf("expected String, got %T", args[0])
+		}
+		if str == "" {
+			return nil, runtime.Failure{Message: "empty input"}
+		}
+		return str, nil
+	})
+	if err != nil {
+		return nil
+	}
+	return fn
+}
+
+func TestExternFailures(t *testing.T) {
+	tests := []struct {
+		label    string
+		input    string
+		expected any
+		err      string
+	}{
+		{
+			label: "failure as Err",
+			input: `
+			enum Result {
+				data Ok { value }
+				data Err { error }
+			}
+			data Error { message }
+			extern func parse(input)
+			func check(input) {
+				parse(input)?
+				return "ok"
+			}
+			[check("").error.message, check("a")]
+			`,
+			expected: []any{"empty input", "ok"},
+		},
+		{
+			label: "failure without Error",
+			input: `
+			enum Result {
+				data Ok { value }
+				data Err { error }
+			}
+			extern func parse(input)
+			parse("").error
+			`,
+			expected: "empty input",
+		},
+		{
+			label: "failure without Result",
+			input: `
+			extern func parse(input)
+			parse("")
+			`,
+			err: "extern parse(#1): empty input",
+		},
+		{
+			label: "other errors abort",
+			input: `
+			enum Result {
+				data Ok { value }
+				data Err { error }
+			}
+			extern func parse(input)
+			parse(42)
+			`,
+			err: "extern parse(#1): expected String, got runtime.Int",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.label), func(t *testing.T) {
+			program := prepareSourceFileParsing(t, tt.input)
+
+			comp := compiler.NewWithPlugins(runtime.MakeExternPluginRegistry(parsePlugin{}))
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			vm := vm.New(comp.Bytecode())
+			err = vm.Run()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			testExpectedValue(t, tt.expected, vm.LastPoppedStackElem())
+		})
+	}
+}
+
+type sumPlugin struct{}
+
+func (sumPlugin) Bind(module *ast.SymbolTable, decl *ast.Symbol) runtime.RuntimeValue {
+	if decl.Name != "sum" {
+		return nil
+	}
+	fn, err := runtime.MakeExternFunc(decl, func(args []runtime.RuntimeValue) runtime.RuntimeValue {
+		var sum runtime.Int
+		for _, arg := range args[0].(runtime.Array) {
+			sum += arg.(runtime.Int)
+		}
+		return sum
+	})
+	if err != nil {
+		return nil
+	}
+	return fn
+}
+
+func TestExternFunctions(t *testing.T) {
+	program := prepareSourceFileParsing(t, `
+	extern func sum(values...)
+	sum(1, 2, 3) + sum([4]...)
+	`)
+
+	comp := compiler.NewWithPlugins(runtime.MakeExternPluginRegistry(sumPlugin{}))
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := vm.New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedValue(t, 10, vm.LastPoppedStackElem())
+}
+
+func TestLoadSerializedBytecode(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			label: "functions, defaults and globals",
+			input: `
+			let base = 40
+			func add(a, @Default(2) b) {
+				return a + b
+			}
+			add(base)
+			`,
+			expected: 42,
+		},
+		{
+			label: "data types and enums",
+			input: `
+			data Circle { radius }
+			data Square { side }
+			enum Shape {
+				Circle
+				Square
+			}
+			func size(@Shape shape) {
+				return switch shape {
+				case @Circle:
+					shape.radius
+				case @Square:
+					shape.side
+				}
+			}
+			size(Circle(2)) + size(Square(3) with { side: 4 })
+			`,
+			expected: 6,
+		},
+		{
+			label:    "literals",
+			input:    `[1.5 + 1.5 == 3.0, 'a', "b", null, ["k": 1]]`,
+			expected: []any{true, 'a', "b", runtime.Null{}, map[any]any{"k": 1}},
+		},
+		{
+			label: "results and failures",
+			input: `
+			enum Result {
+				data Ok { value }
+				data Err { error }
+			}
+			data Error { message }
+			extern func sum(values...)
+			func twice(result) {
+				let value = result?
+				return value + value
+			}
+			twice(Ok(sum(1, 2)))
+			`,
+			expected: 6,
+		},
+		{
+			label: "contracts",
+			input: `
+			data Box { @Int value }
+			func unbox(@Box box) {
+				return box.value
+			}
+			unbox(Box("a"))
+			`,
+			err:       "contract violation for field value of Box: want @Int, got String, called at top level",
+			contracts: true,
+		},
+		{
+			label: "module values",
+			input: `
+			module examples
+			let answer = 42
+			func get(m) {
+				return m.answer
+			}
+			get(examples)
+			`,
+			expected: 42,
+		},
+		{
+			label: "temporaries",
+			input: `
+			func sub(lhs, rhs) {
+				return lhs - rhs
+			}
+			let difference = sub(rhs: 1, lhs: 3)
+			difference + sub(rhs: 1, lhs: 3)
+			`,
+			expected: 4,
+		},
+	}
+
+	plugins := runtime.MakeExternPluginRegistry(sumPlugin{})
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.label), func(t *testing.T) {
+			program := prepareSourceFileParsing(t, tt.input)
+
+			comp := compiler.NewWithPlugins(plugins)
+			if tt.contracts {
+				comp.EnableContracts()
+			}
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			var buf bytes.Buffer
+			err = comp.Bytecode().Encode(&buf)
+			if err != nil {
+				t.Fatalf("encode error: %s", err)
+			}
+			machine, err := vm.Load(&buf, plugins)
+			if err != nil {
+				t.Fatalf("load error: %s", err)
+			}
+
+			err = machine.Run()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("expected error %q, got %q", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			testExpectedValue(t, tt.expected, machine.LastPoppedStackElem())
+		})
+	}
+}
+
+func TestResultPropagation(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			label: "unwraps ok values",
+			input: `
+			enum Result {
+				data Ok { value }
+				data Err { error }
+			}
+			data Error { message }
+
+			func twice(result) {
+				let value = result?
+				return value + value
+			}
+			twice(Ok(21))
+			`,
+			expected: 42,
+		},
+		{
+			label: "returns err values early",
+			input: `
+			enum Result {
+				data Ok { value }
+				data Err { error }
+			}
+			data Error { message }
+
+			func twice(result) {
+				let value = result?
+				return value + value
+			}
+			twice(Err(Error("failed"))).error.message
+			`,
+			expected: "failed",
+		},
+		{
+			label: "propagates through nested calls",
+			input: `
+			enum Result {
+				data Ok { value }
+				data Err { error }
+			}
+			data Error { message }
+
+			func parse(input) {
+				if input == "" {
+					return Err(Error("empty"))
+				}
+				return Ok(input)
+			}
+			func isWorld(input) {
+				return Ok(parse(input)? == "World")
+			}
+			[isWorld("").error.message, isWorld("World").value]
+			`,
+			expected: []any{"empty", true},
+		},
+		{
+			label: "passes other values",
+			input: `
+			enum Result {
+				data Ok { value }
+				data Err { error }
+			}
+			data Error { message }
+
+			func id(value) {
+				return value?
+			}
+			id(42)
+			`,
+			expected: 42,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			label: "self recursion",
+			input: `
+			func count(n, acc) {
+				if n == 0 {
+					return acc
+				}
+				return count(n - 1, acc + 1)
+			}
+			count(100000, 0)
+			`,
+			expected: 100000,
+		},
+		{
+			label: "through if expressions",
+			input: `
+			func count(n, acc) {
+				return if n == 0 { acc } else { count(n - 1, acc + 1) }
+			}
+			count(100000, 0)
+			`,
+			expected: 100000,
+		},
+		{
+			label: "mutual recursion",
+			input: `
+			func isEven(n) {
+				return if n == 0 { true } else { isOdd(n - 1) }
+			}
+			func isOdd(n) {
+				return if n == 0 { false } else { isEven(n - 1) }
+			}
+			isEven(100001)
+			`,
+			expected: false,
+		},
+		{
+			label: "with defaults",
+			input: `
+			func count(n, @Default(1) step) {
+				return if n <= 0 { n } else { count(n - step) }
+			}
+			count(100000)
+			`,
+			expected: 0,
+		},
+		{
+			label: "data constructors",
+			input: `
+			data Box { value }
+			func wrap(value) {
+				return Box(value)
+			}
+			wrap(1).value
+			`,
+			expected: 1,
+		},
+		{
+			label: "deferred blocks still run",
+			input: `
+			func id(value) {
+				return value
+			}
+			func example() {
+				defer { return recover() ?? 42 }
+				return id(1)
+			}
+			example()
+			`,
+			expected: 42,
+		},
+		{
+			label: "spread arguments",
+			input: `
+			func count(n, rest...) {
+				return if n == 0 { rest } else { count(n - 1, [1, 2]...) }
+			}
+			count(100000)
+			`,
+			expected: []any{1, 2},
+		},
+		{
+			label: "named arguments of dynamic callees",
+			input: `
+			func count(f, n) {
+				return if n == 0 { n } else { f(f, n: n - 1) }
+			}
+			count(count, 100000)
+			`,
+			expected: 0,
+		},
+		{
+			label: "through switch expressions",
+			input: `
+			func count(n, acc) {
+				return switch n {
+				case 0:
+					acc
+				case _:
+					count(n - 1, acc + 1)
+				}
+			}
+			count(100000, 0)
+			`,
+			expected: 100000,
+		},
+		{
+			label: "stack overflow",
+			input: `func deep(n) {
+	if n == 0 {
+		return 0
+	}
+	return 1 + deep(n - 1)
+}
+deep(100000)
+`,
+			err: "stack overflow\n\tat deep (testing:///test/test.zirr:5:2) (1023 times)\n\tat top level",
+		},
+		{
+			label: "recovered stack overflow",
+			input: `
+			func deep(n) {
+				return 1 + deep(n)
+			}
+			func safe() {
+				defer { return recover() != null }
+				return deep(0)
+			}
+			safe()
+			`,
+			expected: true,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLimits(t *testing.T) {
+	deep := `func deep(n) {
+	if n == 0 {
+		return 0
+	}
+	return 1 + deep(n - 1)
+}
+`
+	elements := make([]string, 100)
+	for i := range elements {
+		elements[i] = fmt.Sprint(i)
+	}
+	tests := []struct {
+		label    string
+		input    string
+		opts     []vm.Option
+		expected any
+		err      string
+	}{
+		{
+			label:    "frames grow up to the default limit",
+			input:    deep + "deep(1000)",
+			expected: 1000,
+		},
+		{
+			label: "frame limit",
+			input: deep + "deep(100)",
+			opts:  []vm.Option{vm.WithFrameLimit(10)},
+			err:   "stack overflow\n\tat deep (testing:///test/test.zirr:5:2) (9 times)\n\tat top level",
+		},
+		{
+			label:    "raised frame limit",
+			input:    deep + "deep(10000)",
+			opts:     []vm.Option{vm.WithFrameLimit(10002), vm.WithStackLimit(20000)},
+			expected: 10000,
+		},
+		{
+			label:    "stack grows up to the default limit",
+			input:    "[" + strings.Join(elements, ", ") + "][99]",
+			expected: 99,
+		},
+		{
+			label: "stack limit",
+			input: "[" + strings.Join(elements, ", ") + "][99]",
+			opts:  []vm.Option{vm.WithStackLimit(50)},
+			err:   "stack overflow\n\tat top level",
+		},
+		{
+			label: "stack limit within functions",
+			input: "func list() {\n\tlet first = 0\n\treturn [" + strings.Join(elements, ", ") + "]\n}\nlist()",
+			opts:  []vm.Option{vm.WithStackLimit(50)},
+			err:   "stack overflow\n\tat list (testing:///test/test.zirr:3:2)\n\tat top level",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.label), func(t *testing.T) {
+			program := prepareSourceFileParsing(t, tt.input)
+			comp := compiler.New()
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			machine := vm.New(comp.Bytecode(), tt.opts...)
+			err = machine.Run()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("expected error %q, got %q", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			testExpectedValue(t, tt.expected, machine.LastPoppedStackElem())
+		})
+	}
+}
+
+// TestUnboxedValues checks, that operating on immediate values doesn't allocate,
+// so a loop allocates as much as a single iteration.
+func TestUnboxedValues(t *testing.T) {
+	allocs := func(steps int) float64 {
+		input := fmt.Sprintf(`
+		func step(n, acc) {
+			return if n <= 0 {
+				acc
+			} else {
+				step(n - 1, acc + n * 1000 - n / 2 + 0.5 * 2.0)
+			}
+		}
+		step(%d, 0)
+		`, steps)
+		comp := compiler.New()
+		err := comp.Compile(prepareSourceFileParsing(t, input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+		return testing.AllocsPerRun(5, func() {
+			machine := vm.New(bytecode)
+			if err := machine.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+		})
+	}
+
+	once, loop := allocs(1), allocs(1000)
+	if loop != once {
+		t.Errorf("expected %v allocations for 1000 steps like for a single step, got %v", once, loop)
+	}
+}
+
+func TestDeferAndRecover(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			label: "deferred return replaces result",
+			input: `
+			func example() {
+				defer { return 2 }
+				return 1
+			}
+			example()
+			`,
+			expected: 2,
+		},
+		{
+			label: "deferred blocks run in reverse order",
+			input: `
+			func example() {
+				defer { return 1 }
+				defer { return 2 }
+				return 0
+			}
+			example()
+			`,
+			expected: 1,
+		},
+		{
+			label: "deferred blocks run when falling off the end",
+			input: `
+			func example() {
+				defer { return 3 }
+			}
+			example()
+			`,
+			expected: 3,
+		},
+		{
+			label: "deferred blocks run on propagation",
+			input: `
+			enum Result {
+				data Ok { value }
+				data Err { error }
+			}
+			func example(result) {
+				defer { return "cleaned" }
+				return result?
+			}
+			example(Err("failed"))
+			`,
+			expected: "cleaned",
+		},
+		{
+			label: "recover without panic",
+			input: `
+			func example() {
+				defer { return recover() ?? 42 }
+				return 1
+			}
+			example()
+			`,
+			expected: 42,
+		},
+		{
+			label: "recover explicit panic",
+			input: `
+			func example() {
+				defer { return recover() }
+				panic("failed")
+			}
+			example()
+			`,
+			expected: "failed",
+		},
+		{
+			label: "recover runtime errors as Error",
+			input: `
+			enum Result {
+				data Ok { value }
+				data Err { error }
+			}
+			data Error { message }
+			func example() {
+				defer { return recover().message }
+				return [1][3]
+			}
+			example()
+			`,
+			expected: "array index 3 out of bounds",
+		},
+		{
+			label: "recover integer division by zero",
+			input: `
+			func divide(n) {
+				defer { return recover() }
+				return 1 / n
+			}
+			divide(0)
+			`,
+			expected: "integer division by zero",
+		},
+		{
+			label: "recover integer modulo by zero",
+			input: `
+			func modulo(n) {
+				defer { return recover() }
+				return 1 % n
+			}
+			modulo(0)
+			`,
+			expected: "integer modulo by zero",
+		},
+		{
+			label: "unwinds nested frames and restores the stack",
+			input: `
+			func fail(n) {
+				return [n][n]
+			}
+			func twice(n) {
+				return fail(n) + fail(n)
+			}
+			func safe(n) {
+				defer { return recover() ?? "ok" }
+				return twice(n)
+			}
+			[1, safe(1), safe(0), 4]
+			`,
+			expected: []any{1, "array index 1 out of bounds", "ok", 4},
+		},
+		{
+			label: "deferred blocks of unwound frames run",
+			input: `
+			func inner() {
+				defer { return "ignored" }
+				panic("inner")
+			}
+			func outer() {
+				defer { return recover() }
+				return inner()
+			}
+			outer()
+			`,
+			expected: "inner",
+		},
+		{
+			label: "panic in deferred block replaces the panic",
+			input: `
+			func inner() {
+				defer { panic("second") }
+				panic("first")
+			}
+			func outer() {
+				defer { return recover() }
+				return inner()
+			}
+			outer()
+			`,
+			expected: "second",
+		},
+		{
+			label: "recover failing global initialization",
+			input: `
+			let broken = [][0]
+			func read() {
+				defer { return recover() }
+				return broken
+			}
+			[read(), read()]
+			`,
+			expected: []any{"array index 0 out of bounds", "array index 0 out of bounds"},
+		},
+		{
+			label: "unrecovered panic",
+			input: `
+			func example() {
+				defer { return 1 }
+				panic("failed")
+			}
+			example()
+			`,
+			err: `panic: "failed"`,
+		},
+		{
+			label: "unrecovered runtime error",
+			input: `
+			func example() {
+				return [][0]
+			}
+			example()
+			`,
+			err: "array index 0 out of bounds",
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestContracts(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			label: "unchecked without contracts",
+			input: `
+			func first(@Int n) {
+				return n
+			}
+			first("a")
+			`,
+			expected: "a",
+		},
+		{
+			label: "satisfied parameters",
+			input: `
+			func twice(@Int n) {
+				return n + n
+			}
+			twice(2)
+			`,
+			expected:  4,
+			contracts: true,
+		},
+		{
+			label: "violated parameter",
+			input: `
+			func twice(@Int n) {
+				return n + n
+			}
+			twice("a")
+			`,
+			err:       "contract violation for parameter n of twice: want @Int, got String, called at top level",
+			contracts: true,
+		},
+		{
+			label: "names the calling function",
+			input: `
+			func twice(@Type(Int) n) {
+				return n + n
+			}
+			func greet() {
+				return twice("a")
+			}
+			greet()
+			`,
+			err:       "contract violation for parameter n of twice: want @Int, got String, called from greet",
+			contracts: true,
+		},
+		{
+			label: "violated return value",
+			input: `
+			@Returns(Int)
+			func name() {
+				return "Max"
+			}
+			name()
+			`,
+			err:       "contract violation for return value of name: want @Int, got String, called at top level",
+			contracts: true,
+		},
+		{
+			label: "violated data field",
+			input: `
+			data Person {
+				@String name
+			}
+			Person(42)
+			`,
+			err:       "contract violation for field name of Person: want @String, got Int, called at top level",
+			contracts: true,
+		},
+		{
+			label: "violated data field in copy with update",
+			input: `
+			data Person {
+				@String name
+			}
+			Person("Max") with { name: 42 }
+			`,
+			err:       "contract violation for field name of Person: want @String, got Int, called at top level",
+			contracts: true,
+		},
+		{
+			label: "enum cases",
+			input: `
+			enum Shape {
+				data Circle { radius }
+				data Square { length }
+			}
+			data Line { length }
+			func area(@Shape shape) {
+				return 1
+			}
+			area(Circle(1)) + area(Square(2))
+			area(Line(3))
+			`,
+			err:       "contract violation for parameter shape of area: want @Shape, got Line, called at top level",
+			contracts: true,
+		},
+		{
+			label: "has annotation",
+			input: `
+			annotation Countable {}
+
+			@Countable
+			data Bag { items }
+			data Box { item }
+
+			func count(@Has(Countable) value) {
+				return 1
+			}
+			count(Bag([]))
+			count(Box(1))
+			`,
+			err:       "contract violation for parameter value of count: want @Has(Countable), got Box, called at top level",
+			contracts: true,
+		},
+		{
+			label: "violations can be recovered",
+			input: `
+			func twice(@Int n) {
+				return n + n
+			}
+			func safe() {
+				defer {
+					return recover()
+				}
+				return twice("a")
+			}
+			safe()
+			`,
+			expected:  "contract violation for parameter n of twice: want @Int, got String, called from safe",
+			contracts: true,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestModuleValues(t *testing.T) {
+	tests := []vmTestCase{
 		{
-			label: "function with parameter",
+			label: "function of own module",
 			input: `
-		func twice(n) {
-			return n+n
+			module examples
+			func answer() {
+				return 42
+			}
+			examples.answer()
+			`,
+			expected: 42,
+		},
+		{
+			label: "variable of own module",
+			input: `
+			module examples
+			let answer = 40 + 2
+			examples.answer
+			`,
+			expected: 42,
+		},
+		{
+			label: "passed as value",
+			input: `
+			module examples
+			let answer = 42
+			func get(m) {
+				return m.answer
+			}
+			get(examples)
+			`,
+			expected: 42,
+		},
+		{
+			label: "private declarations are hidden",
+			input: `
+			module examples
+			let _answer = 42
+			examples._answer
+			`,
+			err: `name "_answer" not found in *runtime.Module "module examples"`,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSwitch(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			label: "first matching value",
+			input: `
+			func name(n) {
+				switch n {
+				case 1:
+					return 1
+				case 2:
+					return 20
+				case _:
+					return 300
+				}
+			}
+			name(1) + name(2) + name(3)
+			`,
+			expected: 321,
+		},
+		{
+			label: "no matching statement case",
+			input: `
+			func name(n) {
+				switch n {
+				case 1:
+					return 1
+				}
+				return 0
+			}
+			name(2)
+			`,
+			expected: 0,
+		},
+		{
+			label: "types and enums",
+			input: `
+			data Circle { radius }
+			data Square { side }
+			data Triangle
+			enum Polygon {
+				Square
+				Triangle
+			}
+			enum Shape {
+				Circle
+				Polygon
+			}
+			func describe(@Shape shape) {
+				return switch shape {
+				case @Circle:
+					shape.radius
+				case @Polygon:
+					0
+				}
+			}
+			describe(Circle(2)) + describe(Square(3)) + describe(Triangle())
+			`,
+			expected: 2,
+		},
+		{
+			label: "annotated types",
+			input: `
+			annotation Round {}
+			@Round
+			data Circle
+			data Square
+			func isRound(value) {
+				return switch value {
+				case @Has(Round):
+					true
+				case @Int:
+					false
+				case _:
+					false
+				}
+			}
+			[isRound(Circle()), isRound(Square()), isRound(1)]
+			`,
+			expected: []any{true, false, false},
+		},
+		{
+			label: "array values",
+			input: `
+			func pick(xs) {
+				return switch xs {
+				case [1]:
+					1
+				case [1, 2]:
+					2
+				case _:
+					3
+				}
+			}
+			[pick([1]), pick([1, 2]), pick([2]), pick(1)]
+			`,
+			expected: []any{1, 2, 3, 3},
+		},
+		{
+			label: "data values",
+			input: `
+			data Point {
+				x
+				y
+			}
+			func pick(p) {
+				return switch p {
+				case Point(1, 2):
+					1
+				case p:
+					2
+				case _:
+					3
+				}
+			}
+			[pick(Point(1, 2)), pick(Point(2, 1))]
+			`,
+			expected: []any{1, 2},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestWideOperands(t *testing.T) {
+	// more constants than fit into narrow operands, as each literal is a new constant
+	terms := make([]string, 70000)
+	for i := range terms {
+		terms[i] = fmt.Sprint(i)
+	}
+	sum := strings.Join(terms, " + ")
+	pick := fmt.Sprintf(`
+	func pick(flag) {
+		if flag {
+			return %s
 		}
-		twice(2)
-		`, expected: 4},
+		return 42
+	}
+	`, sum)
+
+	tests := []vmTestCase{
+		{label: "wide constants", input: sum, expected: 69999 * 70000 / 2},
+		{label: "far jump taken", input: pick + "pick(false)", expected: 42},
+		{label: "far jump not taken", input: pick + "pick(true)", expected: 69999 * 70000 / 2},
 	}
 
 	runVmTests(t, tests)
 }
 
-func TestData(t *testing.T) {
+func TestOptimization(t *testing.T) {
+	// the results are returned from functions, so they are checked within optimized functions
 	tests := []vmTestCase{
 		{
-			label: "empty data",
+			label:        "folded comparison",
+			input:        "let isFalse = 0 != 0\nisFalse",
+			expected:     false,
+			optimization: compiler.OptimizeFull,
+		},
+		{
+			label:        "folded arithmetic",
+			input:        "let x = -(2 * 3) + 1.5\nx == -4.5",
+			expected:     true,
+			optimization: compiler.OptimizeFull,
+		},
+		{
+			label: "decided branch",
 			input: `
-			data Example
-			Example()
+			func pick() {
+				if 1 < 2 {
+					return "then"
+				} else {
+					return "else"
+				}
+			}
+			pick()
 			`,
-			expected: data{typeId: 0, values: []any{}},
+			expected:     "then",
+			optimization: compiler.OptimizeFull,
 		},
 		{
-			label: "data with values",
+			label: "threaded jumps",
 			input: `
-			data Person {
-				name
-				age
+			func id(value) {
+				return value
 			}
-			Person("Max", 42)
+			func pick(a, b) {
+				if a {
+					if b {
+						return 1
+					} else {
+						id(2)
+					}
+				} else {
+					id(3)
+				}
+				return 4
+			}
+			[pick(true, true), pick(true, false), pick(false, true)]
 			`,
-			expected: data{typeId: 0, values: []any{
-				"Max", 42,
-			}},
+			expected:     []any{1, 4, 4},
+			optimization: compiler.OptimizePeephole,
 		},
 		{
-			label: "data with values and member access",
+			label: "deferred blocks stay reachable",
 			input: `
-			data Person {
-				name
-				age
+			func example() {
+				defer { return recover() ?? 42 }
+				if false {
+					panic("unreachable")
+				}
+				return 1
 			}
-			Person("Max", 42).name
+			example()
 			`,
-			expected: "Max",
+			expected:     42,
+			optimization: compiler.OptimizeFull,
 		},
 		{
-			label: "data with values and member access",
+			label: "float division by zero",
 			input: `
-			data Person {
-				name
-				age
+			func divide() {
+				return 1.0 / 0
 			}
-			Person("Max", 42).age
+			divide() > 1
+			`,
+			expected:     true,
+			optimization: compiler.OptimizeFull,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestOptimizationKeepsResults(t *testing.T) {
+	tests := []struct {
+		label string
+		input string
+	}{
+		{label: "decided branch", input: "if true { 1 } else { 2 }"},
+		{
+			label: "switch statement",
+			input: `
+			let n = 1
+			switch n {
+			case 1:
+				3
+			case _:
+				5
+			}
+			`,
+		},
+		{label: "module value", input: "module examples\nexamples"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d. %s", i, tt.label), func(t *testing.T) {
+			var results []runtime.RuntimeValue
+			for _, level := range []compiler.OptimizationLevel{compiler.OptimizeNone, compiler.OptimizeFull} {
+				comp := compiler.New()
+				comp.SetOptimizationLevel(level)
+				err := comp.Compile(prepareSourceFileParsing(t, tt.input))
+				if err != nil {
+					t.Fatalf("compiler error: %s", err)
+				}
+				machine := vm.New(comp.Bytecode())
+				err = machine.Run()
+				if err != nil {
+					t.Fatalf("vm error: %s", err)
+				}
+				results = append(results, machine.LastPoppedStackElem())
+			}
+			if _, ok := results[0].(runtime.Null); ok {
+				t.Fatalf("expected a result, got %v", results[0])
+			}
+			if results[0].Inspect() != results[1].Inspect() {
+				t.Errorf("expected %v when optimized, got %v", results[0], results[1])
+			}
+		})
+	}
+}
+
+func TestNullSafeOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{input: "null ?? 2", expected: 2},
+		{input: "1 ?? 2", expected: 1},
+		{input: "null ?? null ?? 3", expected: 3},
+		{input: "false ?? true", expected: false},
+		{input: `["a": 1]["b"] ?? 3`, expected: 3},
+		{input: "null?[0]", expected: runtime.Null{}},
+		{input: "[1, 2]?[1]", expected: 2},
+		{input: "null?.name", expected: runtime.Null{}},
+		{input: "null?.name.first", expected: runtime.Null{}},
+		{input: "null?.name ?? 4", expected: 4},
+		{
+			label: "optional member on data",
+			input: `
+			data Box { value }
+			Box(Box(1)).value?.value
+			`,
+			expected: 1,
+		},
+		{
+			label: "optional member on null field",
+			input: `
+			data Box { value }
+			Box(null).value?.value.value ?? 42
+			`,
+			expected: 42,
+		},
+		{
+			label: "non-optional member on null",
+			input: `
+			data Box { value }
+			Box(null).value.value
+			`,
+			err: `name "value" not found in runtime.Null "null"`,
+		},
+		{input: "null?.name()", expected: runtime.Null{}},
+		{input: "null?.name(1, 2)", expected: runtime.Null{}},
+		{input: "null?.name(1).first(2, 3)[0] ?? 4", expected: 4},
+		{
+			label: "optional invocation on data",
+			input: `
+			func double(value) {
+				return value * 2
+			}
+			data Box { apply }
+			Box(double)?.apply(21)
+			`,
+			expected: 42,
+		},
+		{
+			label: "optional invocation skips the chain",
+			input: `
+			let box = null
+			box?.apply(1).apply(2) ?? box?.apply(1, 2)[0] ?? 42
 			`,
 			expected: 42,
 		},
+		{
+			label: "non-optional invocation on null",
+			input: `
+			data Box { apply }
+			Box(null)?.apply(1)
+			`,
+			err: `cannot call runtime.Null "null"`,
+		},
 	}
 
 	runVmTests(t, tests)
@@ -203,6 +1881,10 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 			program := prepareSourceFileParsing(t, tt.input)
 
 			comp := compiler.New()
+			if tt.contracts {
+				comp.EnableContracts()
+			}
+			comp.SetOptimizationLevel(tt.optimization)
 			err := comp.Compile(program)
 			if err != nil {
 				t.Fatalf("compiler error: %s", err)
@@ -229,6 +1911,64 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 
 }
 
+// BenchmarkDispatch compares the pre-decoded instructions to decoding them on each dispatch
+// on call-heavy and arithmetic-heavy programs.
+func BenchmarkDispatch(b *testing.B) {
+	programs := []struct {
+		label string
+		input string
+	}{
+		{
+			label: "calls",
+			input: `
+			func fib(n) {
+				return if n < 2 { n } else { fib(n - 1) + fib(n - 2) }
+			}
+			fib(20)
+			`,
+		},
+		{
+			label: "arithmetic",
+			input: `
+			func step(n, acc) {
+				return if n == 0 {
+					acc
+				} else {
+					step(n - 1, (acc + n * 3 - n / 2) * 2 / 3 + (n - 1) * (n + 1) - n * n + 1)
+				}
+			}
+			step(10000, 0)
+			`,
+		},
+	}
+
+	for _, program := range programs {
+		comp := compiler.New()
+		err := comp.Compile(prepareSourceFileParsing(b, program.input))
+		if err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		for _, loop := range []struct {
+			label string
+			opts  []vm.Option
+		}{
+			{"decoded", nil},
+			{"decode-on-dispatch", []vm.Option{vm.WithDecodeOnDispatch()}},
+		} {
+			b.Run(program.label+"/"+loop.label, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					machine := vm.New(bytecode, loop.opts...)
+					if err := machine.Run(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
 func runBench(t *testing.B, input string) {
 	program := prepareSourceFileParsing(t, input)
 